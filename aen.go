@@ -16,6 +16,13 @@ import (
 // However, if the parameter ensure is given, the database will be created.
 // Calling this function should be followed with a "defer db.Close()"
 func OpenDatabase(path string, ensure bool) (db *database.Database, err error) {
+	backend, path, err := database.ParseStorePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if backend != database.BackendBolt {
+		return nil, fmt.Errorf("only available for the bolt backend, not for %s", backend)
+	}
 	_, err = os.Stat(path)
 	if err == nil {
 		db = database.NewDatabaseInstance(path)
@@ -31,6 +38,48 @@ func OpenDatabase(path string, ensure bool) (db *database.Database, err error) {
 	return db, err
 }
 
+// OpenDatabaseReadOnly opens an existing bolt database without write access. Unlike OpenDatabase, it does not wait
+// for other processes keeping the database open, e.g. "aen serve", but fails with ErrDatabaseInUse.
+func OpenDatabaseReadOnly(path string) (db *database.Database, err error) {
+	backend, path, err := database.ParseStorePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if backend != database.BackendBolt {
+		return nil, fmt.Errorf("only available for the bolt backend, not for %s", backend)
+	}
+	if _, err = os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("database file %s not available", path)
+	} else if err != nil {
+		return nil, err
+	}
+	db = database.NewDatabaseInstance(path)
+	if err = db.OpenReadOnly(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenStore opens the storage backend given by a URL-style path: "dir:///path" opens a directory store,
+// plain paths or "bolt:///path" a bolt database.
+// The parameter ensure is handled like by OpenDatabase.
+func OpenStore(path string, ensure bool) (store database.Store, err error) {
+	backend, storePath, err := database.ParseStorePath(path)
+	if err != nil {
+		return nil, err
+	}
+	switch backend {
+	case database.BackendDirectory:
+		return database.OpenDirectoryStore(storePath, ensure)
+	}
+	// Returning the nil pointer directly would result in a non-nil interface
+	db, err := OpenDatabase(path, ensure)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
 // EnsureKey returns a pointer to an age.X25519Identity struct.
 // The struct is created through the according parsing function of age.
 // If the keyfile is not available, a new keyfile will be generated.
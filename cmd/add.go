@@ -1,38 +1,37 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 
 	"github.com/3c7/aen"
-	"github.com/3c7/aen/internal/model"
 )
 
-// addFile adds a file as note to the database
-func addFile(pathFlag, fileFlag, titleFlag string) {
-	if fileFlag == "" {
-		log.Fatal("No file given.")
-	}
-
-	db, err := aen.OpenDatabase(pathFlag, false)
-	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+// openInput opens the file given by path for reading, "-" refers to stdin.
+func openInput(path string) (r io.ReadCloser, err error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
 	}
-	defer db.Close()
+	return os.Open(path)
+}
 
-	fNote, err := model.FileNoteFromFile(fileFlag, titleFlag)
-	if err != nil {
-		log.Fatalf("Error creating binary note from file: %v", err)
+// addFile adds a file as note to the database, "-" reads the file from stdin.
+func addFile(ctx context.Context, nb *aen.Notebook, fileFlag, titleFlag string) error {
+	if fileFlag == "" {
+		return errors.New("no file given")
 	}
-
-	x25519Recipients, err := db.GetAgeRecipients()
-	if err != nil {
-		log.Fatalf("Error loading recipients: %v", err)
+	if fileFlag == "-" && titleFlag == "" {
+		return errors.New("title must be given when reading from stdin")
 	}
-	encryptedNote, err := fNote.ToEncryptedNote(x25519Recipients...)
+	file, err := openInput(fileFlag)
 	if err != nil {
-		log.Fatalf("Error during note encryption: %v", err)
-	}
-	if err = db.SaveEncryptedNote(&encryptedNote); err != nil {
-		log.Fatalf("Error adding file to database: %v", err)
+		return err
 	}
+	defer file.Close()
+
+	_, err = nb.AddFile(ctx, titleFlag, filepath.Base(fileFlag), file)
+	return err
 }
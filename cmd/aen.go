@@ -2,13 +2,19 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"runtime/debug"
 	"strings"
+	"time"
 
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/agent"
+	"github.com/3c7/aen/internal/editor"
 	"github.com/3c7/aen/internal/utils"
 )
 
@@ -21,20 +27,44 @@ Write age encrypted text snippets ("notes") into a Bolt database.
 Subcommands:
   help        (?)   (-b|--brief)
 
-  add         (a)   (-d|--db) <DB path> (-t|--title) <title> (-f|--file) <file path>
-  attach      (at)  (-d|--db) <DB path> (-f|--file) <file path> (-n|--name) <file name>
-  create      (cr)  (-d|--db) <DB path> (-S|--shred)
+  add         (a)   (-d|--db) <DB path> (-t|--title) <title> (-f|--file) <file path|->
+  agent             (-k|--key) <key path> (-s|--socket) <socket path> (-t|--timeout) <duration> --stop
+  append      (ap)  (-d|--db) <DB path> (-k|--key) <key path> (-s|--slug) <slug> (-i|--id) <id>
+                    (-m|--message) <text> (-T|--timestamp) (-c|--create)
+  attach      (at)  (-d|--db) <DB path> (-f|--file) <file path|-> (-n|--name) <file name>
+  backup      (bk)  (-d|--db) <DB path> --to <backup dir> (-n|--keep) <count>
+  backup verify     --to <backup dir> (-f|--file) <backup file>
+  bundle create     (-d|--db) <DB path> (-k|--key) <key path> (-o|--output) <bundle file> --since <marker>
+  bundle apply      (-d|--db) <DB path> (-f|--file) <bundle file> --trust <source key> --force
+  create      (cr)  (-d|--db) <DB path> (-k|--key) <key path> (-t|--template) <name>
   edit        (ed)  (-d|--db) <DB path> (-k|--key) <key path>
-                    (-s|--slug) <slug> (-i|--id) <id> (-S|--shred) (-c|--create)
+                    (-s|--slug) <slug> (-i|--id) <id> (-c|--create)
+  export      (ex)  (-d|--db) <DB path> --dir <output dir>
+  fsck              (-d|--db) <DB path> (-k|--key) <key path> (-r|--repair)
   get         (g)   (-d|--db) <DB path> (-k|--key) <key path>
-                    (-s|--slug) <slug> (-i|--id) <id> (-r|--raw)
+                    (-s|--slug) <slug> (-i|--id) <id> (-r|--raw) (-o|--output) <file path|->
+                    (-a|--attachment) <file name> --outdir <dir> --force
+  import      (im)  (-d|--db) <DB path> (-k|--key) <key path> --dir <Markdown dir> (-n|--dry-run)
   init        (in)  (-o|--output) <DB path> (-k|--key) <key path>
-  list        (ls)  (-d|--db) <DB path> (-t|--tag) <search tag> --show-tags
+  journal     (jo)  (-d|--db) <DB path> (-k|--key) <key path> --date <YYYY-MM-DD> --format <layout>
+  journal list      (-d|--db) <DB path> --month <YYYY-MM>
+  list        (ls)  (-d|--db) <DB path> (-t|--tag) <search tag> --show-tags (-a|--all)
+                    (-l|--limit) <count> (-o|--offset) <count> (-p|--page) <page> (-c|--cursor) <token>
+                    --sort <created|modified>
+  merge       (me)  (-d|--db) <DB path> (-f|--from) <other DB path> (-s|--strategy) <strategy>
+  pull              (-d|--db) <DB path> (-r|--remote) <name> --force
+  push              (-d|--db) <DB path> (-r|--remote) <name> --force
   quick       (q)   (-d|--db) <DB path> (-k|--key) <key path>
   recipients  (re)  (-d|--db) <DB path> (-r|--remove) <alias>
+  remote            (-d|--db) <DB path> [add <name> <dir> | remove <name> | list]
   remove      (rm)  (-d|--db) <DB path> (-s|--slug) <slug> (-i|--id) <id>
+  replace           (-d|--db) <DB path> (-s|--slug) <slug> (-i|--id) <id> (-f|--file) <file path|->
+  serve             (-d|--db) <DB path> (-k|--key) <key path> --stdio
+  shell       (sh)  (-d|--db) <DB path> (-k|--key) <key path> --lock-after <duration>
   tag         (t)   (-d|--db) <DB path> (-s|--slug) <slug> (-i|--id) <id>
                     (-a|--add) <tags> (-r|--remove) <tags>
+  template          (-d|--db) <DB path> [add <name> <file path|-> | rm <name> | list]
+  web               (-d|--db) <DB path> (-k|--key) <key path> (-l|--listen) <address> --allow-remote
   write       (wr)  (-d|--db) <DB path> (-t|--title) <title> (-m|--message) <message>
 
 More details via "aen help" or with parameter "--help".
@@ -42,53 +72,164 @@ More details via "aen help" or with parameter "--help".
 
 const help string = `Age Encrypted Notebook $(VERSION)
 
-* DB and keyfile paths can also be given via environment variables AENDB and AENKEY.
-** The default editor can be changed through setting the environment variable AENEDITOR.
+* DB and keyfile paths can also be given via environment variables AENDB and AENKEY. If AENAGENT is set,
+  notes are decrypted by the agent listening on this socket instead of reading the keyfile.
+** The editor is taken from AENEDITOR, "editor = <command>" in $XDG_CONFIG_HOME/aen/config, VISUAL or
+   EDITOR, otherwise the first installed of codium, code, nvim, vim, nano and vi is used. Commands are split
+   like in a shell, so paths can be quoted, and {} is replaced by the file path. File notes are edited
+   with the handler configured for their extension in AENHANDLERS, e.g. "pdf=xournalpp;png=gimp -n",
+   or with the editor if they contain text. The plaintext is written to a
+   private directory in $XDG_RUNTIME_DIR or /dev/shm, which is shredded afterwards, also on errors and
+   interrupts. A warning is shown if no RAM backed file system is available.
+*** The DB path can select the storage backend: "dir:///path" stores every note in its own file below
+    the directory. Plain paths and "bolt:///path" use a bolt database, which is required by backup, fsck
+    and merge.
+
+Exit codes: 1 general error, 2 note not found, 3 index out of range, 4 no recipients,
+            5 decryption failed, 6 database is read-only
 
 Usage:
 
 aen add (a)            Adds a file to the database
   -d, --db             - Path to database
   -t, --title          - Title for the note, default is the filename
-  -f, --file           - Path to the file which should be added to the DB
+  -f, --file           - Path to the file which should be added to the DB, "-" reads from stdin,
+                         the path can also be given as argument, files are limited to 64 MiB
+
+aen agent              Keeps the private key in memory and decrypts file keys for other aen commands via a
+                       Unix socket, similar to ssh-agent. Prints the AENAGENT variable which must be exported.
+  -k, --key            - Path to age keyfile *
+  -s, --socket         - Path to the socket, default is aen-<uid>/agent.sock in the temp directory
+  -t, --timeout        - Stop after being idle for this duration (e.g. 30m), default is 1h, 0 disables it
+  --stop               - Stop the running agent
+
+aen append (ap)        Appends a line to a text note, e.g. for logging from scripts
+  -d, --db             - Path to DB *
+  -k, --key            - Path to age keyfile *
+  -s, --slug           - Slug of note
+  -i, --id             - ID of note
+  -m, --message        - Text to append, read from stdin if not given (required in the shell)
+  -T, --timestamp      - Prefix every line of the text with the current time
+  -c, --create         - Create note with the given slug if not available
 
 aen attach (at)        Attach a file to a note
   -d, --db             - Path to database
-  -f, --file           - Path to file
-  -n, --name           - Optional new filename
+  -f, --file           - Path to file, "-" reads from stdin, the path can also be given as argument,
+                         files are limited to 64 MiB
+  -n, --name           - Optional new filename, required when reading from stdin
   -i, --id             - ID of the note to attach file to (see "aen list")
 
-aen create (cr)        Creates a new note with an editor using the first line of the created
-                       note as title
-                       By default the command calls 'codium -w' **
+aen backup (bk)        Writes a consistent snapshot of the database to a backup directory, even while
+                       the database is in use. The SHA-256 hashes are recorded in manifest.json.
+  -d, --db             - Path to DB *
+  --to                 - Path to backup directory
+  -n, --keep           - Number of backups to keep, 0 keeps all (default: 5)
+
+aen backup verify      Checks that backups can be opened, all records can be parsed and their
+                       hashes match the manifest
+  --to                 - Path to backup directory, all backups in the manifest are checked
+  -f, --file           - Path to a single backup file
+
+aen bundle create      Writes a signed bundle containing only the notes changed since a marker, e.g. for
+                       one-way transfers. Every bundle creates a new marker in the database.
   -d, --db             - Path to DB *
-  -S, --shred          - Overwrites temporary file with random data
+  -k, --key            - Path to age keyfile *, used to derive the signing key
+  -o, --output         - Path to bundle file
+  --since              - Marker to start from, 0 includes all notes (default: latest marker)
 
-aen edit (ed)          Edits a note given by slug or id
-                       By default the command calls 'codium -w' **
+aen bundle apply       Checks the signature and sequence of a bundle and applies its changes. Bundles must
+                       be applied in order and are only accepted from trusted sources.
+  -d, --db             - Path to DB *
+  -f, --file           - Path to bundle file
+  --trust              - Trust the given source key, as printed by "aen bundle create", once the
+                         bundle signed with it was applied
+  --force              - Apply a bundle again, even if it was already applied
+
+aen create (cr)        Creates a new note with an editor. Title, tags and custom fields are set in
+                       the front matter block at the beginning of the file, they are stored unencrypted
+                       The file is opened with the configured editor **
+  -d, --db             - Path to DB *
+  -k, --key            - Path to age keyfile *, only needed with --template
+  -t, --template       - Prefill the note with the template of this name, see "aen template"
+
+aen edit (ed)          Edits a note given by slug or id, file notes are opened with their handler.
+                       Title, tags, creation time and custom fields can be changed in the front matter,
+                       they are stored unencrypted.
+                       The file is opened with the configured editor **
   -d, --db             - Path to DB *
   -k, --key            - Path to age keyfile *
   -s, --slug           - Slug of note to get
   -i, --id             - ID of note to get
-  -S, --shred          - Overwrites temporary file with random data
   -c, --create         - Create note if not available
 
+aen export (ex)        Exports all notes as age encrypted files which can be decrypted without aen,
+                       e.g. with "age -d -i <key path> <file>". Text notes are written to
+                       <slug>.md.age, file notes to <slug>.age and attachments to
+                       <slug>/<filename>.age. The metadata is written to the plaintext index.json.
+  -d, --db             - Path to DB *
+  --dir                - Path to output directory
+
+aen fsck               Checks all records of the database: unparsable records, notes stored under the
+                       wrong slug, empty ciphertexts, duplicate UUIDs and invalid recipients are reported.
+                       Exits with 1 if problems remain which are not repaired.
+  -d, --db             - Path to DB *
+  -k, --key            - Path to age keyfile *, if given notes and attachments are decrypted and
+                         the hashes of attachments are verified, notes encrypted to other recipients
+                         are listed for information only
+  -r, --repair         - Move broken records to the quarantine bucket, remove broken attachments and
+                         move notes stored under the wrong slug to the correct one
+
 aen get (g)            Get and decrypt a note by its slug or id
   -d, --db             - Path to DB *
   -k, --key            - Path to age keyfile *
   -s, --slug           - Slug of note to get
   -i, --id             - ID of note to get
   -r, --raw            - Only print note content without any metadata
+  -o, --output         - Path the file note or attachment is written to, "-" writes to stdout
+                         (default: the filename, reduced to a safe basename)
+  -a, --attachment     - Filename of the attachment to get instead of the note
+  --outdir             - Directory the file is written to (default: current directory)
+  --force              - Overwrite an existing file, files are replaced atomically
+
+aen import (im)        Imports a directory of Markdown files. The first heading (or the filename) is used
+                       as title, folders and front matter "tags:" are used as tags and the modification
+                       time of the file as creation time. Linked non-Markdown files are attached.
+                       Files already imported (same title and content) are skipped.
+  -d, --db             - Path to DB *
+  -k, --key            - Path to age keyfile *, required for detecting already imported notes
+  --dir                - Path to directory containing the Markdown files
+  -n, --dry-run        - Only print what would be imported
 
 aen init (in)          Initializes the private key and the database if not already given
                        and adds the own public key to the database
   -o, --output         - Path to DB *
   -k, --key            - Path to age keyfile *
 
-aen list (ls)          Lists the slugs of available notes sorted by their timestamp
+aen journal (jo)       Opens the journal entry of a day with the editor **, it is created if not available.
+                       Entries are tagged "journal" and keep their day in the custom field "date".
+  -d, --db             - Path to DB *
+  -k, --key            - Path to age keyfile *
+  --date               - Day of the entry as YYYY-MM-DD (default: today)
+  --format             - Title format of new entries as Go time layout, can also be set through
+                         AENJOURNAL (default: "Journal 2006-01-02")
+
+aen journal list       Lists the journal entries, newest first
+  -d, --db             - Path to DB *
+  --month              - Only list entries of this month as YYYY-MM
+
+aen list (ls)          Lists the slugs of available notes, newest first. The ID of a note is its position
+                       sorted by creation time, regardless of the sorting and filtering.
   -d, --db             - Path to DB *
   -t, --tag            - Only display notes with given tag
   --show-tags          - Display tags
+  -a, --all            - Display all notes instead of a single page
+  -l, --limit          - Number of notes per page (default: 10)
+  -o, --offset         - Number of notes to skip
+  -p, --page           - Page to display, starting at 1
+  -c, --cursor         - Continue after the page the cursor token was printed for
+                         Unlike offsets, cursors are not shifted by notes added in the meantime,
+                         it cannot be combined with --offset or --page
+  --sort               - Sort by "created" (default) or "modified" time
 
                        The following flags are used:
 
@@ -96,7 +237,31 @@ aen list (ls)          Lists the slugs of available notes sorted by their timest
 					   T - Tags
 					   A - Attachments
 
-aen quick (q)          Opens the quick note (slug "quicknote"), shreds file on disk per default.
+aen merge (me)         Merges notes and recipients of another database, e.g. after carrying a copy to an
+                       airgapped system. Notes are matched by their UUID, missing notes are copied and
+                       notes changed only in the other database since the last merge from it replace
+                       the local ones, even if it is mounted at a different path.
+  -d, --db             - Path to DB *
+  -f, --from           - Path to the other database, which is opened read-only
+  -s, --strategy       - How to handle notes changed on both sides:
+                         keep-both - keep the local note and add the other as conflict copy (default)
+                         newest    - keep the note modified last
+                         ours      - keep the local note
+                         theirs    - take the note of the other database
+
+aen pull               Applies notes changed in a remote since the last sync. Notes changed locally as well
+                       are reported as conflicts and skipped.
+  -d, --db             - Path to DB *
+  -r, --remote         - Name of the remote, can be omitted if only one remote is configured
+  --force              - Overwrite local notes even if they were changed
+
+aen push               Writes notes changed since the last sync to a remote, one file per note. Notes
+                       changed in the remote as well are reported as conflicts and skipped.
+  -d, --db             - Path to DB *
+  -r, --remote         - Name of the remote, can be omitted if only one remote is configured
+  --force              - Overwrite notes in the remote even if they were changed
+
+aen quick (q)          Opens the quick note (slug "quicknote")
   -d, --db             - Path to DB *
   -k, --key            - Path to age keyfile *
 
@@ -104,6 +269,13 @@ aen recipients (re)    Lists all recipients and their aliases
   -d, --db             - Path to DB *
   -r, --remove         - Remove recipient identified by its alias
 
+aen remote             Manages remotes, directories (e.g. git working trees) containing the encrypted notes
+                       as one file per UUID in notes/<uuid>.json and the recipients in recipients.json
+  -d, --db             - Path to DB *
+  add <name> <dir>     - Adds a remote
+  remove <name>        - Removes a remote, the directory is kept
+  list                 - Lists all remotes (default)
+
 aen remove (rm)        Removes note by its slug or id from the database
                        NOTE: While the note is not retrievable through aen anymore,
                        the data reside in the database file until its overwritten by a new note.
@@ -111,6 +283,30 @@ aen remove (rm)        Removes note by its slug or id from the database
   -s, --slug           - Slug of note to get
   -i, --id             - ID of note to get
 
+aen replace            Replaces the content of a note by the content of a file, the UUID, title, tags and
+                       attachments are kept
+  -d, --db             - Path to DB *
+  -s, --slug           - Slug of note
+  -i, --id             - ID of note
+  -f, --file           - Path to the file containing the new content, "-" reads from stdin
+
+aen serve              Keeps the DB open and answers JSON-RPC 2.0 requests, one message per line, for editor
+                       integrations. Methods: list, get, save, tag, attach, search and delete. After a note
+                       changed, a "noteChanged" notification is sent.
+  -d, --db             - Path to DB *
+  -k, --key            - Path to age keyfile *
+  --stdio              - Read requests from stdin and write responses to stdout
+
+aen shell (sh)         Starts an interactive shell keeping the DB open and the private key loaded. IDs are
+                       session numbers which don't change while the shell runs. Tab completes commands,
+                       slugs and tags. Other subcommands are run as separate process.
+  -d, --db             - Path to DB *
+  -k, --key            - Path to age keyfile *
+  --lock-after         - Drop the private key after being idle for this duration, default is 10m,
+                         0 disables it. The key is only loaded again by the "unlock" command and is not
+                         passed to other subcommands while locked. The key material stays in memory
+                         until it is garbage collected, as Go cannot wipe it.
+
 aen tag (t)            Adds and removes Tags
   -d, --db             - Path to DB *
   -i, --id             - ID of note
@@ -118,6 +314,23 @@ aen tag (t)            Adds and removes Tags
   -a, --add            - Comma separated list of tags to add
   -r, --remove         - Comma separated list of tags to remove
 
+aen template           Manages templates for "aen create --template", which are notes tagged "template".
+                       Before the editor opens, {{date}}, {{time}}, {{datetime}} and {{uuid}} are replaced,
+                       {{prompt:<label>}} asks for a value, e.g. {{prompt:Case ID}}.
+  -d, --db             - Path to DB *
+  add <name> [file]    - Adds a template read from the file, "-" reads from stdin. Without file,
+                         the template is written with the editor **
+  -f, --file           - Path to the template file, can also be given after the name
+  rm <name>            - Removes a template
+  list                 - Lists all templates (default)
+
+aen web                Serves a REST API below /api/ and a web UI for browsing, searching and editing notes.
+                       Requests must contain the token printed at startup.
+  -d, --db             - Path to DB *
+  -k, --key            - Path to age keyfile *
+  -l, --listen         - Address to listen on, default is 127.0.0.1:8080
+  --allow-remote       - Allow listening on other interfaces than loopback
+
 aen write (wr)         Writes a new note
   -d, --db             - Path to DB *
   -t, --title          - Title of the note
@@ -149,10 +362,17 @@ func main() {
 	var (
 		pathFlag, keyFlag, titleFlag, messageFlag, slugFlag, aliasFlag, fileFlag string
 		tagAddFlag, tagRemoveFlag, tagFlag                                       string
-		pathEnv, keyEnv, editorEnv                                               string
-		editorCmd                                                                []string
+		pathEnv, keyEnv, agentEnv, handlerEnv, journalEnv                        string
 		idFlag                                                                   uint
+		limitFlag, offsetFlag, pageFlag, keepFlag                                int
+		cursorFlag, dirFlag, fromFlag, strategyFlag, listenFlag, socketFlag      string
 		briefFlag, shredFlag, rawFlag, showTagsFlag, createFlag, allFlag         bool
+		repairFlag, dryRunFlag, forceFlag, stdioFlag, allowRemoteFlag, stopFlag  bool
+		timeoutFlag                                                              time.Duration
+		sinceFlag                                                                int
+		timestampFlag                                                            bool
+		trustFlag, remoteFlag, attachmentFlag, sortFlag, templateFlag            string
+		dateFlag, formatFlag, monthFlag                                          string
 	)
 
 	AddCmd := flag.NewFlagSet("add", flag.ExitOnError)
@@ -163,6 +383,31 @@ func main() {
 	AddCmd.StringVar(&titleFlag, "title", "", "Title of the note (default: filename)")
 	AddCmd.StringVar(&titleFlag, "t", "", "Title of the note (default: filename)")
 
+	AgentCmd := flag.NewFlagSet("agent", flag.ExitOnError)
+	AgentCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	AgentCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	AgentCmd.StringVar(&socketFlag, "socket", "", "Path to the socket")
+	AgentCmd.StringVar(&socketFlag, "s", "", "Path to the socket")
+	AgentCmd.DurationVar(&timeoutFlag, "timeout", time.Hour, "Stop after being idle for this duration, 0 disables the timeout")
+	AgentCmd.DurationVar(&timeoutFlag, "t", time.Hour, "Stop after being idle for this duration, 0 disables the timeout")
+	AgentCmd.BoolVar(&stopFlag, "stop", false, "Stop the running agent")
+
+	AppendCmd := flag.NewFlagSet("append", flag.ExitOnError)
+	AppendCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	AppendCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	AppendCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	AppendCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	AppendCmd.StringVar(&slugFlag, "slug", "", "Slug for note")
+	AppendCmd.StringVar(&slugFlag, "s", "", "Slug for note")
+	AppendCmd.UintVar(&idFlag, "id", 0, "ID for note")
+	AppendCmd.UintVar(&idFlag, "i", 0, "ID for note")
+	AppendCmd.StringVar(&messageFlag, "message", "", "Text to append, read from stdin if not given")
+	AppendCmd.StringVar(&messageFlag, "m", "", "Text to append, read from stdin if not given")
+	AppendCmd.BoolVar(&timestampFlag, "timestamp", false, "Prefix every line of the text with the current time")
+	AppendCmd.BoolVar(&timestampFlag, "T", false, "Prefix every line of the text with the current time")
+	AppendCmd.BoolVar(&createFlag, "create", false, "Create note if not available")
+	AppendCmd.BoolVar(&createFlag, "c", false, "Create note if not available")
+
 	AttachCmd := flag.NewFlagSet("attach", flag.ExitOnError)
 	AttachCmd.StringVar(&pathFlag, "db", "", "Path to database")
 	AttachCmd.StringVar(&pathFlag, "d", "", "Path to database")
@@ -175,11 +420,44 @@ func main() {
 	AttachCmd.UintVar(&idFlag, "id", 0, "ID for note")
 	AttachCmd.UintVar(&idFlag, "i", 0, "ID for note")
 
+	BackupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	BackupCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	BackupCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	BackupCmd.StringVar(&dirFlag, "to", "", "Path to backup directory")
+	BackupCmd.IntVar(&keepFlag, "keep", 5, "Number of backups to keep")
+	BackupCmd.IntVar(&keepFlag, "n", 5, "Number of backups to keep")
+
+	BackupVerifyCmd := flag.NewFlagSet("backup verify", flag.ExitOnError)
+	BackupVerifyCmd.StringVar(&dirFlag, "to", "", "Path to backup directory")
+	BackupVerifyCmd.StringVar(&fileFlag, "file", "", "Path to backup file")
+	BackupVerifyCmd.StringVar(&fileFlag, "f", "", "Path to backup file")
+
+	BundleCreateCmd := flag.NewFlagSet("bundle create", flag.ExitOnError)
+	BundleCreateCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	BundleCreateCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	BundleCreateCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	BundleCreateCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	BundleCreateCmd.StringVar(&fileFlag, "output", "", "Path to bundle file")
+	BundleCreateCmd.StringVar(&fileFlag, "o", "", "Path to bundle file")
+	BundleCreateCmd.IntVar(&sinceFlag, "since", -1, "Marker to start from (default: latest marker)")
+
+	BundleApplyCmd := flag.NewFlagSet("bundle apply", flag.ExitOnError)
+	BundleApplyCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	BundleApplyCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	BundleApplyCmd.StringVar(&fileFlag, "file", "", "Path to bundle file")
+	BundleApplyCmd.StringVar(&fileFlag, "f", "", "Path to bundle file")
+	BundleApplyCmd.StringVar(&trustFlag, "trust", "", "Source key to trust")
+	BundleApplyCmd.BoolVar(&forceFlag, "force", false, "Apply bundle even if already applied")
+
 	CreateCmd := flag.NewFlagSet("create", flag.ExitOnError)
 	CreateCmd.StringVar(&pathFlag, "db", "", "Path to database")
 	CreateCmd.StringVar(&pathFlag, "d", "", "Path to database")
-	CreateCmd.BoolVar(&shredFlag, "shred", false, "Shred file contents afterwards")
-	CreateCmd.BoolVar(&shredFlag, "S", false, "Shred file contents afterwards")
+	CreateCmd.BoolVar(&shredFlag, "shred", false, "Ignored, temporary files are always shredded")
+	CreateCmd.BoolVar(&shredFlag, "S", false, "Ignored, temporary files are always shredded")
+	CreateCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	CreateCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	CreateCmd.StringVar(&templateFlag, "template", "", "Name of the template to start with")
+	CreateCmd.StringVar(&templateFlag, "t", "", "Name of the template to start with")
 
 	EditCmd := flag.NewFlagSet("edit", flag.ExitOnError)
 	EditCmd.StringVar(&pathFlag, "db", "", "Path to database")
@@ -190,11 +468,24 @@ func main() {
 	EditCmd.StringVar(&slugFlag, "s", "", "Slug for note")
 	EditCmd.UintVar(&idFlag, "id", 0, "ID for note")
 	EditCmd.UintVar(&idFlag, "i", 0, "ID for note")
-	EditCmd.BoolVar(&shredFlag, "shred", false, "Shred file contents afterwards")
-	EditCmd.BoolVar(&shredFlag, "S", false, "Shred file contents afterwards")
+	EditCmd.BoolVar(&shredFlag, "shred", false, "Ignored, temporary files are always shredded")
+	EditCmd.BoolVar(&shredFlag, "S", false, "Ignored, temporary files are always shredded")
 	EditCmd.BoolVar(&createFlag, "create", false, "Create note if not available")
 	EditCmd.BoolVar(&createFlag, "c", false, "Create note if not available")
 
+	ExportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+	ExportCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	ExportCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	ExportCmd.StringVar(&dirFlag, "dir", "", "Path to output directory")
+
+	FsckCmd := flag.NewFlagSet("fsck", flag.ExitOnError)
+	FsckCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	FsckCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	FsckCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	FsckCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	FsckCmd.BoolVar(&repairFlag, "repair", false, "Move broken records to quarantine")
+	FsckCmd.BoolVar(&repairFlag, "r", false, "Move broken records to quarantine")
+
 	GetCmd := flag.NewFlagSet("get", flag.ExitOnError)
 	GetCmd.StringVar(&pathFlag, "db", "", "Path to database")
 	GetCmd.StringVar(&pathFlag, "d", "", "Path to database")
@@ -208,11 +499,24 @@ func main() {
 	GetCmd.BoolVar(&rawFlag, "r", false, "Only print note content")
 	GetCmd.StringVar(&fileFlag, "output", "", "Path to output file")
 	GetCmd.StringVar(&fileFlag, "o", "", "Path to output file")
+	GetCmd.StringVar(&attachmentFlag, "attachment", "", "Filename of attachment to get")
+	GetCmd.StringVar(&attachmentFlag, "a", "", "Filename of attachment to get")
+	GetCmd.StringVar(&dirFlag, "outdir", "", "Directory files are written to")
+	GetCmd.BoolVar(&forceFlag, "force", false, "Overwrite existing files")
 
 	HelpCmd := flag.NewFlagSet("help", flag.ExitOnError)
 	HelpCmd.BoolVar(&briefFlag, "brief", false, "Shows only brief usage information.")
 	HelpCmd.BoolVar(&briefFlag, "b", false, "Shows only brief usage information.")
 
+	ImportCmd := flag.NewFlagSet("import", flag.ExitOnError)
+	ImportCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	ImportCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	ImportCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	ImportCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	ImportCmd.StringVar(&dirFlag, "dir", "", "Path to directory containing Markdown files")
+	ImportCmd.BoolVar(&dryRunFlag, "dry-run", false, "Only print what would be imported")
+	ImportCmd.BoolVar(&dryRunFlag, "n", false, "Only print what would be imported")
+
 	InitCmd := flag.NewFlagSet("init", flag.ExitOnError)
 	InitCmd.StringVar(&pathFlag, "output", "", "Filepath to database file which will be created, if not already available.")
 	InitCmd.StringVar(&pathFlag, "o", "", "Filepath to database file which will be created, if not already available.")
@@ -226,9 +530,26 @@ func main() {
 	ListCmd.StringVar(&pathFlag, "d", "", "Path to database")
 	ListCmd.StringVar(&tagFlag, "tag", "", "Tag to filter for")
 	ListCmd.StringVar(&tagFlag, "t", "", "Tag to filter for")
-	ListCmd.BoolVar(&allFlag, "all", false, "Tag to filter for")
-	ListCmd.BoolVar(&allFlag, "a", false, "Tag to filter for")
+	ListCmd.BoolVar(&allFlag, "all", false, "Display all notes")
+	ListCmd.BoolVar(&allFlag, "a", false, "Display all notes")
 	ListCmd.BoolVar(&showTagsFlag, "show-tags", false, "Display tags")
+	ListCmd.IntVar(&limitFlag, "limit", 10, "Number of notes per page")
+	ListCmd.IntVar(&limitFlag, "l", 10, "Number of notes per page")
+	ListCmd.IntVar(&offsetFlag, "offset", 0, "Number of notes to skip")
+	ListCmd.IntVar(&offsetFlag, "o", 0, "Number of notes to skip")
+	ListCmd.IntVar(&pageFlag, "page", 0, "Page to display")
+	ListCmd.IntVar(&pageFlag, "p", 0, "Page to display")
+	ListCmd.StringVar(&cursorFlag, "cursor", "", "Cursor token of the previous page")
+	ListCmd.StringVar(&cursorFlag, "c", "", "Cursor token of the previous page")
+	ListCmd.StringVar(&sortFlag, "sort", "created", "Time to sort by, created or modified")
+
+	MergeCmd := flag.NewFlagSet("merge", flag.ExitOnError)
+	MergeCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	MergeCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	MergeCmd.StringVar(&fromFlag, "from", "", "Path to other database")
+	MergeCmd.StringVar(&fromFlag, "f", "", "Path to other database")
+	MergeCmd.StringVar(&strategyFlag, "strategy", "keep-both", "Strategy for notes changed on both sides")
+	MergeCmd.StringVar(&strategyFlag, "s", "keep-both", "Strategy for notes changed on both sides")
 
 	RecipientsCmd := flag.NewFlagSet("recipients", flag.ExitOnError)
 	RecipientsCmd.StringVar(&pathFlag, "db", "", "Path to database")
@@ -236,6 +557,42 @@ func main() {
 	RecipientsCmd.StringVar(&aliasFlag, "remove", "", "Remove recipient with this alias")
 	RecipientsCmd.StringVar(&aliasFlag, "r", "", "Remove recipient with this alias")
 
+	RemoteCmd := flag.NewFlagSet("remote", flag.ExitOnError)
+	RemoteCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	RemoteCmd.StringVar(&pathFlag, "d", "", "Path to database")
+
+	JournalCmd := flag.NewFlagSet("journal", flag.ExitOnError)
+	JournalCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	JournalCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	JournalCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	JournalCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	JournalCmd.StringVar(&dateFlag, "date", "", "Day of the entry as YYYY-MM-DD (default: today)")
+	JournalCmd.StringVar(&formatFlag, "format", "", "Title format of new entries as Go time layout")
+	JournalCmd.StringVar(&monthFlag, "month", "", "Only list entries of this month as YYYY-MM")
+
+	TemplateCmd := flag.NewFlagSet("template", flag.ExitOnError)
+	TemplateCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	TemplateCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	TemplateCmd.StringVar(&fileFlag, "file", "", "Path to template file, \"-\" reads from stdin")
+	TemplateCmd.StringVar(&fileFlag, "f", "", "Path to template file, \"-\" reads from stdin")
+
+	SyncCmd := flag.NewFlagSet("push/pull", flag.ExitOnError)
+	SyncCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	SyncCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	SyncCmd.StringVar(&remoteFlag, "remote", "", "Name of the remote")
+	SyncCmd.StringVar(&remoteFlag, "r", "", "Name of the remote")
+	SyncCmd.BoolVar(&forceFlag, "force", false, "Overwrite notes changed on both sides")
+
+	ReplaceCmd := flag.NewFlagSet("replace", flag.ExitOnError)
+	ReplaceCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	ReplaceCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	ReplaceCmd.StringVar(&slugFlag, "slug", "", "Slug for note")
+	ReplaceCmd.StringVar(&slugFlag, "s", "", "Slug for note")
+	ReplaceCmd.UintVar(&idFlag, "id", 0, "ID for note")
+	ReplaceCmd.UintVar(&idFlag, "i", 0, "ID for note")
+	ReplaceCmd.StringVar(&fileFlag, "file", "", "Path to file containing the new content")
+	ReplaceCmd.StringVar(&fileFlag, "f", "", "Path to file containing the new content")
+
 	RmCmd := flag.NewFlagSet("remove", flag.ExitOnError)
 	RmCmd.StringVar(&pathFlag, "db", "", "Path to database")
 	RmCmd.StringVar(&pathFlag, "d", "", "Path to database")
@@ -246,6 +603,20 @@ func main() {
 	RmCmd.UintVar(&idFlag, "id", 0, "ID for note")
 	RmCmd.UintVar(&idFlag, "i", 0, "ID for note")
 
+	ServeCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	ServeCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	ServeCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	ServeCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	ServeCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	ServeCmd.BoolVar(&stdioFlag, "stdio", false, "Use stdin and stdout for communication")
+
+	ShellCmd := flag.NewFlagSet("shell", flag.ExitOnError)
+	ShellCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	ShellCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	ShellCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	ShellCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	ShellCmd.DurationVar(&timeoutFlag, "lock-after", 10*time.Minute, "Drop the private key after being idle for this duration, 0 disables it")
+
 	TagCmd := flag.NewFlagSet("tag", flag.ExitOnError)
 	TagCmd.StringVar(&pathFlag, "db", "", "Path to database")
 	TagCmd.StringVar(&pathFlag, "d", "", "Path to database")
@@ -258,6 +629,15 @@ func main() {
 	TagCmd.UintVar(&idFlag, "id", 0, "ID for note")
 	TagCmd.UintVar(&idFlag, "i", 0, "ID for note")
 
+	WebCmd := flag.NewFlagSet("web", flag.ExitOnError)
+	WebCmd.StringVar(&pathFlag, "db", "", "Path to database")
+	WebCmd.StringVar(&pathFlag, "d", "", "Path to database")
+	WebCmd.StringVar(&keyFlag, "key", "", "Path to keyfile")
+	WebCmd.StringVar(&keyFlag, "k", "", "Path to keyfile")
+	WebCmd.StringVar(&listenFlag, "listen", "127.0.0.1:8080", "Address to listen on")
+	WebCmd.StringVar(&listenFlag, "l", "127.0.0.1:8080", "Address to listen on")
+	WebCmd.BoolVar(&allowRemoteFlag, "allow-remote", false, "Allow listening on other interfaces than loopback")
+
 	WriteCmd := flag.NewFlagSet("write", flag.ExitOnError)
 	WriteCmd.StringVar(&pathFlag, "db", "", "Path to database")
 	WriteCmd.StringVar(&pathFlag, "d", "", "Path to database")
@@ -268,13 +648,11 @@ func main() {
 
 	pathEnv = os.Getenv("AENDB")
 	keyEnv = os.Getenv("AENKEY")
-	editorEnv = os.Getenv("AENEDITOR")
+	handlerEnv = os.Getenv("AENHANDLERS")
+	journalEnv = os.Getenv("AENJOURNAL")
+	agentEnv = os.Getenv(agent.SocketEnv)
 
-	if len(editorEnv) > 0 {
-		editorCmd = strings.Split(editorEnv, " ")
-	} else {
-		editorCmd = strings.Split("codium -w", " ")
-	}
+	editorCmd, editorErr := editor.Resolve(editor.SystemEnv())
 
 	switch os.Args[1] {
 	case "help", "he", "?":
@@ -302,7 +680,13 @@ func main() {
 		if err != nil {
 			log.Fatalf("Error listing notes: %v", err)
 		}
-		listNotes(path, tagFlag, showTagsFlag, allFlag)
+		pageOpts, err := pageOptions(limitFlag, offsetFlag, pageFlag, cursorFlag, sortFlag, allFlag)
+		if err != nil {
+			log.Fatalf("Error listing notes: %v", err)
+		}
+		runNotebook(path, "", "Error listing notes", func(ctx context.Context, nb *aen.Notebook) error {
+			return listNotes(ctx, nb, tagFlag, showTagsFlag, pageOpts, nil)
+		})
 
 	case "write", "wr":
 		WriteCmd.Parse(os.Args[2:])
@@ -331,44 +715,76 @@ func main() {
 		if len(messageFlag) == 0 {
 			log.Fatal("Error writing note: message must be given.")
 		}
-		writeNote(path, titleFlag, messageFlag)
+		runNotebook(path, "", "Error writing note", func(ctx context.Context, nb *aen.Notebook) error {
+			return writeNote(ctx, nb, titleFlag, messageFlag)
+		})
 
 	case "get", "g":
 		GetCmd.Parse(os.Args[2:])
-		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, true)
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, agentEnv == "")
 		if err != nil {
 			log.Fatalf("Error getting note: %v", err)
 		}
-		if len(slugFlag) == 0 && idFlag == 0 {
-			log.Fatal("Error getting note: ID or Slug must be given.")
+		ref, err := noteRef(slugFlag, idFlag)
+		if err != nil {
+			log.Fatalf("Error getting note: %v", err)
 		}
-		getNote(path, key, slugFlag, fileFlag, idFlag, rawFlag)
+		runNotebook(path, key, "Error getting note", func(ctx context.Context, nb *aen.Notebook) error {
+			return getNote(ctx, nb, ref, fileFlag, dirFlag, attachmentFlag, rawFlag, forceFlag)
+		})
 
 	case "create", "cr":
 		CreateCmd.Parse(os.Args[2:])
-		path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
+		// The key is only needed for decrypting the template
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, templateFlag != "" && agentEnv == "")
 		if err != nil {
 			log.Fatalf("Error creating note: %v", err)
 		}
-		createNote(path, editorCmd, shredFlag)
+		if templateFlag == "" {
+			key = ""
+		}
+		if editorErr != nil {
+			log.Fatalf("Error creating note: %v", editorErr)
+		}
+		runNotebook(path, key, "Error creating note", func(ctx context.Context, nb *aen.Notebook) error {
+			return createNote(ctx, nb, bufio.NewReader(os.Stdin), editorCmd, templateFlag)
+		})
 
 	case "edit", "ed":
 		EditCmd.Parse(os.Args[2:])
-		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, true)
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, agentEnv == "")
 		if err != nil {
 			log.Fatalf("Error editing note: %v", err)
 		}
-		editNote(path, key, slugFlag, idFlag, editorCmd, shredFlag, createFlag)
+		ref, err := noteRef(slugFlag, idFlag)
+		if err != nil {
+			log.Fatalf("Error editing note: %v", err)
+		}
+		handlers, err := parseHandlers(handlerEnv)
+		if err != nil {
+			log.Fatalf("Error editing note: %v", err)
+		}
+		if editorErr != nil {
+			log.Fatalf("Error editing note: %v", editorErr)
+		}
+		runNotebook(path, key, "Error editing note", func(ctx context.Context, nb *aen.Notebook) error {
+			return editNote(ctx, nb, ref, bufio.NewReader(os.Stdin), editorCmd, handlers, createFlag)
+		})
 
 	// Opening a quicknote does basically the same as the edit command with the slug set to quicknote.
 	// This is only helpful if the params have been set via ENVs, otherwise this doesn't bring more convenience to the user.
 	case "quick", "q":
 		EditCmd.Parse(os.Args[2:])
-		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, true)
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, agentEnv == "")
 		if err != nil {
 			log.Fatalf("Error editing note: %v", err)
 		}
-		editNote(path, key, "quicknote", idFlag, editorCmd, true, true)
+		if editorErr != nil {
+			log.Fatalf("Error editing note: %v", editorErr)
+		}
+		runNotebook(path, key, "Error editing note", func(ctx context.Context, nb *aen.Notebook) error {
+			return editNote(ctx, nb, aen.BySlug("quicknote"), bufio.NewReader(os.Stdin), editorCmd, nil, true)
+		})
 
 	case "remove", "del", "rm":
 		RmCmd.Parse(os.Args[2:])
@@ -376,7 +792,27 @@ func main() {
 		if err != nil {
 			log.Fatalf("Error deleting note: %v", err)
 		}
-		deleteNote(path, slugFlag, idFlag)
+		ref, err := noteRef(slugFlag, idFlag)
+		if err != nil {
+			log.Fatalf("Error deleting note: %v", err)
+		}
+		runNotebook(path, "", "Error deleting note", func(ctx context.Context, nb *aen.Notebook) error {
+			return deleteNote(ctx, nb, ref)
+		})
+
+	case "replace":
+		ReplaceCmd.Parse(os.Args[2:])
+		path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
+		if err != nil {
+			log.Fatalf("Error replacing note content: %v", err)
+		}
+		ref, err := noteRef(slugFlag, idFlag)
+		if err != nil {
+			log.Fatalf("Error replacing note content: %v", err)
+		}
+		runNotebook(path, "", "Error replacing note content", func(ctx context.Context, nb *aen.Notebook) error {
+			return replaceContent(ctx, nb, ref, fileFlag)
+		})
 
 	case "version", "ver", "v":
 		log.Printf("Age Encrypted Notebook version: %s", Version)
@@ -387,15 +823,22 @@ func main() {
 		if err != nil {
 			log.Fatalf("Error listing recipients: %v", err)
 		}
-		listRecipients(path, aliasFlag)
+		runNotebook(path, "", "Error listing recipients", func(ctx context.Context, nb *aen.Notebook) error {
+			return listRecipients(ctx, nb, aliasFlag)
+		})
 
 	case "add", "a":
 		AddCmd.Parse(os.Args[2:])
+		if fileFlag == "" {
+			fileFlag = AddCmd.Arg(0)
+		}
 		path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
 		if err != nil {
 			log.Fatalf("Error adding file to database: %v", err)
 		}
-		addFile(path, fileFlag, titleFlag)
+		runNotebook(path, "", "Error adding file to database", func(ctx context.Context, nb *aen.Notebook) error {
+			return addFile(ctx, nb, fileFlag, titleFlag)
+		})
 
 	case "tag", "t":
 		TagCmd.Parse(os.Args[2:])
@@ -403,15 +846,255 @@ func main() {
 		if err != nil {
 			log.Fatalf("Error manipulating tags: %v", err)
 		}
-		manipulateTags(path, idFlag, slugFlag, tagAddFlag, tagRemoveFlag)
+		ref, err := noteRef(slugFlag, idFlag)
+		if err != nil {
+			log.Fatalf("Error manipulating tags: %v", err)
+		}
+		runNotebook(path, "", "Error manipulating tags", func(ctx context.Context, nb *aen.Notebook) error {
+			return manipulateTags(ctx, nb, ref, tagAddFlag, tagRemoveFlag)
+		})
+
+	case "append", "ap":
+		AppendCmd.Parse(os.Args[2:])
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, agentEnv == "")
+		if err != nil {
+			log.Fatalf("Error appending to note: %v", err)
+		}
+		ref, err := noteRef(slugFlag, idFlag)
+		if err != nil {
+			log.Fatalf("Error appending to note: %v", err)
+		}
+		runNotebook(path, key, "Error appending to note", func(ctx context.Context, nb *aen.Notebook) error {
+			return appendNote(ctx, nb, ref, messageFlag, utils.IsPipe(), timestampFlag, createFlag)
+		})
 
 	case "attach", "at":
 		AttachCmd.Parse(os.Args[2:])
-		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, true)
+		if fileFlag == "" {
+			fileFlag = AttachCmd.Arg(0)
+		}
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, agentEnv == "")
 		if err != nil {
 			log.Fatalf("Error attaching file: %v", err)
 		}
-		attachFile(path, key, fileFlag, titleFlag, idFlag)
+		runNotebook(path, key, "Error attaching file", func(ctx context.Context, nb *aen.Notebook) error {
+			if idFlag == 0 {
+				return fmt.Errorf("note index must be given, but was %d", idFlag)
+			}
+			return attachFile(ctx, nb, fileFlag, titleFlag, aen.ByIndex(idFlag))
+		})
+
+	case "backup", "bk":
+		if len(os.Args) > 2 && os.Args[2] == "verify" {
+			BackupVerifyCmd.Parse(os.Args[3:])
+			verifyBackups(dirFlag, fileFlag)
+			break
+		}
+		BackupCmd.Parse(os.Args[2:])
+		path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
+		if err != nil {
+			log.Fatalf("Error creating backup: %v", err)
+		}
+		backupDatabase(path, dirFlag, keepFlag)
+
+	case "fsck":
+		FsckCmd.Parse(os.Args[2:])
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, false)
+		if err != nil {
+			log.Fatalf("Error checking database: %v", err)
+		}
+		checkDatabase(path, key, repairFlag)
+
+	case "export", "ex":
+		ExportCmd.Parse(os.Args[2:])
+		path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
+		if err != nil {
+			log.Fatalf("Error exporting notes: %v", err)
+		}
+		exportNotes(path, dirFlag)
+
+	case "import", "im":
+		ImportCmd.Parse(os.Args[2:])
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, true)
+		if err != nil {
+			log.Fatalf("Error importing notes: %v", err)
+		}
+		importNotes(path, key, dirFlag, dryRunFlag)
+
+	case "merge", "me":
+		MergeCmd.Parse(os.Args[2:])
+		path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
+		if err != nil {
+			log.Fatalf("Error merging databases: %v", err)
+		}
+		mergeDatabase(path, fromFlag, strategyFlag)
+
+	case "bundle":
+		if len(os.Args) < 3 {
+			flag.Usage()
+			log.Fatal("Error: bundle requires the subcommand create or apply.")
+		}
+		switch os.Args[2] {
+		case "create":
+			BundleCreateCmd.Parse(os.Args[3:])
+			path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, true)
+			if err != nil {
+				log.Fatalf("Error creating bundle: %v", err)
+			}
+			createBundle(path, key, fileFlag, sinceFlag)
+		case "apply":
+			BundleApplyCmd.Parse(os.Args[3:])
+			path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
+			if err != nil {
+				log.Fatalf("Error applying bundle: %v", err)
+			}
+			applyBundle(path, fileFlag, trustFlag, forceFlag)
+		default:
+			flag.Usage()
+			log.Fatalf("Bundle subcommand unknown: %s", os.Args[2])
+		}
+
+	case "remote":
+		RemoteCmd.Parse(os.Args[2:])
+		path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
+		if err != nil {
+			log.Fatalf("Error managing remotes: %v", err)
+		}
+		args := RemoteCmd.Args()
+		switch {
+		case len(args) == 0 || args[0] == "list":
+			listRemotes(path)
+		case args[0] == "add" && len(args) == 3:
+			addRemote(path, args[1], args[2])
+		case args[0] == "remove" && len(args) == 2:
+			removeRemote(path, args[1])
+		default:
+			log.Fatal("Error managing remotes: use \"remote add <name> <dir>\", \"remote remove <name>\" or \"remote list\".")
+		}
+
+	case "journal", "jo":
+		listFlag := len(os.Args) > 2 && os.Args[2] == "list"
+		if listFlag {
+			JournalCmd.Parse(os.Args[3:])
+		} else {
+			JournalCmd.Parse(os.Args[2:])
+		}
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, !listFlag && agentEnv == "")
+		if err != nil {
+			log.Fatalf("Error opening journal: %v", err)
+		}
+		if listFlag {
+			runNotebook(path, "", "Error listing journal", func(ctx context.Context, nb *aen.Notebook) error {
+				return listJournal(ctx, nb, monthFlag)
+			})
+			break
+		}
+		if editorErr != nil {
+			log.Fatalf("Error opening journal: %v", editorErr)
+		}
+		titleFormat := formatFlag
+		if titleFormat == "" {
+			titleFormat = journalEnv
+		}
+		if titleFormat == "" {
+			titleFormat = journalTitleFmt
+		}
+		runNotebook(path, key, "Error opening journal", func(ctx context.Context, nb *aen.Notebook) error {
+			return openJournal(ctx, nb, dateFlag, titleFormat, bufio.NewReader(os.Stdin), editorCmd)
+		})
+
+	case "template":
+		TemplateCmd.Parse(os.Args[2:])
+		path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
+		if err != nil {
+			log.Fatalf("Error managing templates: %v", err)
+		}
+		args := TemplateCmd.Args()
+		runNotebook(path, "", "Error managing templates", func(ctx context.Context, nb *aen.Notebook) error {
+			switch {
+			case len(args) == 0 || args[0] == "list":
+				return listTemplates(ctx, nb)
+			case args[0] == "add" && (len(args) == 2 || len(args) == 3):
+				if len(args) == 3 {
+					fileFlag = args[2]
+				}
+				if fileFlag == "" && editorErr != nil {
+					return editorErr
+				}
+				return addTemplate(ctx, nb, args[1], fileFlag, bufio.NewReader(os.Stdin), editorCmd)
+			case (args[0] == "rm" || args[0] == "remove") && len(args) == 2:
+				return removeTemplate(ctx, nb, args[1])
+			}
+			return errors.New("use \"template add <name> [file]\", \"template rm <name>\" or \"template list\"")
+		})
+
+	case "push", "pull":
+		SyncCmd.Parse(os.Args[2:])
+		path, _, err := utils.GetPaths(pathFlag, pathEnv, "", "", false)
+		if err != nil {
+			log.Fatalf("Error syncing notes: %v", err)
+		}
+		syncRemote(path, remoteFlag, os.Args[1] == "push", forceFlag)
+
+	case "agent":
+		AgentCmd.Parse(os.Args[2:])
+		socket := socketFlag
+		if socket == "" {
+			socket = agentEnv
+		}
+		if socket == "" {
+			socket = agent.DefaultSocket()
+		}
+		if stopFlag {
+			stopAgent(socket)
+			break
+		}
+		key := keyFlag
+		if key == "" {
+			key = keyEnv
+		}
+		if key == "" {
+			log.Fatal("Error starting agent: path to keyfile must be given.")
+		}
+		runAgent(key, socket, timeoutFlag)
+
+	case "serve":
+		ServeCmd.Parse(os.Args[2:])
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, agentEnv == "")
+		if err != nil {
+			log.Fatalf("Error serving notes: %v", err)
+		}
+		if !stdioFlag {
+			log.Fatal("Error serving notes: only --stdio is supported.")
+		}
+		runNotebook(path, key, "Error serving notes", func(ctx context.Context, nb *aen.Notebook) error {
+			return serveStdio(ctx, nb)
+		})
+
+	case "shell", "sh":
+		ShellCmd.Parse(os.Args[2:])
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, agentEnv == "")
+		if err != nil {
+			log.Fatalf("Error starting shell: %v", err)
+		}
+		handlers, err := parseHandlers(handlerEnv)
+		if err != nil {
+			log.Fatalf("Error starting shell: %v", err)
+		}
+		if editorErr != nil {
+			log.Printf("Warning: %v", editorErr)
+		}
+		runShell(path, key, editorCmd, handlers, timeoutFlag)
+
+	case "web":
+		WebCmd.Parse(os.Args[2:])
+		path, key, err := utils.GetPaths(pathFlag, pathEnv, keyFlag, keyEnv, agentEnv == "")
+		if err != nil {
+			log.Fatalf("Error serving web UI: %v", err)
+		}
+		runNotebook(path, key, "Error serving web UI", func(ctx context.Context, nb *aen.Notebook) error {
+			return serveWeb(ctx, nb, listenFlag, allowRemoteFlag)
+		})
 
 	default:
 		flag.Usage()
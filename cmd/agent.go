@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/agent"
+)
+
+// runAgent loads the identity and unwraps file keys for other aen processes until it is stopped or idle for
+// the given timeout. The shell commands for using the agent are printed to stdout, like ssh-agent does.
+func runAgent(keyFlag, socket string, timeout time.Duration) {
+	identity, err := aen.LoadKey(keyFlag)
+	if err != nil {
+		log.Fatalf("Could not load private key: %v", err)
+	}
+	listener, err := agent.Listen(socket)
+	if err != nil {
+		log.Fatalf("Error starting agent: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fmt.Printf("%s=%s; export %s;\n", agent.SocketEnv, socket, agent.SocketEnv)
+	if timeout > 0 {
+		log.Printf("Agent listening on %s, stopping after being idle for %s.", socket, timeout)
+	} else {
+		log.Printf("Agent listening on %s.", socket)
+	}
+	if err = agent.Serve(ctx, listener, identity, timeout); err != nil {
+		log.Fatalf("Error running agent: %v", err)
+	}
+	log.Println("Agent stopped.")
+}
+
+// stopAgent asks the agent listening on the socket to stop.
+func stopAgent(socket string) {
+	if err := agent.NewIdentity(socket).Stop(); err != nil {
+		log.Fatalf("Error stopping agent: %v", err)
+	}
+	log.Println("Stopped agent.")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/3c7/aen"
+)
+
+// appendNote appends the message, or the text read from stdin if no message is given and readStdin is set, as new
+// line to a text note. With timestampFlag, every line is prefixed with the current time. With createFlag, a note with
+// the given slug is created if it is not available, so aen can be used as encrypted log from scripts.
+func appendNote(ctx context.Context, nb *aen.Notebook, ref aen.Ref, messageFlag string, readStdin, timestampFlag, createFlag bool) error {
+	text := messageFlag
+	if text == "" && readStdin {
+		content, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = string(content)
+	}
+	if strings.TrimSpace(text) == "" {
+		if !readStdin {
+			return errors.New("no text given, use --message")
+		}
+		return errors.New("no text given, use --message or pipe the text to stdin")
+	}
+	text = strings.TrimSuffix(text, "\n")
+	if timestampFlag {
+		prefix := time.Now().Format("2006-01-02 15:04:05") + " "
+		text = prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+	}
+	text += "\n"
+
+	encryptedNote, err := nb.Append(ctx, ref, text)
+	if errors.Is(err, aen.ErrNoteNotFound) && createFlag && ref.Slug != "" {
+		if encryptedNote, err = nb.Write(ctx, ref.Slug, text); err != nil {
+			return err
+		}
+		log.Printf("Written note %s.", encryptedNote.Slug())
+		return nil
+	} else if err != nil {
+		return err
+	}
+	log.Printf("Appended to note %s.", encryptedNote.Slug())
+	return nil
+}
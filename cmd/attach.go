@@ -1,53 +1,31 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"path/filepath"
 
 	"github.com/3c7/aen"
-	"github.com/3c7/aen/internal/model"
 )
 
-// attachFile attaches a new file to a note through
-// - loading a note by its ID
-// - decrypting the note
-// - reading the file and put it into the Attachment model
-// - encrypting the note again
-// - storing the note in the database
-func attachFile(dbPath, keyPath, filePath, fileName string, noteId uint) {
-	if noteId == 0 {
-		log.Fatalf("Note index must be given, but was %d", noteId)
+// attachFile encrypts a file and attaches it to the given note, "-" reads the file from stdin. The note itself
+// is not decrypted.
+func attachFile(ctx context.Context, nb *aen.Notebook, filePath, fileName string, ref aen.Ref) error {
+	if filePath == "" {
+		return errors.New("no file given")
 	}
-	db, err := aen.OpenDatabase(dbPath, false)
-	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
-	}
-
-	encryptedNote, err := db.GetEncryptedNoteByIndex(noteId)
-	if err != nil {
-		log.Fatalf("Could not get note by id: %v", err)
-	}
-
-	attachment, err := model.NewAttachmentFromFile(fileName, filePath)
-	if err != nil {
-		log.Fatalf("Could not read file %s: %v", filePath, err)
+	if filePath == "-" && fileName == "" {
+		return errors.New("name must be given when reading from stdin")
 	}
-
-	if given, name := encryptedNote.CheckSha256Hash(attachment.Sha256); given {
-		log.Fatalf("Attachment already present under the name %s.", name)
-	}
-
-	recipients, err := db.GetAgeRecipients()
-	if err != nil {
-		log.Fatalf("Could not load recipients: %v", err)
-	}
-
-	encryptedAttachment, err := attachment.Encrypt(recipients...)
+	file, err := openInput(filePath)
 	if err != nil {
-		log.Fatalf("Could not encrypt attachment %s: %v", filePath, err)
+		return err
 	}
+	defer file.Close()
 
-	encryptedNote.Attachments = append(encryptedNote.Attachments, *encryptedAttachment)
-	if err = db.SaveEncryptedNote(encryptedNote); err != nil {
-		log.Fatalf("Could not attach encrypted note: %v", err)
+	if fileName == "" {
+		fileName = filepath.Base(filePath)
 	}
+	_, err = nb.Attach(ctx, ref, fileName, file)
+	return err
 }
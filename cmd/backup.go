@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/backup"
+)
+
+// backupDatabase writes a consistent snapshot of the database to the backup directory and rotates old backups.
+func backupDatabase(pathFlag, dirFlag string, keepFlag int) {
+	if dirFlag == "" {
+		log.Fatal("Error creating backup: backup directory must be given.")
+	}
+	db, err := aen.OpenDatabaseReadOnly(pathFlag)
+	if errors.Is(err, aen.ErrDatabaseInUse) {
+		log.Fatalf("Error opening database: %v, stop \"aen serve\", \"aen web\" or \"aen shell\" first.", err)
+	} else if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	entry, err := backup.Create(db, dirFlag, keepFlag)
+	if err != nil {
+		log.Fatalf("Error creating backup: %v", err)
+	}
+	log.Printf("Written backup %s (%d bytes, SHA-256 %s).", entry.Filename, entry.Size, entry.Sha256)
+}
+
+// verifyBackups checks either a single backup file or all backups listed in the manifest of a backup directory.
+func verifyBackups(dirFlag, fileFlag string) {
+	if fileFlag != "" {
+		notes, err := backup.VerifyFile(fileFlag)
+		if err != nil {
+			log.Fatalf("Backup %s is invalid: %v", fileFlag, err)
+		}
+		log.Printf("Backup %s is valid and contains %d notes.", fileFlag, notes)
+		return
+	}
+	if dirFlag == "" {
+		log.Fatal("Error verifying backups: either backup directory or file must be given.")
+	}
+
+	results, err := backup.Verify(dirFlag)
+	if err != nil {
+		log.Fatalf("Error verifying backups: %v", err)
+	}
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			log.Printf("FAILED %s: %v", result.Filename, result.Err)
+		} else {
+			log.Printf("OK     %s (%d notes)", result.Filename, result.Notes)
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d backups failed verification.", failed, len(results))
+	}
+}
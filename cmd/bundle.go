@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/bundle"
+	"github.com/3c7/aen/internal/utils"
+)
+
+// createBundle writes the notes changed since the given marker to a signed bundle file. A negative marker
+// uses the latest marker, so consecutive calls only contain new changes.
+func createBundle(pathFlag, keyFlag, fileFlag string, sinceFlag int) {
+	if fileFlag == "" {
+		log.Fatal("Error creating bundle: output file must be given.")
+	}
+	db, err := aen.OpenStore(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	identity, err := utils.IdentityFromKeyfile(keyFlag)
+	if err != nil {
+		log.Fatalf("Could not load private key: %v", err)
+	}
+
+	var since uint64
+	if sinceFlag < 0 {
+		if since, err = bundle.LatestMarker(db); err != nil {
+			log.Fatalf("Error reading bundle marker: %v", err)
+		}
+	} else {
+		since = uint64(sinceFlag)
+	}
+
+	payload, err := bundle.Create(db, identity, since, fileFlag)
+	if err != nil {
+		log.Fatalf("Error creating bundle: %v", err)
+	}
+	fmt.Printf("Source key: %s\n", payload.Source)
+	log.Printf("Wrote bundle %d (since marker %d) to %s: %d notes changed, %d deleted.",
+		payload.Sequence, payload.Since, fileFlag, len(payload.Notes), len(payload.Deleted))
+}
+
+// applyBundle verifies a bundle and applies its changes. If trustFlag is given, it must be the key the bundle is
+// signed with, which is added to the trusted senders once the bundle was applied.
+func applyBundle(pathFlag, fileFlag, trustFlag string, forceFlag bool) {
+	if fileFlag == "" {
+		log.Fatal("Error applying bundle: bundle file must be given.")
+	}
+	db, err := aen.OpenStore(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	payload, err := bundle.Read(fileFlag)
+	if err != nil {
+		log.Fatalf("Error reading bundle: %v", err)
+	}
+	result, err := bundle.Apply(db, payload, trustFlag, forceFlag)
+	if err != nil {
+		log.Fatalf("Error applying bundle: %v", err)
+	}
+
+	printSlugs := func(label string, slugs []string) {
+		if len(slugs) > 0 {
+			fmt.Printf("%-12s %s\n", label, strings.Join(slugs, ", "))
+		}
+	}
+	printSlugs("Added:", result.Added)
+	printSlugs("Updated:", result.Updated)
+	printSlugs("Deleted:", result.Deleted)
+	printSlugs("Recipients:", result.Recipients)
+	log.Printf("Applied bundle %d: %d added, %d updated, %d deleted, %d recipients added.",
+		payload.Sequence, len(result.Added), len(result.Updated), len(result.Deleted), len(result.Recipients))
+}
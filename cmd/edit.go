@@ -1,112 +1,268 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/editor"
 	"github.com/3c7/aen/internal/model"
 	"github.com/3c7/aen/internal/utils"
 )
 
-// editNode, sililar to createNote, decrypts and writes a note to a temporary file which then can be edited through the configured editor.
-func editNote(pathFlag, keyFlag, slugFlag string, idFlag uint, editorCmd []string, shredFlag bool, createFlag bool) {
-	var note *model.EncryptedNote
-	var decryptedNote model.Note
-	db, err := aen.OpenDatabase(pathFlag, false)
+// editSession is the private temporary directory holding the plaintext of a note while it is edited. The directory
+// is shredded when the session is closed or aen is interrupted, including swap and backup files of the editor.
+type editSession struct {
+	dir     string
+	ctx     context.Context // cancelled if aen is interrupted, which kills the editor
+	cancel  context.CancelFunc
+	signals chan os.Signal
+	done    chan struct{}
+	shred   sync.Once
+}
+
+// newEditSession creates the directory, preferably on a RAM backed file system. If aen receives SIGINT, SIGTERM
+// or SIGHUP before the session is closed, the directory is shredded and the context of the session is cancelled,
+// so the edit fails instead of aen exiting, e.g. within the shell.
+func newEditSession(ctx context.Context) (*editSession, error) {
+	dir, ramBacked, err := utils.PrivateTempDir("aen*")
 	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+		return nil, err
 	}
-	defer db.Close()
+	if !ramBacked {
+		log.Printf("Warning: no RAM backed file system found, the plaintext is written to %s until it is shredded.", dir)
+	}
+	s := &editSession{dir: dir, signals: make(chan os.Signal, 1), done: make(chan struct{})}
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	signal.Notify(s.signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		select {
+		case sig := <-s.signals:
+			s.cancel()
+			if err := s.shredDir(); err != nil {
+				log.Printf("Error shredding %s: %v", s.dir, err)
+			}
+			log.Printf("Received %s, temporary files were shredded.", sig)
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
 
-	if len(slugFlag) > 0 {
-		available, err := db.CheckSlug(slugFlag)
-		if err != nil {
-			log.Fatalf("Could not check for availability of slug %s: %v", slugFlag, err)
+// path returns the path of a file in the session directory.
+func (s *editSession) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// err returns an error if the session was interrupted, so the edited file must not be used.
+func (s *editSession) err() error {
+	if err := s.ctx.Err(); err != nil {
+		return fmt.Errorf("edit cancelled: %w", err)
+	}
+	return nil
+}
+
+// shredDir shreds the session directory once, either when interrupted or when the session is closed.
+func (s *editSession) shredDir() (err error) {
+	s.shred.Do(func() { err = utils.ShredDir(s.dir) })
+	return err
+}
+
+// Close shreds the session directory.
+func (s *editSession) Close() error {
+	signal.Stop(s.signals)
+	close(s.done)
+	s.cancel()
+	return s.shredDir()
+}
+
+// confirm asks a yes/no question and reads the answer from in, the buffered stdin shared with the shell. If no
+// answer can be read, e.g. at the end of the input, false is returned.
+func confirm(in *bufio.Reader, question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [Y/n] ", question)
+	answer, err := in.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// editInEditor writes the note including a front matter block to a temporary file which then can be edited through
+// the configured editor. Title, text, tags, creation time and custom fields of the note are replaced by the edited
+// version. If the front matter is invalid, the error is shown and the file can be edited again before it is shredded.
+func editInEditor(ctx context.Context, note *model.Note, in *bufio.Reader, editorCmd editor.Command) (err error) {
+	session, err := newEditSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if shredErr := session.Close(); err == nil {
+			err = shredErr
 		}
-		if available {
-			note, err = db.GetEncryptedNoteBySlug(slugFlag)
-			if err != nil {
-				log.Fatalf("Error receiving note %s from DB: %v", slugFlag, err)
+	}()
+	path := session.path("note.md")
+
+	if err = note.ToFile(path); err != nil {
+		return err
+	}
+	var newNote *model.Note
+	for {
+		if err = editorCmd.Run(session.ctx, path); err != nil {
+			if cancelled := session.err(); cancelled != nil {
+				return cancelled
 			}
+			return err
 		}
-	} else if idFlag > 0 {
-		note, err = db.GetEncryptedNoteByIndex(idFlag)
-		if err != nil {
-			log.Fatalf("Error receiving note %d from DB: %v", idFlag, err)
+		newNote, err = model.NotefileToNote(path)
+		if cancelled := session.err(); cancelled != nil {
+			return cancelled
+		} else if err == nil {
+			break
+		}
+		log.Printf("Error: %v", err)
+		if !confirm(in, "Edit the note again?") {
+			return err
 		}
-	} else {
-		log.Fatal("Error receiving note from DB: either slug or id must be given.")
 	}
-
-	identity, err := utils.IdentityFromKeyfile(keyFlag)
-	if err != nil {
-		log.Fatalf("Could not load private key: %v", err)
+	note.Title, note.Text = newNote.Title, newNote.Text
+	// Only files containing a front matter block carry tags and fields, so they are kept for files without it
+	if newNote.Tags != nil {
+		note.Tags, note.Fields = newNote.Tags, newNote.Fields
 	}
+	// Times in the front matter are given in seconds, so the time only changes if it was edited
+	if !newNote.Created.IsZero() && !newNote.Created.Equal(note.Created.Truncate(time.Second)) {
+		note.Created = newNote.Created
+	}
+	return nil
+}
 
-	if note != nil {
-		if note.IsFile {
-			log.Fatalf("Editing binary notes is not implemented.")
+// parseHandlers parses the handlers for editing file notes given as "<extension>=<command>", separated by
+// semicolons, e.g. "pdf=xournalpp;png=gimp -n". Extensions are compared without the leading dot and case.
+// Commands are split like editor commands, so they can contain quotes and the {} placeholder.
+func parseHandlers(handlerEnv string) (handlers map[string]editor.Command, err error) {
+	handlers = map[string]editor.Command{}
+	for _, entry := range strings.Split(handlerEnv, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
 		}
+		parts := strings.SplitN(entry, "=", 2)
+		ext := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(parts[0]), "."))
+		if len(parts) != 2 || ext == "" {
+			return nil, fmt.Errorf("invalid handler \"%s\", expected <extension>=<command>", entry)
+		}
+		if handlers[ext], err = editor.Parse(parts[1]); err != nil {
+			return nil, fmt.Errorf("invalid handler \"%s\": %w", entry, err)
+		}
+	}
+	return handlers, nil
+}
 
-		decryptedNote, err = note.ToDecryptedNote(identity)
-		if err != nil {
-			log.Fatalf("Could not decrypt note %s: %v", note.Slug(), err)
+// editFileInHandler writes the content of a file note to a temporary file keeping its extension, so the handler
+// configured for the extension can be used. Without handler, the editor is used if the content is valid UTF-8.
+func editFileInHandler(ctx context.Context, fileNote *model.FileNote, editorCmd editor.Command, handlers map[string]editor.Command) (err error) {
+	ext := filepath.Ext(utils.SafeFilename(fileNote.Title))
+	handlerCmd, found := handlers[strings.ToLower(strings.TrimPrefix(ext, "."))]
+	if !found {
+		if !utf8.Valid(fileNote.Content) {
+			return fmt.Errorf("no handler configured for binary files with extension \"%s\", see AENHANDLERS", ext)
 		}
-	} else if note == nil && createFlag {
-		decryptedNote = *model.NewNote("", "")
-		decryptedNote.Title = slugFlag
-	} else {
-		log.Fatalf("Note with slug %s not found.", slugFlag)
+		handlerCmd = editorCmd
 	}
 
-	file, err := os.CreateTemp("", "note*.md")
+	session, err := newEditSession(ctx)
 	if err != nil {
-		log.Fatalf("Error creating temporary file: %v", err)
+		return err
 	}
-	defer os.Remove(file.Name())
+	defer func() {
+		if shredErr := session.Close(); err == nil {
+			err = shredErr
+		}
+	}()
+	path := session.path("file" + ext)
 
-	err = decryptedNote.ToFile(file.Name())
-	if err != nil {
-		log.Fatalf("Error writing note to file %s: %v", file.Name(), err)
+	if err = os.WriteFile(path, fileNote.Content, 0600); err != nil {
+		return err
+	}
+	if err = handlerCmd.Run(session.ctx, path); err != nil {
+		if cancelled := session.err(); cancelled != nil {
+			return cancelled
+		}
+		return err
 	}
+	content, err := os.ReadFile(path)
+	if cancelled := session.err(); cancelled != nil {
+		return cancelled
+	} else if err != nil {
+		return err
+	}
+	fileNote.Content = content
+	return nil
+}
 
-	editorCmd = append(editorCmd, file.Name())
-	Cmd := exec.Command(editorCmd[0], editorCmd[1:]...)
-	err = Cmd.Run()
+// createInEditor opens a new note, e.g. prefilled from a template, with the configured editor and stores it.
+func createInEditor(ctx context.Context, nb *aen.Notebook, note *model.Note, in *bufio.Reader, editorCmd editor.Command) error {
+	if err := editInEditor(ctx, note, in, editorCmd); err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(note.Text)) == 0 {
+		return errors.New("both, title and text, must be given")
+	}
+	encryptedNote, err := nb.Create(ctx, note)
 	if err != nil {
-		log.Fatalf("Error running command: %v", err)
+		return err
 	}
+	log.Printf("Written note %s.", encryptedNote.Slug())
+	return nil
+}
 
-	newNote, err := model.NotefileToNote(file.Name())
-	if err != nil {
-		log.Fatalf("Error reading note from file %s: %v", file.Name(), err)
+// editNote decrypts and writes a note to a temporary file which then can be edited through the configured editor.
+// File notes are opened with the handler configured for their extension. With createFlag set, a note with the given slug is created
+// through the same workflow if it is not available. An empty ref always creates a new note.
+func editNote(ctx context.Context, nb *aen.Notebook, ref aen.Ref, in *bufio.Reader, editorCmd editor.Command, handlers map[string]editor.Command, createFlag bool) error {
+	var encryptedNote *aen.EncryptedNote
+	var err error = aen.ErrNoteNotFound
+	if ref != (aen.Ref{}) {
+		encryptedNote, err = nb.GetEncrypted(ctx, ref)
+	}
+	if errors.Is(err, aen.ErrNoteNotFound) && createFlag && (ref.Slug != "" || ref == (aen.Ref{})) {
+		note := model.NewNote(ref.Slug, "")
+		// The creation time is set when saving, unless it was given in the front matter
+		note.Created = time.Time{}
+		return createInEditor(ctx, nb, note, in, editorCmd)
+	} else if err != nil {
+		return err
 	}
 
-	newNote.Uuid = decryptedNote.Uuid
-	newNote.Time = time.Now()
-	if newNote.Slug() != decryptedNote.Slug() {
-		err = db.DeleteNoteBySlug(note.Slug())
+	if encryptedNote.ContainsFile() {
+		encryptedNote, err = nb.EditFile(ctx, ref, func(fileNote *model.FileNote) error {
+			return editFileInHandler(ctx, fileNote, editorCmd, handlers)
+		})
 		if err != nil {
-			log.Fatalf("Could not delete old note by slug %s: %v", note.Slug(), err)
+			return err
 		}
+		log.Printf("Written file note %s.", encryptedNote.Slug())
+		return nil
 	}
-	recipients, err := db.GetAgeRecipients()
-	if err != nil {
-		log.Fatalf("Could not get recipients: %v", err)
-	}
-	newEncryptedNote, err := newNote.ToEncryptedNote(recipients...)
-	if err != nil {
-		log.Fatalf("Could not encrypt note: %v", err)
-	}
-	err = db.SaveEncryptedNote(&newEncryptedNote)
+
+	encryptedNote, err = nb.Edit(ctx, ref, func(note *model.Note) error {
+		return editInEditor(ctx, note, in, editorCmd)
+	})
 	if err != nil {
-		log.Fatalf("Could not save encrypted note: %v", err)
-	}
-	log.Printf("Written note %s.", newEncryptedNote.Slug())
-	if shredFlag {
-		utils.OverwriteFileContent(file.Name())
+		return err
 	}
+	log.Printf("Written note %s.", encryptedNote.Slug())
+	return nil
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/export"
+)
+
+// exportNotes writes all notes and attachments as age encrypted files into a directory
+// which can be decrypted without aen, e.g. with "age -d -i key".
+func exportNotes(pathFlag, dirFlag string) {
+	if dirFlag == "" {
+		log.Fatal("Error exporting notes: output directory must be given.")
+	}
+	db, err := aen.OpenStore(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	index, err := export.ExportStore(db, dirFlag)
+	if err != nil {
+		log.Fatalf("Error exporting notes: %v", err)
+	}
+	log.Printf("Exported %d notes to %s.", len(index.Notes), dirFlag)
+}
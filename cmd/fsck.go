@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"filippo.io/age"
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/utils"
+)
+
+// checkDatabase reports inconsistent records and, if requested, moves them to the quarantine bucket.
+// If a key is given, notes and attachments are decrypted as well.
+func checkDatabase(pathFlag, keyFlag string, repairFlag bool) {
+	db, err := aen.OpenDatabase(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	var identity age.Identity
+	if keyFlag != "" {
+		identity, err = utils.IdentityFromKeyfile(keyFlag)
+		if err != nil {
+			log.Fatalf("Could not load private key: %v", err)
+		}
+	}
+
+	problems, err := db.Check(identity)
+	if err != nil {
+		log.Fatalf("Error checking database: %v", err)
+	}
+	var broken, repairable int
+	for _, p := range problems {
+		log.Println(p.String())
+		// Notes encrypted to other recipients are expected in shared databases
+		if p.Kind == database.ProblemNotRecipient {
+			continue
+		}
+		broken++
+		if p.Repairable() {
+			repairable++
+		}
+	}
+	if broken == 0 {
+		if len(problems) > 0 {
+			log.Printf("No problems found, %d records are not encrypted to the given key.", len(problems))
+			return
+		}
+		log.Println("No problems found.")
+		return
+	}
+	log.Printf("Found %d problems, %d of them can be repaired.", broken, repairable)
+
+	if repairable == 0 {
+		os.Exit(1)
+	}
+	if !repairFlag {
+		log.Fatal("Run with --repair to move broken records to the quarantine bucket.")
+	}
+	repaired, err := db.Repair(problems)
+	if err != nil {
+		log.Fatalf("Error repairing database: %v", err)
+	}
+	log.Printf("Repaired %d records.", repaired)
+	if repairable < broken {
+		os.Exit(1)
+	}
+}
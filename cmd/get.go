@@ -1,79 +1,108 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/3c7/aen"
-	"github.com/3c7/aen/internal/model"
 	"github.com/3c7/aen/internal/utils"
 )
 
-// getNote receives a note from the database and write it to a file in case its a FileNote
-func getNote(pathFlag, keyFlag, slugFlag, fileFlag string, idFlag uint, rawFlag bool) {
-	var encryptedNote *model.EncryptedNote
-	db, err := aen.OpenDatabase(pathFlag, false)
-	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
+// writeOutput writes the content read from r to the file given by fileFlag, "-" refers to stdout. Without fileFlag,
+// the name derived from the note, e.g. its title, is reduced to a safe basename, as it is chosen by the author of
+// the note. Relative paths are placed in outdirFlag, if given. Existing files are only overwritten with forceFlag.
+func writeOutput(fileFlag, outdirFlag, derivedName string, forceFlag bool, r io.Reader) (err error) {
+	if fileFlag == "-" {
+		_, err = io.Copy(os.Stdout, r)
+		return err
 	}
-	defer db.Close()
-
-	identity, err := utils.IdentityFromKeyfile(keyFlag)
-	if err != nil {
-		log.Fatalf("Could not load private key: %v", err)
+	path := fileFlag
+	if path == "" {
+		path = utils.SafeFilename(derivedName)
 	}
+	if outdirFlag != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(outdirFlag, path)
+	}
+	if err = utils.WriteFileAtomic(path, r, forceFlag); err != nil {
+		return fmt.Errorf("could not write file: %w", err)
+	}
+	log.Printf("Written file to \"%s\".", path)
+	return nil
+}
 
-	if slugFlag != "" {
-		encryptedNote, err = db.GetEncryptedNoteBySlug(slugFlag)
-		if err != nil {
-			log.Fatalf("Could not load note by slug: %v", err)
+// getAttachment decrypts the attachment with the given filename and writes it to a file, by default using its filename.
+func getAttachment(ctx context.Context, nb *aen.Notebook, ref aen.Ref, encryptedNote *aen.EncryptedNote, fileFlag, outdirFlag, attachmentFlag string, forceFlag bool) error {
+	for i := range encryptedNote.Attachments {
+		if encryptedNote.Attachments[i].Filename != attachmentFlag {
+			continue
 		}
-	} else if idFlag != 0 {
-		encryptedNote, err = db.GetEncryptedNoteByIndex(idFlag)
+		r, attachment, err := nb.OpenAttachment(ctx, ref, i)
 		if err != nil {
-			log.Fatalf("Could not load note by id: %v", err)
+			return err
 		}
+		return writeOutput(fileFlag, outdirFlag, attachment.Filename, forceFlag, r)
 	}
+	return fmt.Errorf("note %s has no attachment %s", encryptedNote.Slug(), attachmentFlag)
+}
 
-	if encryptedNote.IsFile {
-		var filename string
-		fNote, err := encryptedNote.ToDecryptedFileNote(identity)
-		if err != nil {
-			log.Fatalf("Could not decrypt note: %v", err)
-		}
-
-		if fileFlag != "" {
-			filename = fileFlag
-		} else {
-			filename = fNote.Title
-		}
+// getNote receives a note from the database and write it to a file in case its a FileNote. The file is written to
+// stdout if fileFlag is "-". If attachmentFlag is given, the attachment with this filename is written instead.
+func getNote(ctx context.Context, nb *aen.Notebook, ref aen.Ref, fileFlag, outdirFlag, attachmentFlag string, rawFlag, forceFlag bool) error {
+	encryptedNote, err := nb.GetEncrypted(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if attachmentFlag != "" {
+		return getAttachment(ctx, nb, ref, encryptedNote, fileFlag, outdirFlag, attachmentFlag, forceFlag)
+	}
 
-		if err = os.WriteFile(filename, fNote.Content, 0600); err != nil {
-			log.Fatalf("Error writing file: %v", err)
-		}
-		log.Printf("Written file to \"%s\".", filename)
-	} else {
-		note, err := encryptedNote.ToDecryptedNote(identity)
+	if encryptedNote.ContainsFile() {
+		r, _, err := nb.OpenFile(ctx, ref)
 		if err != nil {
-			log.Fatalf("Could not decrypt note: %v", err)
+			return err
 		}
+		return writeOutput(fileFlag, outdirFlag, encryptedNote.Title, forceFlag, r)
+	}
 
-		if rawFlag {
-			fmt.Printf("%s\n", note.Text)
-		} else {
-			fmt.Printf("Title: %s (%s)\n", note.Title, note.Uuid.String())
-			fmt.Printf("Created: %s\n", note.Time.Format("2006-01-02 15:04:05"))
-			fmt.Printf("Content:\n%s\n", note.Text)
-			if len(encryptedNote.Attachments) > 0 {
-				fmt.Println("Attachments:")
-				for i := range encryptedNote.Attachments {
-					fmt.Printf("  - %s\n", encryptedNote.Attachments[i].Filename)
-					fmt.Printf("    MD5:\t%s\n", encryptedNote.Attachments[i].Md5)
-					fmt.Printf("    SHA1:\t%s\n", encryptedNote.Attachments[i].Sha1)
-					fmt.Printf("    SHA256:\t%s\n", encryptedNote.Attachments[i].Sha256)
-				}
-			}
+	note, err := nb.Get(ctx, ref)
+	if err != nil {
+		return err
+	}
+	if rawFlag {
+		fmt.Printf("%s\n", note.Text)
+		return nil
+	}
+	fmt.Printf("Title: %s (%s)\n", note.Title, note.Uuid.String())
+	fmt.Printf("Created: %s\n", note.Created.Format("2006-01-02 15:04:05"))
+	if !note.Modified.IsZero() {
+		fmt.Printf("Modified: %s\n", note.Modified.Format("2006-01-02 15:04:05"))
+	}
+	if len(note.Tags) > 0 {
+		fmt.Printf("Tags: %s\n", strings.Join(note.Tags, ", "))
+	}
+	keys := make([]string, 0, len(note.Fields))
+	for key := range note.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("%s: %s\n", key, note.Fields[key])
+	}
+	fmt.Printf("Content:\n%s\n", note.Text)
+	if len(encryptedNote.Attachments) > 0 {
+		fmt.Println("Attachments:")
+		for i := range encryptedNote.Attachments {
+			fmt.Printf("  - %s\n", encryptedNote.Attachments[i].Filename)
+			fmt.Printf("    MD5:\t%s\n", encryptedNote.Attachments[i].Md5)
+			fmt.Printf("    SHA1:\t%s\n", encryptedNote.Attachments[i].Sha1)
+			fmt.Printf("    SHA256:\t%s\n", encryptedNote.Attachments[i].Sha256)
 		}
 	}
+	return nil
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/importer"
+	"github.com/3c7/aen/internal/model"
+	"github.com/3c7/aen/internal/utils"
+)
+
+// importNotes imports a directory of Markdown files. Existing notes are decrypted in order to skip files
+// which were already imported. With dryRunFlag set, only the report is printed.
+func importNotes(pathFlag, keyFlag, dirFlag string, dryRunFlag bool) {
+	if dirFlag == "" {
+		log.Fatal("Error importing notes: directory must be given.")
+	}
+	db, err := aen.OpenStore(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	identity, err := utils.IdentityFromKeyfile(keyFlag)
+	if err != nil {
+		log.Fatalf("Could not load private key: %v", err)
+	}
+
+	candidates, err := importer.Scan(dirFlag)
+	if err != nil {
+		log.Fatalf("Error reading directory: %v", err)
+	}
+	encryptedNotes, err := db.GetEncryptedNotes()
+	if err != nil {
+		log.Fatalf("Error reading notes: %v", err)
+	}
+	var existing []model.Note
+	var slugs []string
+	for i := range encryptedNotes {
+		slugs = append(slugs, encryptedNotes[i].Slug())
+		if encryptedNotes[i].ContainsFile() {
+			continue
+		}
+		note, err := encryptedNotes[i].ToDecryptedNote(identity)
+		if err != nil {
+			log.Printf("Could not decrypt note %s, it is not checked for duplicates: %v", encryptedNotes[i].Slug(), err)
+			continue
+		}
+		existing = append(existing, note)
+	}
+	importer.MarkDuplicates(candidates, existing)
+	importer.ResolveTitles(candidates, slugs)
+
+	recipients, err := db.GetAgeRecipients()
+	if err != nil {
+		log.Fatalf("Error loading recipients: %v", err)
+	}
+
+	root, err := filepath.Abs(dirFlag)
+	if err != nil {
+		log.Fatalf("Error resolving directory: %v", err)
+	}
+	imported, skipped := 0, 0
+	for _, c := range candidates {
+		rel, err := filepath.Rel(root, c.Path)
+		if err != nil {
+			rel = c.Path
+		}
+		if len(c.Duplicate) > 0 {
+			fmt.Printf("skip    %s (already imported as %s)\n", rel, c.Duplicate)
+			skipped++
+			continue
+		}
+		fmt.Printf("import  %s -> %s (tags: %s, attachments: %d)\n", rel, c.Note.Slug(), strings.Join(c.Tags, ", "), len(c.Attachments))
+		imported++
+		if dryRunFlag {
+			continue
+		}
+
+		note := c.Note
+		for _, attachment := range c.Attachments {
+			if err = note.AttachFile(attachment, ""); err != nil {
+				log.Fatalf("Error attaching %s to %s: %v", attachment, rel, err)
+			}
+		}
+		encryptedNote, err := note.ToEncryptedNote(recipients...)
+		if err != nil {
+			log.Fatalf("Error encrypting note %s: %v", rel, err)
+		}
+		for _, tag := range c.Tags {
+			encryptedNote.AddTag(tag)
+		}
+		if err = db.SaveEncryptedNote(&encryptedNote); err != nil {
+			log.Fatalf("Error saving note %s: %v", rel, err)
+		}
+	}
+	if dryRunFlag {
+		log.Printf("Dry run: %d notes would be imported, %d skipped.", imported, skipped)
+	} else {
+		log.Printf("Imported %d notes, skipped %d.", imported, skipped)
+	}
+}
@@ -18,7 +18,7 @@ func initAen(path string, keyPath string, aliasFlag string) (err error) {
 	}
 	fmt.Printf("Public key: %s\n", key.Recipient().String())
 
-	db, err := aen.OpenDatabase(path, true)
+	db, err := aen.OpenStore(path, true)
 	if err != nil {
 		return err
 	}
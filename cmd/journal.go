@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/editor"
+	"github.com/3c7/aen/internal/model"
+)
+
+const (
+	journalTag      = "journal"            // tag of all journal entries
+	journalField    = "date"               // custom field containing the day of a journal entry
+	journalLayout   = "2006-01-02"         // layout of the day in --date and the custom field
+	journalTitleFmt = "Journal 2006-01-02" // default title format, see AENJOURNAL
+)
+
+// journalDay parses the day given by dateFlag, today if it is empty.
+func journalDay(dateFlag string) (day time.Time, err error) {
+	if dateFlag == "" {
+		return time.Now(), nil
+	}
+	if day, err = time.ParseInLocation(journalLayout, dateFlag, time.Local); err != nil {
+		return time.Time{}, fmt.Errorf("date must be given as YYYY-MM-DD: %v", err)
+	}
+	return day, nil
+}
+
+// journalEntries returns the journal entries sorted by their day, newest first. Only days starting with prefix,
+// e.g. a month given as "2022-02", are returned.
+func journalEntries(ctx context.Context, nb *aen.Notebook, prefix string) (entries []aen.EncryptedNote, err error) {
+	page, err := nb.List(ctx, aen.ListOptions{Tag: journalTag})
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range page.Notes {
+		if day := note.Fields[journalField]; day != "" && strings.HasPrefix(day, prefix) {
+			entries = append(entries, note)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Fields[journalField] > entries[j].Fields[journalField]
+	})
+	return entries, nil
+}
+
+// openJournal opens the journal entry of the day given by dateFlag with the editor. If there is no entry yet, it is
+// created with the title formatted by titleFormat, a Go time layout, the journal tag and the day as custom field.
+func openJournal(ctx context.Context, nb *aen.Notebook, dateFlag, titleFormat string, in *bufio.Reader, editorCmd editor.Command) error {
+	day, err := journalDay(dateFlag)
+	if err != nil {
+		return err
+	}
+	entries, err := journalEntries(ctx, nb, day.Format(journalLayout))
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return editNote(ctx, nb, aen.ByUuid(entries[0].Uuid), in, editorCmd, nil, false)
+	}
+
+	note := model.NewNote(day.Format(titleFormat), "")
+	// The creation time is set when saving, the day of the entry is kept in its custom field
+	note.Created = time.Time{}
+	note.Tags = []string{journalTag}
+	note.Fields = map[string]string{journalField: day.Format(journalLayout)}
+	return createInEditor(ctx, nb, note, in, editorCmd)
+}
+
+// listJournal prints the journal entries, only those of the month given as YYYY-MM if monthFlag is set.
+func listJournal(ctx context.Context, nb *aen.Notebook, monthFlag string) error {
+	if monthFlag != "" {
+		if _, err := time.Parse("2006-01", monthFlag); err != nil {
+			return fmt.Errorf("month must be given as YYYY-MM: %v", err)
+		}
+	}
+	entries, err := journalEntries(ctx, nb, monthFlag)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		log.Println("No journal entries available.")
+		return nil
+	}
+	noteID, err := createdIndex(ctx, nb)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("| %-10s | %-5s | %-50s |\n", "Date", "ID", "Title")
+	for i := range entries {
+		title := entries[i].Title
+		if len(title) > 50 {
+			title = title[:47] + "..."
+		}
+		fmt.Printf("| %-10s | %-5d | %-50s |\n", entries[i].Fields[journalField], noteID(&entries[i]), title)
+	}
+	return nil
+}
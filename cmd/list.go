@@ -1,62 +1,114 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
 	"github.com/3c7/aen"
-	"github.com/3c7/aen/internal/model"
+	uuid "github.com/google/uuid"
 )
 
-// listNotes lists all notes available in the database and print them ordered by the creation time.
-// Additional information, such as flags, are displayed.
-func listNotes(pathFlag, tagFlag string, showTagsFlag bool, allFlag bool) {
-	db, err := aen.OpenDatabase(pathFlag, false)
+// pageOptions returns the page selected through the list flags.
+func pageOptions(limitFlag, offsetFlag, pageFlag int, cursorFlag, sortFlag string, allFlag bool) (pageOpts aen.PageOptions, err error) {
+	pageOpts = aen.PageOptions{
+		Limit:  limitFlag,
+		Offset: offsetFlag,
+		Cursor: cursorFlag,
+		Sort:   sortFlag,
+	}
+	if cursorFlag != "" && (offsetFlag > 0 || pageFlag > 0) {
+		return aen.PageOptions{}, errors.New("--cursor cannot be combined with --offset or --page")
+	}
+	if allFlag {
+		pageOpts.Limit = 0
+	}
+	if pageFlag > 0 {
+		if pageOpts.Limit == 0 {
+			return aen.PageOptions{}, errors.New("a page can only be selected together with a limit")
+		}
+		pageOpts.Offset = (pageFlag - 1) * pageOpts.Limit
+	}
+	return pageOpts, nil
+}
+
+// createdIndex returns the IDs of all notes, which are their positions in the list sorted by creation time.
+func createdIndex(ctx context.Context, nb *aen.Notebook) (func(note *aen.EncryptedNote) uint, error) {
+	all, err := nb.List(ctx, aen.ListOptions{})
 	if err != nil {
-		log.Fatalf("Error opening database file: %v", err)
+		return nil, err
 	}
-	defer db.Close()
+	ids := make(map[uuid.UUID]uint, len(all.Notes))
+	for idx := range all.Notes {
+		ids[all.Notes[idx].Uuid] = uint(idx + 1)
+	}
+	return func(note *aen.EncryptedNote) uint { return ids[note.Uuid] }, nil
+}
 
-	var notes []model.EncryptedNote
-	if len(tagFlag) == 0 {
-		notes, err = db.GetEncryptedNotes()
-		if err != nil {
-			log.Fatalf("Error reading notes: %v", err)
-		}
-	} else {
-		notes, err = db.GetEncryptedNoteByTag(tagFlag)
-		if err != nil {
-			log.Fatalf("Error finding notes: %v", err)
+// listNotes lists the notes available in the database and print them ordered by the creation or modification time.
+// Additional information, such as flags, are displayed. Only the page described by pageOpts is printed.
+// The ID column shows the position of the note sorted by creation time, unless noteID is given. So IDs do not
+// change when sorting by modification time or filtering by tag.
+func listNotes(ctx context.Context, nb *aen.Notebook, tagFlag string, showTagsFlag bool, pageOpts aen.PageOptions, noteID func(note *aen.EncryptedNote) uint) error {
+	page, err := nb.List(ctx, aen.ListOptions{Tag: tagFlag, PageOptions: pageOpts})
+	if err != nil {
+		return err
+	}
+	if noteID == nil && (tagFlag != "" || pageOpts.Sort == aen.SortModified) {
+		if noteID, err = createdIndex(ctx, nb); err != nil {
+			return err
 		}
 	}
-	if len(notes) == 0 {
+	if page.Total == 0 {
 		log.Println("No notes available.")
-		return
+		return nil
 	}
-	model.SortNoteSlice(notes)
+	if len(page.Notes) == 0 {
+		log.Printf("No notes on this page, %d notes available.", page.Total)
+		return nil
+	}
+
 	headers := fmt.Sprintf("| %-5s | %-5s | %-50s |", "Flags", "ID", "Title")
 	if showTagsFlag {
 		headers += fmt.Sprintf(" %-25s |", "Tags")
 	}
-	headers += fmt.Sprintf(" %-25s |\n", "Creation time")
+	timeHeader := "Creation time"
+	if pageOpts.Sort == aen.SortModified {
+		timeHeader = "Modification time"
+	}
+	headers += fmt.Sprintf(" %-25s |\n", timeHeader)
 	fmt.Print(headers)
 	var title string
-	for idx, note := range notes {
-		if !allFlag && idx == 10 {
-			break
+	for idx := range page.Notes {
+		note := &page.Notes[idx]
+		id := uint(page.Offset + idx + 1)
+		if noteID != nil {
+			id = noteID(note)
 		}
 		if len(note.Title) > 50 {
 			title = note.Title[:47] + "..."
 		} else {
 			title = note.Title
 		}
-		line := fmt.Sprintf("| %-5s | %-5s | %-50s |", note.Flags(), fmt.Sprintf("%d", idx+1), title)
+		line := fmt.Sprintf("| %-5s | %-5s | %-50s |", note.Flags(), fmt.Sprintf("%d", id), title)
 		if showTagsFlag {
 			tags := strings.Join(note.Tags, ", ")
 			line += fmt.Sprintf(" %-25s |", tags)
 		}
-		line += fmt.Sprintf(" %-25s |\n", note.Time.Format("2006-01-02 15:04:05"))
+		t := note.Created
+		if pageOpts.Sort == aen.SortModified {
+			t = note.LastModified()
+		}
+		line += fmt.Sprintf(" %-25s |\n", t.Format("2006-01-02 15:04:05"))
 		fmt.Print(line)
 	}
+
+	current, pages := page.Number()
+	fmt.Printf("Notes %d-%d of %d (page %d of %d)\n", page.Offset+1, page.Offset+len(page.Notes), page.Total, current, pages)
+	if len(page.Next) > 0 {
+		fmt.Printf("Next page: --cursor %s\n", page.Next)
+	}
+	return nil
 }
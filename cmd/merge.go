@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/database"
+)
+
+// mergeDatabase merges notes and recipients of another database into the database and prints a summary.
+func mergeDatabase(pathFlag, fromFlag, strategyFlag string) {
+	if fromFlag == "" {
+		log.Fatal("Error merging databases: path to other database must be given.")
+	}
+	strategy, err := database.ParseMergeStrategy(strategyFlag)
+	if err != nil {
+		log.Fatalf("Error merging databases: %v", err)
+	}
+	if same, _ := filepath.Abs(pathFlag); same != "" {
+		if other, _ := filepath.Abs(fromFlag); other == same {
+			log.Fatal("Error merging databases: cannot merge database into itself.")
+		}
+	}
+
+	db, err := aen.OpenDatabase(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	other := database.NewDatabaseInstance(fromFlag)
+	if err = other.OpenReadOnly(); err != nil {
+		log.Fatalf("Error opening database %s: %v", fromFlag, err)
+	}
+	defer other.Close()
+
+	result, err := db.Merge(other, strategy)
+	if err != nil {
+		log.Fatalf("Error merging databases: %v", err)
+	}
+
+	printSlugs := func(label string, slugs []string) {
+		if len(slugs) > 0 {
+			fmt.Printf("%-12s %s\n", label, strings.Join(slugs, ", "))
+		}
+	}
+	printSlugs("Added:", result.Added)
+	printSlugs("Updated:", result.Updated)
+	printSlugs("Conflicts:", result.Conflicts)
+	printSlugs("Copies:", result.Copies)
+	printSlugs("Recipients:", result.Recipients)
+	log.Printf("Merged %s using strategy %s: %d added, %d updated, %d conflicts, %d unchanged, %d recipients added.",
+		fromFlag, strategy, len(result.Added), len(result.Updated), len(result.Conflicts), result.Unchanged, len(result.Recipients))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+
+	"filippo.io/age"
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/agent"
+)
+
+// runNotebook opens the notebook, loads the identity if a keyfile is given and calls fn with it.
+// If fn fails, the error is printed with the given prefix and the program exits.
+func runNotebook(pathFlag, keyFlag, errPrefix string, fn func(ctx context.Context, nb *aen.Notebook) error) {
+	identity, err := loadIdentity(keyFlag)
+	if err != nil {
+		log.Fatalf("Could not load private key: %v", err)
+	}
+	nb, err := aen.Open(pathFlag, identity)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	err = fn(context.Background(), nb)
+	nb.Close()
+	if err != nil {
+		log.Printf("%s: %v", errPrefix, err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// loadIdentity returns the identity used for decrypting notes. If an agent is running, file keys are unwrapped
+// by the agent and the keyfile is not read. Without agent and keyfile, nil is returned.
+func loadIdentity(keyFlag string) (identity age.Identity, err error) {
+	if socket := os.Getenv(agent.SocketEnv); socket != "" {
+		return agent.NewIdentity(socket), nil
+	}
+	if keyFlag == "" {
+		return nil, nil
+	}
+	return aen.LoadKey(keyFlag)
+}
+
+// Exit codes for errors callers might want to handle in scripts, all other errors exit with 1.
+const (
+	exitNoteNotFound    = 2
+	exitIndexOutOfRange = 3
+	exitNoRecipients    = 4
+	exitDecryptFailed   = 5
+	exitReadOnly        = 6
+)
+
+// exitCode maps an error to the exit code of the program.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, aen.ErrNoteNotFound):
+		return exitNoteNotFound
+	case errors.Is(err, aen.ErrIndexOutOfRange):
+		return exitIndexOutOfRange
+	case errors.Is(err, aen.ErrNoRecipients):
+		return exitNoRecipients
+	case errors.Is(err, aen.ErrDecryptFailed):
+		return exitDecryptFailed
+	case errors.Is(err, aen.ErrDatabaseReadOnly):
+		return exitReadOnly
+	}
+	return 1
+}
+
+// noteRef returns the reference to a note given by slug or id.
+func noteRef(slugFlag string, idFlag uint) (ref aen.Ref, err error) {
+	if len(slugFlag) > 0 {
+		return aen.BySlug(slugFlag), nil
+	} else if idFlag > 0 {
+		return aen.ByIndex(idFlag), nil
+	}
+	return aen.Ref{}, errors.New("either slug or id must be given")
+}
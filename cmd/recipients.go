@@ -1,30 +1,21 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/3c7/aen"
 )
 
 // listRecipients lists all recipients or remove a recipient with a specific alias
-func listRecipients(pathFlag, aliasFlag string) {
-	db, err := aen.OpenDatabase(pathFlag, false)
-	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
-	}
-	defer db.Close()
-
+func listRecipients(ctx context.Context, nb *aen.Notebook, aliasFlag string) error {
 	if aliasFlag != "" {
-		err = db.RemoveRecipientByAlias(aliasFlag)
-		if err != nil {
-			log.Fatalf("Error removing recipient %s: %v", aliasFlag, err)
-		}
-		return
+		return nb.RemoveRecipient(ctx, aliasFlag)
 	}
 
-	recipients, err := db.GetRecipients()
+	recipients, err := nb.Recipients(ctx)
 	if err != nil {
-		log.Fatalf("Error loading recipients: %v", err)
+		return err
 	}
 	if len(recipients) == 0 {
 		// Should not really be the case, but anyway...
@@ -35,4 +26,5 @@ func listRecipients(pathFlag, aliasFlag string) {
 			log.Printf("| %-20s | %-62s |", r.Alias, r.Publickey)
 		}
 	}
+	return nil
 }
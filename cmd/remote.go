@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/remote"
+)
+
+// addRemote configures a directory as remote.
+func addRemote(pathFlag, name, dir string) {
+	db, err := aen.OpenStore(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	if err = remote.Add(db, name, dir); err != nil {
+		log.Fatalf("Error adding remote: %v", err)
+	}
+	log.Printf("Added remote %s.", name)
+}
+
+// removeRemote removes a remote, the directory itself is kept.
+func removeRemote(pathFlag, name string) {
+	db, err := aen.OpenStore(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	if err = remote.Remove(db, name); err != nil {
+		log.Fatalf("Error removing remote: %v", err)
+	}
+	log.Printf("Removed remote %s.", name)
+}
+
+// listRemotes prints all configured remotes.
+func listRemotes(pathFlag string) {
+	db, err := aen.OpenStore(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	remotes, err := remote.List(db)
+	if err != nil {
+		log.Fatalf("Error listing remotes: %v", err)
+	}
+	for _, r := range remotes {
+		fmt.Printf("%-16s %s\n", r.Name, r.Dir)
+	}
+}
+
+// syncRemote pushes notes to or pulls notes from a remote and prints a summary.
+func syncRemote(pathFlag, remoteFlag string, push, forceFlag bool) {
+	db, err := aen.OpenStore(pathFlag, false)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	r, err := remote.Get(db, remoteFlag)
+	if err != nil {
+		log.Fatalf("Error loading remote: %v", err)
+	}
+
+	action, sync := "Pulled from", remote.Pull
+	if push {
+		action, sync = "Pushed to", remote.Push
+	}
+	result, err := sync(db, r, forceFlag)
+	if err != nil {
+		log.Fatalf("Error syncing with remote %s: %v", r.Name, err)
+	}
+
+	printSlugs := func(label string, slugs []string) {
+		if len(slugs) > 0 {
+			fmt.Printf("%-12s %s\n", label, strings.Join(slugs, ", "))
+		}
+	}
+	printSlugs("Added:", result.Added)
+	printSlugs("Updated:", result.Updated)
+	printSlugs("Deleted:", result.Deleted)
+	printSlugs("Conflicts:", result.Conflicts)
+	log.Printf("%s %s: %d added, %d updated, %d deleted, %d conflicts.",
+		action, r.Name, len(result.Added), len(result.Updated), len(result.Deleted), len(result.Conflicts))
+	if len(result.Conflicts) > 0 {
+		log.Fatal("Notes changed on both sides were skipped, use --force to overwrite them.")
+	}
+}
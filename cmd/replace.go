@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/3c7/aen"
+)
+
+// replaceContent replaces the content of a note by the content of a file, "-" reads the content from stdin.
+// UUID, title, tags and attachments are kept.
+func replaceContent(ctx context.Context, nb *aen.Notebook, ref aen.Ref, fileFlag string) error {
+	if fileFlag == "" {
+		return errors.New("no file given")
+	}
+	file, err := openInput(fileFlag)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encryptedNote, err := nb.Replace(ctx, ref, file)
+	if err != nil {
+		return err
+	}
+	log.Printf("Replaced content of note %s.", encryptedNote.Slug())
+	return nil
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/rpc"
+)
+
+// serveStdio answers JSON-RPC requests read from stdin until stdin is closed. Log messages go to stderr, so they
+// don't interfere with the responses.
+func serveStdio(ctx context.Context, nb *aen.Notebook) error {
+	log.Println("Serving notes via stdio.")
+	return rpc.NewServer(nb).Serve(ctx, os.Stdin, os.Stdout)
+}
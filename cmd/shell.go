@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/agent"
+	"github.com/3c7/aen/internal/editor"
+	"github.com/3c7/aen/internal/shell"
+	"github.com/3c7/aen/internal/utils"
+	uuid "github.com/google/uuid"
+)
+
+// shellCommands are handled inside the shell, all other subcommands are run as separate process.
+var shellCommands = []string{
+	"add", "append", "attach", "create", "edit", "exit", "get", "help", "list", "lock", "quick", "recipients", "remove",
+	"tag", "unlock", "write",
+}
+
+// errLocked is returned by commands requiring the identity while the shell is locked.
+var errLocked = errors.New("the private key is locked, enter \"unlock\" to load it again")
+
+// shellAliases maps the short names of the subcommands handled inside the shell to their long names.
+var shellAliases = map[string]string{
+	"a": "add", "ap": "append", "at": "attach", "cr": "create", "ed": "edit", "quit": "exit", "g": "get", "?": "help",
+	"ls": "list", "q": "quick", "re": "recipients", "rm": "remove", "del": "remove", "t": "tag", "wr": "write",
+}
+
+// shellSession keeps the notebook open and the identity loaded between the commands of the shell.
+type shellSession struct {
+	nb        *aen.Notebook
+	path, key string
+	editorCmd editor.Command
+	handlers  map[string]editor.Command
+	lockAfter time.Duration
+	in        *bufio.Reader // input of the line editor, commands read answers from it
+
+	// mu is held while a command runs, so the identity is not locked in the middle of it
+	mu     sync.Mutex
+	locked bool
+	timer  *time.Timer
+
+	// cancel cancels the context of the running command on interrupts, it is nil between commands
+	cancelMu    sync.Mutex
+	cancel      context.CancelFunc
+	interactive bool
+
+	// Session numbers stay the same while the shell runs, even if notes are added or removed
+	numbers map[uuid.UUID]uint
+	uuids   []uuid.UUID
+}
+
+// runShell reads commands until the input ends or "exit" is entered. The identity is dropped after being
+// inactive for lockAfter and only loaded again by the "unlock" command. Interrupts cancel the running command
+// instead of ending the shell.
+func runShell(pathFlag, keyFlag string, editorCmd editor.Command, handlers map[string]editor.Command, lockAfter time.Duration) {
+	identity, err := loadIdentity(keyFlag)
+	if err != nil {
+		log.Fatalf("Could not load private key: %v", err)
+	}
+	nb, err := aen.Open(pathFlag, identity)
+	if err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	s := &shellSession{nb: nb, path: pathFlag, key: keyFlag, editorCmd: editorCmd, handlers: handlers, lockAfter: lockAfter, numbers: map[uuid.UUID]uint{}}
+	defer func() { s.nb.Close() }()
+	if err = s.numberNotes(context.Background()); err != nil {
+		log.Fatalf("Error listing notes: %v", err)
+	}
+
+	editor := shell.NewEditor(os.Stdin, os.Stdout)
+	editor.Complete = s.complete
+	s.in = editor.Reader()
+	if editor.Interactive {
+		log.Println("Type \"help\" for a list of commands, Tab completes commands, slugs and tags.")
+	}
+	s.interactive = editor.Interactive
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	go func() {
+		for range signals {
+			s.interrupt()
+		}
+	}()
+	if lockAfter > 0 {
+		s.timer = time.AfterFunc(lockAfter, s.lock)
+	}
+	for {
+		prompt := "aen> "
+		s.mu.Lock()
+		if s.locked {
+			prompt = "aen (locked)> "
+		}
+		s.mu.Unlock()
+		line, err := editor.ReadLine(prompt)
+		if errors.Is(err, shell.ErrInterrupted) {
+			continue
+		} else if err == io.EOF {
+			return
+		} else if err != nil {
+			log.Fatalf("Error reading command: %v", err)
+		}
+		args, err := utils.Split(line)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if exit := s.run(args); exit {
+			return
+		}
+	}
+}
+
+// interrupt cancels the running command. Without running command, the shell is left if it reads a script, while
+// interactive shells read Ctrl-C as key press anyway.
+func (s *shellSession) interrupt() {
+	s.cancelMu.Lock()
+	defer s.cancelMu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	} else if !s.interactive {
+		s.nb.Close()
+		log.Fatal("Interrupted.")
+	}
+}
+
+// lock drops the identity, it is called by the timer after being inactive. Go offers no way to wipe the key, so
+// the key material stays in the heap until it is garbage collected, but it is not used anymore by the shell and
+// the processes it starts.
+func (s *shellSession) lock() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.locked {
+		s.nb.SetIdentity(nil)
+		s.locked = true
+	}
+}
+
+// unlock loads the identity again if it was dropped, it is only called by the "unlock" command.
+func (s *shellSession) unlock() error {
+	if !s.locked {
+		log.Println("Identity is not locked.")
+		return nil
+	}
+	identity, err := loadIdentity(s.key)
+	if err != nil {
+		return fmt.Errorf("could not load private key: %v", err)
+	}
+	s.nb.SetIdentity(identity)
+	s.locked = false
+	log.Println("Identity unlocked.")
+	return nil
+}
+
+// numberNotes assigns session numbers to all notes not numbered yet, newest first like "aen list".
+func (s *shellSession) numberNotes(ctx context.Context) error {
+	page, err := s.nb.List(ctx, aen.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range page.Notes {
+		s.number(&page.Notes[i])
+	}
+	return nil
+}
+
+// number returns the session number of the note, a new number is assigned if the note wasn't numbered yet.
+func (s *shellSession) number(note *aen.EncryptedNote) uint {
+	if n, ok := s.numbers[note.Uuid]; ok {
+		return n
+	}
+	s.uuids = append(s.uuids, note.Uuid)
+	s.numbers[note.Uuid] = uint(len(s.uuids))
+	return uint(len(s.uuids))
+}
+
+// ref returns the reference to a note given by slug or session number.
+func (s *shellSession) ref(slugFlag string, idFlag uint) (aen.Ref, error) {
+	if len(slugFlag) > 0 {
+		return aen.BySlug(slugFlag), nil
+	} else if idFlag > 0 {
+		if int(idFlag) > len(s.uuids) {
+			return aen.Ref{}, fmt.Errorf("%w: note %d is not known in this session, see \"list\"", aen.ErrIndexOutOfRange, idFlag)
+		}
+		return aen.ByUuid(s.uuids[idFlag-1]), nil
+	}
+	return aen.Ref{}, errors.New("either slug or id must be given")
+}
+
+// complete returns the commands for the first word, tags after tag flags and slugs otherwise.
+func (s *shellSession) complete(line string) (candidates []string) {
+	words := strings.Fields(line)
+	if len(words) == 0 || (len(words) == 1 && !strings.HasSuffix(line, " ")) {
+		return shellCommands
+	}
+	previous := words[len(words)-1]
+	if !strings.HasSuffix(line, " ") && len(words) > 1 {
+		previous = words[len(words)-2]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page, err := s.nb.List(context.Background(), aen.ListOptions{})
+	if err != nil {
+		return nil
+	}
+	unique := map[string]bool{}
+	tagFlags := map[string]bool{"-t": true, "--tag": true, "-a": true, "--add": true, "-r": true, "--remove": true}
+	for _, note := range page.Notes {
+		if tagFlags[previous] {
+			for _, tag := range note.Tags {
+				unique[tag] = true
+			}
+		} else {
+			unique[note.Slug()] = true
+		}
+	}
+	for candidate := range unique {
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// run executes a command and returns true if the shell should exit.
+func (s *shellSession) run(args []string) (exit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+		defer s.timer.Reset(s.lockAfter)
+	}
+
+	name := args[0]
+	if long, ok := shellAliases[name]; ok {
+		name = long
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelMu.Lock()
+	s.cancel = cancel
+	s.cancelMu.Unlock()
+	defer func() {
+		s.cancelMu.Lock()
+		s.cancel = nil
+		s.cancelMu.Unlock()
+		cancel()
+	}()
+	var err error
+	switch name {
+	case "exit":
+		return true
+	case "help":
+		fmt.Printf("Commands: %s\n", strings.Join(shellCommands, ", "))
+		fmt.Println("IDs are session numbers shown by \"list\". Other subcommands of aen are run as separate process.")
+	case "lock":
+		s.nb.SetIdentity(nil)
+		s.locked = true
+		log.Println("Identity locked.")
+	case "unlock":
+		err = s.unlock()
+	case "append", "attach", "edit", "get", "quick":
+		if s.locked {
+			err = errLocked
+		} else {
+			err = s.runCommand(ctx, name, args[1:])
+		}
+	case "add", "create", "list", "recipients", "remove", "tag", "write":
+		err = s.runCommand(ctx, name, args[1:])
+	case "shell", "sh":
+		err = errors.New("the shell is already running")
+	default:
+		err = s.runExternal(args)
+	}
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Printf("Error: %v", err)
+	}
+	return false
+}
+
+// runCommand parses the flags of a subcommand handled inside the shell and runs it.
+func (s *shellSession) runCommand(ctx context.Context, name string, args []string) error {
+	var (
+		slugFlag, titleFlag, messageFlag, fileFlag, tagFlag, aliasFlag, cursorFlag, addFlag, removeFlag string
+		attachmentFlag, outdirFlag, sortFlag, templateFlag                                              string
+		idFlag                                                                                          uint
+		limitFlag, offsetFlag, pageFlag                                                                 int
+		rawFlag, shredFlag, createFlag, allFlag, showTagsFlag, forceFlag, timestampFlag                 bool
+	)
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	stringFlag := func(p *string, long, short, usage string) {
+		flags.StringVar(p, long, "", usage)
+		flags.StringVar(p, short, "", usage)
+	}
+	boolFlag := func(p *bool, long, short, usage string) {
+		flags.BoolVar(p, long, false, usage)
+		flags.BoolVar(p, short, false, usage)
+	}
+	refFlags := func() {
+		stringFlag(&slugFlag, "slug", "s", "Slug for note")
+		flags.UintVar(&idFlag, "id", 0, "Session number of note")
+		flags.UintVar(&idFlag, "i", 0, "Session number of note")
+	}
+	switch name {
+	case "add":
+		stringFlag(&fileFlag, "file", "f", "Path to file")
+		stringFlag(&titleFlag, "title", "t", "Title of the note (default: filename)")
+	case "append":
+		refFlags()
+		stringFlag(&messageFlag, "message", "m", "Text to append")
+		boolFlag(&timestampFlag, "timestamp", "T", "Prefix the text with the current time")
+		boolFlag(&createFlag, "create", "c", "Create note if not available")
+	case "attach":
+		stringFlag(&fileFlag, "file", "f", "Path to file")
+		stringFlag(&titleFlag, "name", "n", "Optional new filename")
+		refFlags()
+	case "create":
+		boolFlag(&shredFlag, "shred", "S", "Ignored, temporary files are always shredded")
+		stringFlag(&templateFlag, "template", "t", "Name of the template to start with")
+	case "edit":
+		refFlags()
+		boolFlag(&shredFlag, "shred", "S", "Ignored, temporary files are always shredded")
+		boolFlag(&createFlag, "create", "c", "Create note if not available")
+	case "get":
+		refFlags()
+		boolFlag(&rawFlag, "raw", "r", "Only print note content")
+		stringFlag(&fileFlag, "output", "o", "Path to output file")
+		stringFlag(&attachmentFlag, "attachment", "a", "Filename of attachment to get")
+		flags.StringVar(&outdirFlag, "outdir", "", "Directory files are written to")
+		flags.BoolVar(&forceFlag, "force", false, "Overwrite existing files")
+	case "list":
+		stringFlag(&tagFlag, "tag", "t", "Tag to filter for")
+		boolFlag(&allFlag, "all", "a", "Display all notes")
+		flags.BoolVar(&showTagsFlag, "show-tags", false, "Display tags")
+		flags.IntVar(&limitFlag, "limit", 10, "Number of notes per page")
+		flags.IntVar(&limitFlag, "l", 10, "Number of notes per page")
+		flags.IntVar(&offsetFlag, "offset", 0, "Number of notes to skip")
+		flags.IntVar(&offsetFlag, "o", 0, "Number of notes to skip")
+		flags.IntVar(&pageFlag, "page", 0, "Page to display")
+		flags.IntVar(&pageFlag, "p", 0, "Page to display")
+		stringFlag(&cursorFlag, "cursor", "c", "Cursor token of the previous page")
+		flags.StringVar(&sortFlag, "sort", "created", "Time to sort by, created or modified")
+	case "recipients":
+		stringFlag(&aliasFlag, "remove", "r", "Remove recipient with this alias")
+	case "remove":
+		refFlags()
+	case "tag":
+		refFlags()
+		stringFlag(&addFlag, "add", "a", "Comma separated list of tags to add")
+		stringFlag(&removeFlag, "remove", "r", "Comma separated list of tags to remove")
+	case "write":
+		stringFlag(&titleFlag, "title", "t", "Title of the note")
+		stringFlag(&messageFlag, "message", "m", "Message of the note")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if fileFlag == "" && (name == "add" || name == "attach") {
+		fileFlag = flags.Arg(0)
+	}
+	// Stdin belongs to the shell, which may read its commands from a script
+	if fileFlag == "-" && (name == "add" || name == "attach") {
+		return errors.New("files cannot be read from stdin in the shell")
+	}
+
+	ref, refErr := s.ref(slugFlag, idFlag)
+	var err error
+	switch name {
+	case "add":
+		err = addFile(ctx, s.nb, fileFlag, titleFlag)
+	case "append":
+		if refErr != nil {
+			return refErr
+		}
+		// Stdin belongs to the shell, which may read its commands from a script
+		err = appendNote(ctx, s.nb, ref, messageFlag, false, timestampFlag, createFlag)
+	case "attach":
+		if refErr != nil {
+			return refErr
+		}
+		err = attachFile(ctx, s.nb, fileFlag, titleFlag, ref)
+	case "create":
+		err = createNote(ctx, s.nb, s.in, s.editorCmd, templateFlag)
+	case "edit":
+		if refErr != nil {
+			return refErr
+		}
+		err = editNote(ctx, s.nb, ref, s.in, s.editorCmd, s.handlers, createFlag)
+	case "get":
+		if refErr != nil {
+			return refErr
+		}
+		err = getNote(ctx, s.nb, ref, fileFlag, outdirFlag, attachmentFlag, rawFlag, forceFlag)
+	case "list":
+		pageOpts, err := pageOptions(limitFlag, offsetFlag, pageFlag, cursorFlag, sortFlag, allFlag)
+		if err != nil {
+			return err
+		}
+		return listNotes(ctx, s.nb, tagFlag, showTagsFlag, pageOpts, s.number)
+	case "quick":
+		err = editNote(ctx, s.nb, aen.BySlug("quicknote"), s.in, s.editorCmd, nil, true)
+	case "recipients":
+		err = listRecipients(ctx, s.nb, aliasFlag)
+	case "remove":
+		if refErr != nil {
+			return refErr
+		}
+		err = deleteNote(ctx, s.nb, ref)
+	case "tag":
+		if refErr != nil {
+			return refErr
+		}
+		err = manipulateTags(ctx, s.nb, ref, addFlag, removeFlag)
+	case "write":
+		if len(titleFlag) == 0 || len(messageFlag) == 0 {
+			return errors.New("title and message must be given")
+		}
+		err = writeNote(ctx, s.nb, titleFlag, messageFlag)
+	}
+	if err != nil {
+		return err
+	}
+	// New notes get the next session numbers
+	return s.numberNotes(ctx)
+}
+
+// runExternal runs a subcommand not handled inside the shell as separate process. The database is closed
+// meanwhile, as bolt does not allow opening it twice. While the shell is locked, neither the keyfile nor the agent
+// is passed to the process.
+func (s *shellSession) runExternal(args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err = s.nb.Close(); err != nil {
+		return err
+	}
+	cmd := exec.Command(executable, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if s.locked {
+		cmd.Env = append(withoutEnv(os.Environ(), "AENKEY", agent.SocketEnv), "AENDB="+s.path)
+	} else {
+		cmd.Env = append(os.Environ(), "AENDB="+s.path, "AENKEY="+s.key)
+	}
+	runErr := cmd.Run()
+
+	var identity age.Identity
+	if !s.locked {
+		if identity, err = loadIdentity(s.key); err != nil {
+			identity = nil
+		}
+	}
+	if s.nb, err = aen.Open(s.path, identity); err != nil {
+		log.Fatalf("Error opening database: %v", err)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		// The process already printed the error
+		return nil
+	}
+	return runErr
+}
+
+// withoutEnv returns the environment without the variables with the given names.
+func withoutEnv(env []string, names ...string) (filtered []string) {
+	for _, variable := range env {
+		keep := true
+		for _, name := range names {
+			keep = keep && !strings.HasPrefix(variable, name+"=")
+		}
+		if keep {
+			filtered = append(filtered, variable)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/editor"
+	"github.com/3c7/aen/internal/model"
+	"github.com/3c7/aen/internal/placeholder"
+	uuid "github.com/google/uuid"
+)
+
+// templateTag marks notes used as templates for "aen create --template".
+const templateTag = "template"
+
+// findTemplate returns the note tagged as template whose title or slug is the given name.
+func findTemplate(ctx context.Context, nb *aen.Notebook, name string) (*aen.EncryptedNote, error) {
+	page, err := nb.List(ctx, aen.ListOptions{Tag: templateTag})
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Notes {
+		if page.Notes[i].Title == name || page.Notes[i].Slug() == name {
+			return &page.Notes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no template named %s, see \"aen template list\"", aen.ErrNoteNotFound, name)
+}
+
+// addTemplate stores a template read from the given file, "-" refers to stdin. Without file, the template is
+// written with the configured editor.
+func addTemplate(ctx context.Context, nb *aen.Notebook, name, fileFlag string, in *bufio.Reader, editorCmd editor.Command) error {
+	if fileFlag == "" {
+		note := model.NewNote(name, "")
+		note.Created = time.Time{}
+		note.Tags = []string{templateTag}
+		return createInEditor(ctx, nb, note, in, editorCmd)
+	}
+	file, err := openInput(fileFlag)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	text, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	encryptedNote, err := nb.Write(ctx, name, string(text), templateTag)
+	if err != nil {
+		return err
+	}
+	log.Printf("Written template %s.", encryptedNote.Slug())
+	return nil
+}
+
+// listTemplates prints the names of all templates.
+func listTemplates(ctx context.Context, nb *aen.Notebook) error {
+	page, err := nb.List(ctx, aen.ListOptions{Tag: templateTag})
+	if err != nil {
+		return err
+	}
+	if page.Total == 0 {
+		log.Println("No templates available.")
+		return nil
+	}
+	for i := range page.Notes {
+		fmt.Printf("%-25s %s\n", page.Notes[i].Slug(), page.Notes[i].Title)
+	}
+	return nil
+}
+
+// removeTemplate removes the template with the given name.
+func removeTemplate(ctx context.Context, nb *aen.Notebook, name string) error {
+	template, err := findTemplate(ctx, nb, name)
+	if err != nil {
+		return err
+	}
+	if _, err = nb.Delete(ctx, aen.ByUuid(template.Uuid)); err != nil {
+		return err
+	}
+	log.Printf("Removed template %s.", template.Slug())
+	return nil
+}
+
+// noteFromTemplate returns a new note containing the text, tags and custom fields of the template. Placeholders are
+// expanded, values of prompts are read from in, the buffered stdin shared with the shell. The title is left empty
+// and the template tag is not copied.
+func noteFromTemplate(ctx context.Context, nb *aen.Notebook, in *bufio.Reader, name string) (*model.Note, error) {
+	template, err := findTemplate(ctx, nb, name)
+	if err != nil {
+		return nil, err
+	}
+	templateNote, err := nb.Get(ctx, aen.ByUuid(template.Uuid))
+	if err != nil {
+		return nil, err
+	}
+
+	vars := placeholder.Vars{
+		Now:  time.Now(),
+		Uuid: uuid.New(),
+		Prompt: func(label string) (string, error) {
+			fmt.Fprintf(os.Stderr, "%s: ", label)
+			answer, err := in.ReadString('\n')
+			if err != nil && (err != io.EOF || answer == "") {
+				return "", err
+			}
+			return strings.TrimSpace(answer), nil
+		},
+	}
+	text, err := placeholder.Expand(templateNote.Text, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	note := model.NewNote("", text)
+	note.Uuid = vars.Uuid
+	note.Created = time.Time{}
+	note.Fields = templateNote.Fields
+	for _, tag := range templateNote.Tags {
+		if tag != templateTag {
+			note.Tags = append(note.Tags, tag)
+		}
+	}
+	return note, nil
+}
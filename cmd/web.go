@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/web"
+)
+
+// serveWeb serves the HTTP API and the web UI until the program is interrupted. The URL containing the session
+// token is printed at startup.
+func serveWeb(ctx context.Context, nb *aen.Notebook, listenFlag string, allowRemoteFlag bool) error {
+	if err := web.CheckListen(listenFlag, allowRemoteFlag); err != nil {
+		return fmt.Errorf("%v, use --allow-remote for listening on other interfaces", err)
+	}
+	token, err := web.NewToken()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", listenFlag)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	server := &http.Server{
+		Handler:     web.NewServer(nb, token),
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("Open http://%s/?token=%s\n", listener.Addr(), token)
+	log.Println("Press Ctrl+C to stop the server.")
+	if err = server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package aen
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+)
+
+// Errors returned by Notebook, wrapped in a *NoteError. Use errors.Is for checking them.
+var (
+	ErrNoteNotFound        = database.ErrNoteNotFound
+	ErrIndexOutOfRange     = database.ErrIndexOutOfRange
+	ErrDatabaseReadOnly    = database.ErrDatabaseReadOnly
+	ErrDatabaseInUse       = database.ErrDatabaseInUse
+	ErrNoRecipients        = model.ErrNoRecipients
+	ErrDecryptFailed       = model.ErrDecryptFailed
+	ErrNoteExists          = errors.New("a different note with the same slug exists")
+	ErrEmptyTitle          = errors.New("title must contain at least one letter or digit")
+	ErrNoIdentity          = errors.New("an identity is required for decrypting notes")
+	ErrFileNote            = errors.New("note contains a file")
+	ErrTextNote            = errors.New("note does not contain a file")
+	ErrDuplicateAttachment = errors.New("attachment is already present")
+	ErrTagNotFound         = model.ErrTagNotFound
+	ErrTooLarge            = model.ErrTooLarge
+)
+
+// NoteError describes a failed operation of a Notebook.
+type NoteError struct {
+	Op  string // operation, e.g. "get"
+	Ref string // reference of the note, empty if the operation does not refer to a note
+	Err error
+}
+
+func (e *NoteError) Error() string {
+	if e.Ref == "" {
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Ref, e.Err)
+}
+
+func (e *NoteError) Unwrap() error {
+	return e.Err
+}
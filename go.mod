@@ -8,5 +8,5 @@ require (
 	filippo.io/age v1.2.1
 	github.com/google/uuid v1.3.0
 	golang.org/x/crypto v0.24.0 // indirect
-	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/sys v0.21.0
 )
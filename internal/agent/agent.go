@@ -0,0 +1,217 @@
+// Package agent keeps an age identity in memory and unwraps file keys for other aen processes via a Unix
+// socket, similar to ssh-agent. The private key never leaves the agent process.
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+)
+
+// SocketEnv is the environment variable containing the path to the socket of a running agent.
+const SocketEnv = "AENAGENT"
+
+// Operations supported by the agent.
+const (
+	OpUnwrap = "unwrap"
+	OpStop   = "stop"
+)
+
+// Request is sent by clients, one JSON object per line.
+type Request struct {
+	Op      string        `json:"op"`
+	Stanzas []*age.Stanza `json:"stanzas,omitempty"`
+}
+
+// Response answers a request. If the identity does not match the stanzas, Incorrect is set.
+type Response struct {
+	FileKey   []byte `json:"fileKey,omitempty"`
+	Incorrect bool   `json:"incorrect,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DefaultSocket returns a socket path inside a directory only accessible by the current user.
+func DefaultSocket() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("aen-%d", os.Getuid()), "agent.sock")
+}
+
+// Listen creates the socket with mode 0600. The parent directory is created with mode 0700 if not available.
+// Like ssh-agent, Listen refuses to use a parent directory which is a symlink, is not owned by the current user or
+// is accessible by others, so no other user can replace the socket. As the socket is only protected by its
+// directory until its mode is set, the directory is checked before listening. A stale socket of an agent which is
+// not running anymore is replaced.
+func Listen(path string) (listener *net.UnixListener, err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err = checkSocketDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	if _, err = os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("an agent is already listening on %s", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err = net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// Serve answers requests using the identity until ctx is canceled, a stop request is received or no request
+// was received for the idle timeout. A timeout of 0 disables it. The listener is closed and the socket is
+// removed afterwards.
+func Serve(ctx context.Context, listener *net.UnixListener, identity age.Identity, timeout time.Duration) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Closing the listener unblocks Accept, the socket file is removed by the listener
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	var mu sync.Mutex
+	lastUsed := time.Now()
+	if timeout > 0 {
+		go func() {
+			ticker := time.NewTicker(timeout / 10)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case now := <-ticker.C:
+					mu.Lock()
+					idle := now.Sub(lastUsed)
+					mu.Unlock()
+					if idle >= timeout {
+						cancel()
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		mu.Lock()
+		lastUsed = time.Now()
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			if stop := handle(conn, identity); stop {
+				cancel()
+			}
+		}()
+	}
+}
+
+// handle answers the requests of a single connection and returns true if the agent should stop.
+func handle(conn net.Conn, identity age.Identity) (stop bool) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req Request
+		var resp Response
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = err.Error()
+		} else {
+			switch req.Op {
+			case OpUnwrap:
+				fileKey, err := identity.Unwrap(req.Stanzas)
+				if errors.Is(err, age.ErrIncorrectIdentity) {
+					resp.Incorrect = true
+				} else if err != nil {
+					resp.Error = err.Error()
+				}
+				resp.FileKey = fileKey
+			case OpStop:
+				stop = true
+			default:
+				resp.Error = fmt.Sprintf("unknown operation %s", req.Op)
+			}
+		}
+		if err := enc.Encode(resp); err != nil || stop {
+			return stop
+		}
+	}
+	return stop
+}
+
+// Identity is an age.Identity asking the agent listening on Socket to unwrap file keys.
+type Identity struct {
+	Socket string
+}
+
+var _ age.Identity = &Identity{}
+
+// NewIdentity returns an identity using the agent listening on the given socket.
+func NewIdentity(socket string) *Identity {
+	return &Identity{Socket: socket}
+}
+
+// Unwrap implements age.Identity.
+func (i *Identity) Unwrap(stanzas []*age.Stanza) (fileKey []byte, err error) {
+	resp, err := i.call(Request{Op: OpUnwrap, Stanzas: stanzas})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Incorrect {
+		return nil, age.ErrIncorrectIdentity
+	}
+	return resp.FileKey, nil
+}
+
+// Stop asks the agent to stop.
+func (i *Identity) Stop() error {
+	_, err := i.call(Request{Op: OpStop})
+	return err
+}
+
+func (i *Identity) call(req Request) (resp Response, err error) {
+	conn, err := net.DialTimeout("unix", i.Socket, 5*time.Second)
+	if err != nil {
+		return Response{}, fmt.Errorf("could not connect to agent: %w", err)
+	}
+	defer conn.Close()
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return Response{}, err
+	}
+	if err = json.NewDecoder(bufio.NewReader(conn)).Decode(&resp); err != nil {
+		return Response{}, fmt.Errorf("could not read response of agent: %w", err)
+	}
+	if resp.Error != "" {
+		return Response{}, fmt.Errorf("agent: %s", resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,121 @@
+package agent_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/agent"
+)
+
+// Starts an agent for a new identity and returns the identity and the socket path
+func startAgent(t *testing.T, timeout time.Duration) (identity *age.X25519Identity, socket string, done chan error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	// t.TempDir may exceed the maximum length of socket paths
+	dir, err := os.MkdirTemp("", "aen")
+	if err != nil {
+		t.Fatalf("Could not create directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket = filepath.Join(dir, "sub", "agent.sock")
+	listener, err := agent.Listen(socket)
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Socket should only be accessible by the owner: %v, %v", info.Mode(), err)
+	}
+	done = make(chan error, 1)
+	go func() { done <- agent.Serve(context.Background(), listener, identity, timeout) }()
+	return identity, socket, done
+}
+
+func encrypt(t *testing.T, recipient age.Recipient, text string) []byte {
+	out := &bytes.Buffer{}
+	w, err := age.Encrypt(out, recipient)
+	if err != nil {
+		t.Fatalf("Could not encrypt: %v", err)
+	}
+	io.WriteString(w, text)
+	w.Close()
+	return out.Bytes()
+}
+
+func TestAgentUnwrap(t *testing.T) {
+	identity, socket, done := startAgent(t, 0)
+	client := agent.NewIdentity(socket)
+
+	r, err := age.Decrypt(bytes.NewReader(encrypt(t, identity.Recipient(), "secret")), client)
+	if err != nil {
+		t.Fatalf("Could not decrypt via agent: %v", err)
+	}
+	if text, _ := io.ReadAll(r); string(text) != "secret" {
+		t.Fatalf("Unexpected plaintext: %s", text)
+	}
+
+	other, _ := age.GenerateX25519Identity()
+	if _, err = age.Decrypt(bytes.NewReader(encrypt(t, other.Recipient(), "other")), client); err == nil {
+		t.Fatal("Decrypting for another recipient should fail")
+	}
+
+	if err = client.Stop(); err != nil {
+		t.Fatalf("Could not stop agent: %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("Agent failed: %v", err)
+	}
+	if _, err = os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatalf("Socket should have been removed: %v", err)
+	}
+}
+
+func TestAgentIdleTimeout(t *testing.T) {
+	_, _, done := startAgent(t, 50*time.Millisecond)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Agent failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Agent should have stopped after the idle timeout")
+	}
+}
+
+func TestListenRejectsUnsafeDirectory(t *testing.T) {
+	dir, err := os.MkdirTemp("", "aen")
+	if err != nil {
+		t.Fatalf("Could not create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	shared := filepath.Join(dir, "shared")
+	if err = os.Mkdir(shared, 0700); err != nil {
+		t.Fatalf("Could not create directory: %v", err)
+	}
+	if err = os.Chmod(shared, 0755); err != nil {
+		t.Fatalf("Could not change mode: %v", err)
+	}
+	if _, err = agent.Listen(filepath.Join(shared, "agent.sock")); err == nil {
+		t.Fatal("Listening in a directory accessible by others should fail")
+	}
+
+	private := filepath.Join(dir, "private")
+	if err = os.Mkdir(private, 0700); err != nil {
+		t.Fatalf("Could not create directory: %v", err)
+	}
+	link := filepath.Join(dir, "link")
+	if err = os.Symlink(private, link); err != nil {
+		t.Fatalf("Could not create symlink: %v", err)
+	}
+	if _, err = agent.Listen(filepath.Join(link, "agent.sock")); err == nil {
+		t.Fatal("Listening in a symlinked directory should fail")
+	}
+}
@@ -0,0 +1,19 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkSocketDir returns an error unless dir is a directory. Owner and mode can not be checked on this platform,
+// access is controlled by the ACL of the directory.
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/3c7/aen/internal/database"
+)
+
+// ManifestName is the name of the file inside a backup directory which lists all backups and their hashes.
+const ManifestName = "manifest.json"
+
+type Entry struct {
+	Filename string
+	Created  time.Time
+	Size     int64
+	Sha256   string
+}
+
+type Manifest struct {
+	Backups []Entry
+}
+
+// Result describes the outcome of verifying a single backup file.
+type Result struct {
+	Filename string
+	Notes    int
+	Err      error
+}
+
+// ReadManifest reads the manifest of a backup directory. If no manifest is available, an empty one is returned.
+func ReadManifest(dir string) (manifest *Manifest, err error) {
+	buf, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Manifest{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	manifest = &Manifest{}
+	if err = json.Unmarshal(buf, manifest); err != nil {
+		return nil, fmt.Errorf("could not parse manifest: %v", err)
+	}
+	return manifest, nil
+}
+
+// Write stores the manifest in the given directory. The file is replaced atomically.
+func (m *Manifest) Write(dir string) (err error) {
+	buf, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".manifest*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, ManifestName))
+}
+
+// Create writes a snapshot of the open database to the directory dir and records it in the manifest.
+// Afterwards only the newest keep backups are retained, if keep is 0 no backup is removed.
+func Create(db *database.Database, dir string, keep int) (entry Entry, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return Entry{}, err
+	}
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry.Created = time.Now()
+	entry.Filename = availableFilename(dir, entry.Created)
+
+	tmp, err := os.CreateTemp(dir, ".backup*")
+	if err != nil {
+		return Entry{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	entry.Size, err = db.WriteTo(io.MultiWriter(tmp, hash))
+	if err != nil {
+		tmp.Close()
+		return Entry{}, fmt.Errorf("could not write snapshot: %v", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return Entry{}, err
+	}
+	if err = tmp.Close(); err != nil {
+		return Entry{}, err
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(dir, entry.Filename)); err != nil {
+		return Entry{}, err
+	}
+	entry.Sha256 = hex.EncodeToString(hash.Sum(nil))
+
+	manifest.Backups = append(manifest.Backups, entry)
+	removed := manifest.rotate(keep)
+	if err = manifest.Write(dir); err != nil {
+		return Entry{}, err
+	}
+	for _, old := range removed {
+		if err = os.Remove(filepath.Join(dir, old.Filename)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return entry, fmt.Errorf("could not remove old backup %s: %v", old.Filename, err)
+		}
+	}
+	return entry, nil
+}
+
+// rotate removes all but the newest keep entries from the manifest and returns the removed entries.
+func (m *Manifest) rotate(keep int) (removed []Entry) {
+	sort.Slice(m.Backups, func(i, j int) bool {
+		return m.Backups[i].Created.Before(m.Backups[j].Created)
+	})
+	if keep <= 0 || len(m.Backups) <= keep {
+		return nil
+	}
+	removed = append(removed, m.Backups[:len(m.Backups)-keep]...)
+	m.Backups = m.Backups[len(m.Backups)-keep:]
+	return removed
+}
+
+func availableFilename(dir string, t time.Time) string {
+	base := "aen-" + t.Format("20060102-150405")
+	name := base + ".db"
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filepath.Join(dir, name)); errors.Is(err, os.ErrNotExist) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d.db", base, i)
+	}
+}
+
+// VerifyFile checks that the given file can be opened as database and all records can be parsed.
+// It returns the number of notes found.
+func VerifyFile(path string) (notes int, err error) {
+	if _, err = os.Stat(path); err != nil {
+		return 0, err
+	}
+	db := database.NewDatabaseInstance(path)
+	if err = db.OpenReadOnly(); err != nil {
+		return 0, fmt.Errorf("could not open database: %v", err)
+	}
+	defer db.Close()
+	return db.VerifyRecords()
+}
+
+// Verify checks all backups listed in the manifest of the directory dir. Besides the checks of VerifyFile,
+// the SHA-256 hash of each file is compared to the one recorded in the manifest.
+func Verify(dir string) (results []Result, err error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Backups) == 0 {
+		return nil, fmt.Errorf("no backups listed in %s", filepath.Join(dir, ManifestName))
+	}
+	for _, entry := range manifest.Backups {
+		result := Result{Filename: entry.Filename}
+		path := filepath.Join(dir, entry.Filename)
+		hash, err := fileSha256(path)
+		if err != nil {
+			result.Err = err
+		} else if hash != entry.Sha256 {
+			result.Err = fmt.Errorf("SHA-256 mismatch: is %s but should be %s", hash, entry.Sha256)
+		} else {
+			result.Notes, result.Err = VerifyFile(path)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func fileSha256(path string) (hash string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
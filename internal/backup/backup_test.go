@@ -0,0 +1,87 @@
+package backup_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/3c7/aen/internal/backup"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+)
+
+func TestBackupRotation(t *testing.T) {
+	db := database.NewDatabaseInstance(filepath.Join(t.TempDir(), "notes.db"))
+	if err := db.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	note := model.EncryptedNote{
+		Title:      "Backup me",
+		Ciphertext: "Imagine some base64 encoded ciphertext here.",
+	}
+	if err := db.SaveEncryptedNote(&note); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+	defer db.Close()
+	dir := t.TempDir()
+
+	for i := 0; i < 4; i++ {
+		if _, err := backup.Create(db, dir, 2); err != nil {
+			t.Fatalf("Could not create backup: %v", err)
+		}
+	}
+
+	manifest, err := backup.ReadManifest(dir)
+	if err != nil {
+		t.Fatalf("Could not read manifest: %v", err)
+	}
+	if len(manifest.Backups) != 2 {
+		t.Fatalf("Manifest should contain 2 backups but contained %d", len(manifest.Backups))
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Directory should contain 2 backups but contained %d", len(files))
+	}
+}
+
+func TestBackupVerify(t *testing.T) {
+	db := database.NewDatabaseInstance(filepath.Join(t.TempDir(), "notes.db"))
+	if err := db.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	note := model.EncryptedNote{
+		Title:      "Backup me",
+		Ciphertext: "Imagine some base64 encoded ciphertext here.",
+	}
+	if err := db.SaveEncryptedNote(&note); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+	defer db.Close()
+	dir := t.TempDir()
+
+	entry, err := backup.Create(db, dir, 0)
+	if err != nil {
+		t.Fatalf("Could not create backup: %v", err)
+	}
+	results, err := backup.Verify(dir)
+	if err != nil {
+		t.Fatalf("Could not verify backups: %v", err)
+	}
+	if len(results) != 1 || results[0].Err != nil || results[0].Notes != 1 {
+		t.Fatalf("Backup should be valid and contain one note: %+v", results)
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, entry.Filename), []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	results, err = backup.Verify(dir)
+	if err != nil {
+		t.Fatalf("Could not verify backups: %v", err)
+	}
+	if results[0].Err == nil {
+		t.Fatal("Verifying a modified backup should fail")
+	}
+}
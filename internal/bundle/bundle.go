@@ -0,0 +1,314 @@
+package bundle
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+	uuid "github.com/google/uuid"
+)
+
+// Version of the bundle format
+const Version = 1
+
+const (
+	markerKey      = "bundle-marker"          // sequence number of the latest marker
+	markerPrefix   = "bundle-marker-"         // state of the notes at a marker, suffixed by the sequence number
+	trustedKey     = "bundle-trusted"         // public keys of trusted senders
+	appliedPrefix  = "bundle-applied-"        // last sequence applied, suffixed by the public key of the sender
+	signingContext = "aen bundle signing key" // domain separation for deriving the signing key
+)
+
+// Payload contains the changes of a bundle. The Source is the public signing key of the sender, Since references
+// the marker the changes are based on and Sequence is the marker created for this bundle.
+type Payload struct {
+	Version    int
+	Source     string
+	Sequence   uint64
+	Since      uint64
+	Created    time.Time
+	Notes      []model.EncryptedNote
+	Deleted    []uuid.UUID
+	Recipients []model.Recipient
+}
+
+// Bundle is the file written by Create. The payload is kept as raw bytes, so the signature can be checked
+// before parsing it.
+type Bundle struct {
+	Payload   []byte
+	Sha256    string
+	Signature []byte
+}
+
+// Marker records the state of the notes when a bundle was created, so later bundles only contain changes.
+type Marker struct {
+	Sequence uint64
+	Created  time.Time
+	Hashes   map[uuid.UUID]string
+}
+
+// SigningKey derives the ed25519 key used for signing bundles from the age identity.
+func SigningKey(identity *age.X25519Identity) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte(signingContext + "\x00" + identity.String()))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// PublicKeyString encodes the public part of the signing key, as used for --trust.
+func PublicKeyString(key ed25519.PrivateKey) string {
+	return base64.RawStdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+func noteHash(note *model.EncryptedNote) (hash string, err error) {
+	buf, err := json.Marshal(note)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(buf)
+	return hex.EncodeToString(h[:]), nil
+}
+
+func readMarker(db database.Store, sequence uint64) (marker *Marker, err error) {
+	marker = &Marker{Hashes: map[uuid.UUID]string{}}
+	if sequence == 0 {
+		return marker, nil
+	}
+	buf, err := db.GetConfig(fmt.Sprintf("%s%d", markerPrefix, sequence))
+	if err != nil {
+		return nil, err
+	}
+	if buf == nil {
+		return nil, fmt.Errorf("marker %d not available", sequence)
+	}
+	return marker, json.Unmarshal(buf, marker)
+}
+
+// LatestMarker returns the sequence number of the latest marker, 0 if no bundle was created yet.
+func LatestMarker(db database.Store) (sequence uint64, err error) {
+	buf, err := db.GetConfig(markerKey)
+	if err != nil || buf == nil {
+		return 0, err
+	}
+	return sequence, json.Unmarshal(buf, &sequence)
+}
+
+// Create builds a signed bundle containing all notes changed or added since the given marker and the UUIDs of
+// the notes deleted since then. A new marker is stored in the config bucket, once the bundle was written.
+// Using marker 0 includes all notes.
+func Create(db database.Store, identity *age.X25519Identity, since uint64, path string) (payload *Payload, err error) {
+	latest, err := LatestMarker(db)
+	if err != nil {
+		return nil, err
+	}
+	if since > latest {
+		return nil, fmt.Errorf("marker %d does not exist, the latest marker is %d", since, latest)
+	}
+	base, err := readMarker(db, since)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := db.GetAllEncryptedNotes()
+	if err != nil {
+		return nil, err
+	}
+	recipients, err := db.GetRecipients()
+	if err != nil {
+		return nil, err
+	}
+
+	key := SigningKey(identity)
+	payload = &Payload{
+		Version:    Version,
+		Source:     PublicKeyString(key),
+		Sequence:   latest + 1,
+		Since:      since,
+		Created:    time.Now(),
+		Recipients: recipients,
+	}
+	marker := Marker{
+		Sequence: payload.Sequence,
+		Created:  payload.Created,
+		Hashes:   map[uuid.UUID]string{},
+	}
+	for i := range notes {
+		hash, err := noteHash(&notes[i])
+		if err != nil {
+			return nil, err
+		}
+		marker.Hashes[notes[i].Uuid] = hash
+		if base.Hashes[notes[i].Uuid] != hash {
+			payload.Notes = append(payload.Notes, notes[i])
+		}
+	}
+	for id := range base.Hashes {
+		if _, ok := marker.Hashes[id]; !ok {
+			payload.Deleted = append(payload.Deleted, id)
+		}
+	}
+	sort.Slice(payload.Deleted, func(i, j int) bool { return payload.Deleted[i].String() < payload.Deleted[j].String() })
+
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(buf)
+	bundle := Bundle{
+		Payload:   buf,
+		Sha256:    hex.EncodeToString(hash[:]),
+		Signature: ed25519.Sign(key, buf),
+	}
+	bundleJson, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(path, bundleJson, 0600); err != nil {
+		return nil, err
+	}
+
+	markerJson, err := json.Marshal(marker)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.SetConfig(fmt.Sprintf("%s%d", markerPrefix, marker.Sequence), markerJson); err != nil {
+		return nil, err
+	}
+	sequenceJson, err := json.Marshal(marker.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	return payload, db.SetConfig(markerKey, sequenceJson)
+}
+
+// Read reads a bundle and checks its hash and signature. The payload is only returned if both are valid,
+// whether the sender is trusted is checked by Apply.
+func Read(path string) (payload *Payload, err error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var bundle Bundle
+	if err = json.Unmarshal(buf, &bundle); err != nil {
+		return nil, fmt.Errorf("could not parse bundle: %v", err)
+	}
+	hash := sha256.Sum256(bundle.Payload)
+	if hex.EncodeToString(hash[:]) != bundle.Sha256 {
+		return nil, errors.New("SHA-256 hash of the bundle does not match, the bundle is corrupted")
+	}
+
+	// The source is needed to check the signature, therefore the payload is parsed first,
+	// but not returned before the signature was verified
+	payload = &Payload{}
+	if err = json.Unmarshal(bundle.Payload, payload); err != nil {
+		return nil, fmt.Errorf("could not parse bundle payload: %v", err)
+	}
+	if payload.Version != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d", payload.Version)
+	}
+	publicKey, err := base64.RawStdEncoding.DecodeString(payload.Source)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key of bundle source")
+	}
+	if !ed25519.Verify(publicKey, bundle.Payload, bundle.Signature) {
+		return nil, errors.New("invalid bundle signature")
+	}
+	return payload, nil
+}
+
+// Trusted returns the public keys of senders whose bundles are accepted.
+func Trusted(db database.Store) (keys []string, err error) {
+	buf, err := db.GetConfig(trustedKey)
+	if err != nil || buf == nil {
+		return nil, err
+	}
+	return keys, json.Unmarshal(buf, &keys)
+}
+
+// Trust adds the public key of a sender to the trusted keys.
+func Trust(db database.Store, key string) (err error) {
+	if publicKey, err := base64.RawStdEncoding.DecodeString(key); err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("invalid public key")
+	}
+	keys, err := Trusted(db)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if k == key {
+			return nil
+		}
+	}
+	buf, err := json.Marshal(append(keys, key))
+	if err != nil {
+		return err
+	}
+	return db.SetConfig(trustedKey, buf)
+}
+
+// Applied returns the sequence number of the last bundle applied from the given source.
+func Applied(db database.Store, source string) (sequence uint64, err error) {
+	buf, err := db.GetConfig(appliedPrefix + source)
+	if err != nil || buf == nil {
+		return 0, err
+	}
+	return sequence, json.Unmarshal(buf, &sequence)
+}
+
+// Apply applies a verified payload to the database. The sender must be trusted and the bundle must continue
+// the sequence of bundles applied before: it may not be based on a marker which was not applied yet and must not
+// have been applied already. The latter check can be skipped with force. If trust is given, it must be the source
+// of the bundle. The key is only added to the trusted senders once the changes were applied, so a rejected bundle
+// never leaves its key trusted.
+func Apply(db database.Store, payload *Payload, trust string, force bool) (result database.ApplyResult, err error) {
+	if trust != "" && trust != payload.Source {
+		return database.ApplyResult{}, fmt.Errorf("bundle is signed by %s, not by the key to trust", payload.Source)
+	}
+	keys, err := Trusted(db)
+	if err != nil {
+		return database.ApplyResult{}, err
+	}
+	trusted := trust != ""
+	for _, k := range keys {
+		trusted = trusted || k == payload.Source
+	}
+	if !trusted {
+		return database.ApplyResult{}, fmt.Errorf("bundle source %s is not trusted", payload.Source)
+	}
+
+	applied, err := Applied(db, payload.Source)
+	if err != nil {
+		return database.ApplyResult{}, err
+	}
+	if payload.Since > applied {
+		return database.ApplyResult{}, fmt.Errorf("bundle is based on marker %d, but only marker %d was applied, bundles are missing", payload.Since, applied)
+	}
+	if payload.Sequence <= applied && !force {
+		return database.ApplyResult{}, fmt.Errorf("bundle %d was already applied, the latest applied bundle is %d", payload.Sequence, applied)
+	}
+
+	result, err = db.ApplyChanges(payload.Notes, payload.Deleted, payload.Recipients)
+	if err != nil {
+		return result, err
+	}
+	if trust != "" {
+		if err = Trust(db, trust); err != nil {
+			return result, err
+		}
+	}
+	if payload.Sequence > applied {
+		buf, err := json.Marshal(payload.Sequence)
+		if err != nil {
+			return result, err
+		}
+		return result, db.SetConfig(appliedPrefix+payload.Source, buf)
+	}
+	return result, nil
+}
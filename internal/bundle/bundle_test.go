@@ -0,0 +1,135 @@
+package bundle_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/bundle"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+	uuid "github.com/google/uuid"
+)
+
+func TestBundleSequence(t *testing.T) {
+	sender := database.NewDatabaseInstance(filepath.Join(t.TempDir(), "sender.db"))
+	if err := sender.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer sender.Close()
+	receiver := database.NewDatabaseInstance(filepath.Join(t.TempDir(), "receiver.db"))
+	if err := receiver.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer receiver.Close()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	first := model.EncryptedNote{Uuid: uuid.New(), Title: "First", Ciphertext: "ciphertext"}
+	if err = sender.SaveEncryptedNote(&first); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+
+	dir := t.TempDir()
+	firstPath := filepath.Join(dir, "1.bundle")
+	payload, err := bundle.Create(sender, id, 0, firstPath)
+	if err != nil {
+		t.Fatalf("Could not create bundle: %v", err)
+	}
+	if payload.Sequence != 1 || len(payload.Notes) != 1 {
+		t.Fatalf("Unexpected bundle: sequence %d, %d notes", payload.Sequence, len(payload.Notes))
+	}
+
+	second := model.EncryptedNote{Uuid: uuid.New(), Title: "Second", Ciphertext: "ciphertext"}
+	if err = sender.SaveEncryptedNote(&second); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+	if err = sender.DeleteNoteBySlug("first"); err != nil {
+		t.Fatalf("Could not delete note: %v", err)
+	}
+	secondPath := filepath.Join(dir, "2.bundle")
+	payload, err = bundle.Create(sender, id, 1, secondPath)
+	if err != nil {
+		t.Fatalf("Could not create bundle: %v", err)
+	}
+	if len(payload.Notes) != 1 || payload.Notes[0].Title != "Second" || len(payload.Deleted) != 1 {
+		t.Fatalf("Bundle should only contain the changes since marker 1: %+v", payload)
+	}
+
+	read := func(path string) *bundle.Payload {
+		payload, err := bundle.Read(path)
+		if err != nil {
+			t.Fatalf("Could not read bundle: %v", err)
+		}
+		return payload
+	}
+	if _, err = bundle.Apply(receiver, read(firstPath), "", false); err == nil {
+		t.Fatal("Bundle of an untrusted source should be rejected")
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	if _, err = bundle.Apply(receiver, read(firstPath), bundle.PublicKeyString(bundle.SigningKey(other)), false); err == nil {
+		t.Fatal("Bundle should be rejected if it is not signed by the key to trust")
+	}
+	if _, err = bundle.Apply(receiver, read(secondPath), payload.Source, false); err == nil {
+		t.Fatal("Bundle should be rejected while the previous bundle is missing")
+	}
+	if keys, _ := bundle.Trusted(receiver); len(keys) != 0 {
+		t.Fatalf("Keys of rejected bundles should not be trusted: %v", keys)
+	}
+	if _, err = bundle.Apply(receiver, read(firstPath), payload.Source, false); err != nil {
+		t.Fatalf("Could not apply bundle: %v", err)
+	}
+	if _, err = bundle.Apply(receiver, read(firstPath), "", false); err == nil {
+		t.Fatal("Bundle should not be applied twice")
+	}
+	result, err := bundle.Apply(receiver, read(secondPath), "", false)
+	if err != nil {
+		t.Fatalf("Could not apply bundle: %v", err)
+	}
+	if len(result.Added) != 1 || len(result.Deleted) != 1 {
+		t.Fatalf("Unexpected apply result: %+v", result)
+	}
+	if available, _ := receiver.CheckSlug("first"); available {
+		t.Fatal("Note first should have been deleted")
+	}
+}
+
+func TestBundleIntegrity(t *testing.T) {
+	db := database.NewDatabaseInstance(filepath.Join(t.TempDir(), "sender.db"))
+	if err := db.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer db.Close()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	note := model.EncryptedNote{Uuid: uuid.New(), Title: "Note", Ciphertext: "ciphertext"}
+	if err = db.SaveEncryptedNote(&note); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "note.bundle")
+	if _, err = bundle.Create(db, id, 0, path); err != nil {
+		t.Fatalf("Could not create bundle: %v", err)
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read bundle: %v", err)
+	}
+	// Flip a byte within the base64 encoded payload
+	buf[20] ^= 0x01
+	if err = os.WriteFile(path, buf, 0600); err != nil {
+		t.Fatalf("Could not write bundle: %v", err)
+	}
+	if _, err = bundle.Read(path); err == nil {
+		t.Fatal("Modified bundle should be rejected")
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"time"
 
 	"filippo.io/age"
 	"github.com/3c7/aen/internal/model"
+	uuid "github.com/google/uuid"
 	bolt "go.etcd.io/bbolt"
 )
 
@@ -23,12 +26,49 @@ func NewDatabaseInstance(path string) *Database {
 	}
 }
 
+// idKey is the config key of the ID identifying the database independent of its path.
+const idKey = "id"
+
+// Open opens the database with write access. A random ID is stored in databases without one, see ID.
 func (db *Database) Open() (err error) {
 	if db.isOpen {
 		return errors.New("Database is already open")
 	}
 	db.Handle, err = bolt.Open(db.Path, 0600, nil)
-	if err == nil {
+	if err != nil {
+		return err
+	}
+	db.isOpen = true
+	err = db.Handle.Update(func(tx *bolt.Tx) error {
+		if value, _ := db.readFromBucket(tx, []byte("config"), []byte(idKey)); len(value) > 0 {
+			return nil
+		}
+		return db.writeToBucket(tx, []byte("config"), []byte(idKey), []byte(uuid.New().String()))
+	})
+	if err != nil {
+		db.Close()
+	}
+	return err
+}
+
+// ID returns the ID of the database, which is kept by copies of the database file. It is empty if the database
+// was never opened with write access.
+func (db *Database) ID() (id string, err error) {
+	value, err := db.GetConfig(idKey)
+	return string(value), err
+}
+
+// OpenReadOnly opens the database without write access, e.g. for checking backups.
+// Buckets are not created, therefore only functions reading the buckets directly can be used.
+// ErrDatabaseInUse is returned if another process keeps the database opened with write access.
+func (db *Database) OpenReadOnly() (err error) {
+	if db.isOpen {
+		return errors.New("Database is already open")
+	}
+	db.Handle, err = bolt.Open(db.Path, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return ErrDatabaseInUse
+	} else if err == nil {
 		db.isOpen = true
 	}
 	return err
@@ -44,7 +84,7 @@ func (db *Database) Close() (err error) {
 
 func (db *Database) ensureBucket(tx *bolt.Tx, bucket []byte) (b *bolt.Bucket, err error) {
 	if tx.DB().IsReadOnly() {
-		return nil, errors.New("database is read-only")
+		return nil, ErrDatabaseReadOnly
 	}
 	b = tx.Bucket(bucket)
 	if b == nil {
@@ -68,6 +108,13 @@ func (db *Database) readFromBucket(tx *bolt.Tx, bucket []byte, key []byte) (valu
 	if !db.isOpen {
 		return nil, errors.New("database is not open")
 	}
+	// Buckets can't be created in read transactions, a missing bucket does not contain the key anyway
+	if !tx.Writable() {
+		if b := tx.Bucket(bucket); b != nil {
+			return b.Get(key), nil
+		}
+		return nil, nil
+	}
 	b, err := db.ensureBucket(tx, bucket)
 	if err != nil {
 		return nil, err
@@ -86,50 +133,72 @@ func (db *Database) deleteFromBucket(tx *bolt.Tx, bucket []byte, key []byte) (er
 	return b.Delete(key)
 }
 
+// SaveEncryptedNote stores the note under its slug and increments its revision. If the same note is already
+// stored under the slug with a higher revision, that revision is continued.
 func (db *Database) SaveEncryptedNote(encryptedNote *model.EncryptedNote) (err error) {
 	return db.Handle.Update(func(tx *bolt.Tx) error {
+		slug := encryptedNote.Slug()
+		stored, err := db.readFromBucket(tx, []byte("notes"), []byte(slug))
+		if err != nil {
+			return err
+		}
+		encryptedNote.Revision = nextRevision(stored, encryptedNote)
 		buf, err := json.Marshal(encryptedNote)
 		if err != nil {
 			return err
 		}
-		slug := encryptedNote.Slug()
 		return db.writeToBucket(tx, []byte("notes"), []byte(slug), buf)
 	})
 }
 
+// RenameEncryptedNote stores the note under its slug and removes the record stored under oldSlug within the same
+// transaction, so a renamed note is never stored twice.
+func (db *Database) RenameEncryptedNote(encryptedNote *model.EncryptedNote, oldSlug string) (err error) {
+	return db.Handle.Update(func(tx *bolt.Tx) error {
+		b, err := db.ensureBucket(tx, []byte("notes"))
+		if err != nil {
+			return err
+		}
+		stored := b.Get([]byte(oldSlug))
+		if stored == nil {
+			return fmt.Errorf("%w: %s", ErrNoteNotFound, oldSlug)
+		}
+		encryptedNote.Revision = nextRevision(stored, encryptedNote)
+		buf, err := json.Marshal(encryptedNote)
+		if err != nil {
+			return err
+		}
+		if err = b.Delete([]byte(oldSlug)); err != nil {
+			return err
+		}
+		return b.Put([]byte(encryptedNote.Slug()), buf)
+	})
+}
+
 func (db *Database) GetEncryptedNotes() (notes []model.EncryptedNote, err error) {
 	err = db.Handle.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte("notes"))
 		if b == nil {
 			return nil
 		}
-		b.ForEach(func(k, v []byte) error {
+		return b.ForEach(func(k, v []byte) error {
 			var note model.EncryptedNote
 			err := json.Unmarshal(v, &note)
 			if err != nil {
-				return err
+				return fmt.Errorf("could not parse note %s (see \"aen fsck\"): %v", string(k), err)
 			}
 			if note.Title != "quicknote" {
 				notes = append(notes, note)
 			}
 			return nil
 		})
-		return nil
 	})
 	return notes, err
 }
 
 func (db *Database) GetEncryptedNoteByTag(tag string) (notes []model.EncryptedNote, err error) {
 	allNotes, err := db.GetEncryptedNotes()
-	for i := range allNotes {
-		for j := range allNotes[i].Tags {
-			if allNotes[i].Tags[j] == tag {
-				notes = append(notes, allNotes[i])
-				break
-			}
-		}
-	}
-	return
+	return notesByTag(allNotes, tag), err
 }
 
 func (db *Database) CheckSlug(slug string) (available bool, err error) {
@@ -156,21 +225,20 @@ func (db *Database) GetEncryptedNoteBySlug(slug string) (encryptedNote *model.En
 			return err
 		}
 		if buf == nil {
-			return fmt.Errorf("note with slug %s not available", slug)
+			return fmt.Errorf("%w: %s", ErrNoteNotFound, slug)
 		}
 		err = json.Unmarshal(buf, &note)
 		return err
 	})
 	if err != nil {
-		return nil, fmt.Errorf("could not get encrypted note from database: %v", err)
+		return nil, fmt.Errorf("could not get encrypted note from database: %w", err)
 	}
 	return &note, nil
 }
 
 func (db *Database) DeleteNoteBySlug(slug string) (err error) {
-	_, err = db.GetEncryptedNoteBySlug(slug)
-	if err != nil {
-		return errors.New("note with slug not available")
+	if _, err = db.GetEncryptedNoteBySlug(slug); err != nil {
+		return err
 	}
 	err = db.Handle.Update(func(tx *bolt.Tx) error {
 		err := db.deleteFromBucket(tx, []byte("notes"), []byte(slug))
@@ -184,13 +252,16 @@ func (db *Database) GetEncryptedNoteByIndex(idx uint) (encryptedNote *model.Encr
 	if err != nil {
 		return nil, err
 	}
+	return noteByIndex(notes, idx)
+}
 
-	if len(notes) < int(idx) {
-		return nil, errors.New("index is out of range")
+// GetEncryptedNoteByUuid returns the note with the given UUID, including the quick note.
+func (db *Database) GetEncryptedNoteByUuid(id uuid.UUID) (encryptedNote *model.EncryptedNote, err error) {
+	notes, err := db.GetAllEncryptedNotes()
+	if err != nil {
+		return nil, err
 	}
-
-	model.SortNoteSlice(notes)
-	return &notes[idx-1], nil
+	return noteByUuid(notes, id)
 }
 
 // GetRecipients receives recipients as model.Recipient from database
@@ -218,14 +289,7 @@ func (db *Database) GetAgeRecipients() (ageRecipients []age.X25519Recipient, err
 	if err != nil {
 		return nil, err
 	}
-	for _, recipient := range recipients {
-		r, err := age.ParseX25519Recipient(recipient.Publickey)
-		if err != nil {
-			return nil, err
-		}
-		ageRecipients = append(ageRecipients, *r)
-	}
-	return ageRecipients, nil
+	return parseAgeRecipients(recipients)
 }
 
 // AddRecipient adds a recipient via model.Recipient struct. If the alias matches an already given recipient,
@@ -235,19 +299,9 @@ func (db *Database) AddRecipient(r model.Recipient) (err error) {
 	if err != nil {
 		return err
 	}
-
-	changed := false
-	for idx, recipient := range recipients {
-		if r.Publickey == recipient.Publickey {
-			return nil
-		} else if r.Alias == recipient.Alias {
-			recipients[idx].Publickey = r.Publickey
-			changed = true
-		}
-	}
-
+	recipients, changed := addRecipient(recipients, r)
 	if !changed {
-		recipients = append(recipients, r)
+		return nil
 	}
 
 	buf, err := json.Marshal(recipients)
@@ -263,17 +317,99 @@ func (db *Database) AddRecipient(r model.Recipient) (err error) {
 // RemoveRecipientByAlias removes a recipient identified by its model.Recipient.Alias from the database.
 func (db *Database) RemoveRecipientByAlias(alias string) (err error) {
 	recipients, err := db.GetRecipients()
-	for idx, r := range recipients {
-		if r.Alias == alias {
-			recipients = append(recipients[:idx], recipients[idx+1:]...)
-			buf, err := json.Marshal(recipients)
+	if err != nil {
+		return err
+	}
+	if recipients, err = removeRecipient(recipients, alias); err != nil {
+		return err
+	}
+	buf, err := json.Marshal(recipients)
+	if err != nil {
+		return err
+	}
+	return db.Handle.Update(func(tx *bolt.Tx) error {
+		return db.writeToBucket(tx, []byte("config"), []byte("recipients"), buf)
+	})
+}
+
+// WriteTo writes a consistent snapshot of the database to w. As a read transaction is used,
+// the database can be used by other processes while the snapshot is written.
+func (db *Database) WriteTo(w io.Writer) (n int64, err error) {
+	if !db.isOpen {
+		return 0, errors.New("database is not open")
+	}
+	err = db.Handle.View(func(tx *bolt.Tx) error {
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// VerifyRecords parses all notes and the recipient list and returns the number of parsed notes.
+// The first record which could not be parsed is returned as error.
+func (db *Database) VerifyRecords() (count int, err error) {
+	if !db.isOpen {
+		return 0, errors.New("database is not open")
+	}
+	err = db.Handle.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("notes")); b != nil {
+			err := b.ForEach(func(k, v []byte) error {
+				var note model.EncryptedNote
+				if err := json.Unmarshal(v, &note); err != nil {
+					return fmt.Errorf("could not parse note %s: %v", string(k), err)
+				}
+				count++
+				return nil
+			})
 			if err != nil {
 				return err
 			}
-			return db.Handle.Update(func(tx *bolt.Tx) error {
-				return db.writeToBucket(tx, []byte("config"), []byte("recipients"), buf)
-			})
 		}
+		if b := tx.Bucket([]byte("config")); b != nil {
+			if buf := b.Get([]byte("recipients")); len(buf) > 0 {
+				var recipients []model.Recipient
+				if err := json.Unmarshal(buf, &recipients); err != nil {
+					return fmt.Errorf("could not parse recipients: %v", err)
+				}
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// GetConfig returns the value stored under the given key in the config bucket or nil, if it is not available.
+func (db *Database) GetConfig(key string) (value []byte, err error) {
+	if !db.isOpen {
+		return nil, errors.New("database is not open")
+	}
+	err = db.Handle.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte("config")); b != nil {
+			value = append([]byte(nil), b.Get([]byte(key))...)
+		}
+		return nil
+	})
+	if len(value) == 0 {
+		return nil, err
+	}
+	return value, err
+}
+
+// SetConfig stores the value under the given key in the config bucket.
+func (db *Database) SetConfig(key string, value []byte) (err error) {
+	return db.Handle.Update(func(tx *bolt.Tx) error {
+		return db.writeToBucket(tx, []byte("config"), []byte(key), value)
+	})
+}
+
+// GetAllEncryptedNotes returns all notes including the quick note, which is omitted by GetEncryptedNotes.
+func (db *Database) GetAllEncryptedNotes() (notes []model.EncryptedNote, err error) {
+	if !db.isOpen {
+		return nil, errors.New("database is not open")
 	}
-	return errors.New("alias not found")
+	err = db.Handle.View(func(tx *bolt.Tx) error {
+		notes, err = readAllNotes(tx)
+		return err
+	})
+	return notes, err
 }
@@ -1,8 +1,10 @@
 package database_test
 
 import (
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -48,6 +50,20 @@ func TestOpenDBMultiple(t *testing.T) {
 	defer DB.Close()
 }
 
+func TestOpenReadOnlyInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.db")
+	DB := database.NewDatabaseInstance(path)
+	if err := DB.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer DB.Close()
+
+	other := database.NewDatabaseInstance(path)
+	if err := other.OpenReadOnly(); !errors.Is(err, database.ErrDatabaseInUse) {
+		t.Fatalf("Database opened with write access should be reported as in use: %v", err)
+	}
+}
+
 func TestWriteEncryptedNote(t *testing.T) {
 	file, err := ioutil.TempFile("", "notes.*.db")
 	if err != nil {
@@ -67,7 +83,7 @@ func TestWriteEncryptedNote(t *testing.T) {
 	}
 	note := model.EncryptedNote{
 		Uuid:       id,
-		Time:       time.Now(),
+		Created:    time.Now(),
 		Title:      "This is my Title!",
 		Ciphertext: "Imagine some base64 encoded ciphertext here.",
 	}
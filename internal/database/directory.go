@@ -0,0 +1,103 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// directory stores every record as a file named by its key in a sub directory per bucket.
+type directory struct {
+	path string
+}
+
+// OpenDirectoryStore opens a store which keeps every note in its own file below path. If ensure is set,
+// the directory is created if necessary.
+func OpenDirectoryStore(path string, ensure bool) (store Store, err error) {
+	if info, err := os.Stat(path); errors.Is(err, os.ErrNotExist) && ensure {
+		if err = os.MkdirAll(path, 0700); err != nil {
+			return nil, err
+		}
+	} else if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("database directory %s not available", path)
+	} else if err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", path)
+	}
+	return &kvStore{kv: &directory{path: path}}, nil
+}
+
+// filename escapes the key, as config keys may contain path separators.
+func (d *directory) filename(bucket, key string) string {
+	return filepath.Join(d.path, bucket, url.PathEscape(key))
+}
+
+func (d *directory) get(bucket, key string) (value []byte, err error) {
+	value, err = os.ReadFile(d.filename(bucket, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// put replaces the file atomically, so a record is never read partially written.
+func (d *directory) put(bucket, key string, value []byte) (err error) {
+	if strings.Trim(key, ".") == "" {
+		return fmt.Errorf("invalid key %q", key)
+	}
+	dir := filepath.Join(d.path, bucket)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".aen*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.filename(bucket, key))
+}
+
+func (d *directory) delete(bucket, key string) (err error) {
+	err = os.Remove(d.filename(bucket, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (d *directory) keys(bucket string) (keys []string, err error) {
+	entries, err := os.ReadDir(filepath.Join(d.path, bucket))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		key, err := url.PathUnescape(entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("invalid filename %s: %v", entry.Name(), err)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (d *directory) close() (err error) {
+	return nil
+}
@@ -0,0 +1,16 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/3c7/aen/internal/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Errors returned by the stores, callers can check for them using errors.Is.
+var (
+	ErrNoteNotFound     = errors.New("note not found")
+	ErrDatabaseReadOnly = bolt.ErrDatabaseReadOnly // also returned by bolt itself for write transactions
+	ErrIndexOutOfRange  = model.ErrIndexOutOfRange
+	ErrDatabaseInUse    = errors.New("database is in use by another process")
+)
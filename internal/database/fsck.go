@@ -0,0 +1,365 @@
+package database
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ProblemKind classifies the problems found by Check.
+type ProblemKind string
+
+const (
+	ProblemUnparsable       ProblemKind = "unparsable"
+	ProblemSlugMismatch     ProblemKind = "slug-mismatch"
+	ProblemEmptyCiphertext  ProblemKind = "empty-ciphertext"
+	ProblemDuplicateUuid    ProblemKind = "duplicate-uuid"
+	ProblemInvalidRecipient ProblemKind = "invalid-recipient"
+	ProblemDecryption       ProblemKind = "decryption"
+	ProblemNotRecipient     ProblemKind = "not-recipient"
+	ProblemAttachmentHash   ProblemKind = "attachment-hash"
+	ProblemUnknownBucket    ProblemKind = "unknown-bucket"
+)
+
+// Problem describes a single inconsistency of a record in the database.
+type Problem struct {
+	Bucket     string
+	Key        string
+	Attachment string // filename, if the problem only concerns an attachment of the note
+	Kind       ProblemKind
+	Message    string
+}
+
+func (p Problem) String() string {
+	if len(p.Key) == 0 {
+		return fmt.Sprintf("%s: %s: %s", p.Bucket, p.Kind, p.Message)
+	}
+	return fmt.Sprintf("%s/%s: %s: %s", p.Bucket, p.Key, p.Kind, p.Message)
+}
+
+// Repairable returns true if Repair is able to handle the problem. Mismatching attachment hashes are only reported,
+// as the content might still be of use. Notes which are not encrypted to the identity used for the check are not
+// broken, they are only reported.
+func (p Problem) Repairable() bool {
+	switch p.Kind {
+	case ProblemUnparsable, ProblemSlugMismatch, ProblemEmptyCiphertext, ProblemInvalidRecipient, ProblemDecryption:
+		return true
+	}
+	return false
+}
+
+// Check walks all buckets of the database and reports records which can not be parsed, are stored
+// under the wrong slug, have empty ciphertexts or share their UUID with other notes. Recipients are checked for
+// valid public keys. If an identity is given, notes and attachments are decrypted and the hashes of attachments
+// are verified. Notes not encrypted to the identity are reported as ProblemNotRecipient. Records in the quarantine
+// bucket are not checked.
+func (db *Database) Check(identity age.Identity) (problems []Problem, err error) {
+	err = db.Handle.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			switch string(name) {
+			case "notes":
+				problems = append(problems, checkNotes(b, identity)...)
+			case "config":
+				problems = append(problems, checkRecipients(b)...)
+			case "quarantine":
+			default:
+				problems = append(problems, Problem{
+					Bucket:  string(name),
+					Kind:    ProblemUnknownBucket,
+					Message: "bucket is not used by aen",
+				})
+			}
+			return nil
+		})
+	})
+	return problems, err
+}
+
+func checkNotes(b *bolt.Bucket, identity age.Identity) (problems []Problem) {
+	slugsByUuid := map[string][]string{}
+	b.ForEach(func(k, v []byte) error {
+		key := string(k)
+		report := func(kind ProblemKind, attachment string, format string, a ...interface{}) {
+			problems = append(problems, Problem{
+				Bucket:     "notes",
+				Key:        key,
+				Attachment: attachment,
+				Kind:       kind,
+				Message:    fmt.Sprintf(format, a...),
+			})
+		}
+
+		var note model.EncryptedNote
+		if err := json.Unmarshal(v, &note); err != nil {
+			report(ProblemUnparsable, "", "%v", err)
+			return nil
+		}
+		slugsByUuid[note.Uuid.String()] = append(slugsByUuid[note.Uuid.String()], key)
+
+		if note.Slug() != key {
+			report(ProblemSlugMismatch, "", "title %q results in slug %s", note.Title, note.Slug())
+		}
+		if len(note.Ciphertext) == 0 {
+			report(ProblemEmptyCiphertext, "", "note does not contain any ciphertext")
+			return nil
+		}
+		for i := range note.Attachments {
+			if len(note.Attachments[i].Ciphertext) == 0 {
+				report(ProblemEmptyCiphertext, note.Attachments[i].Filename, "attachment %s does not contain any ciphertext", note.Attachments[i].Filename)
+			}
+		}
+		if identity == nil {
+			return nil
+		}
+
+		if _, err := decryptCiphertext(note.Ciphertext, identity); err != nil {
+			report(decryptionProblem(err), "", "%v", err)
+			return nil
+		}
+		for _, attachment := range note.Attachments {
+			if len(attachment.Ciphertext) == 0 {
+				continue
+			}
+			content, err := decryptCiphertext(attachment.Ciphertext, identity)
+			if err != nil {
+				report(decryptionProblem(err), attachment.Filename, "attachment %s: %v", attachment.Filename, err)
+				continue
+			}
+			expected := model.NewAttachment(attachment.Filename, content)
+			if expected.Md5 != attachment.Md5 || expected.Sha1 != attachment.Sha1 ||
+				expected.Sha256 != attachment.Sha256 || expected.Sha512 != attachment.Sha512 {
+				report(ProblemAttachmentHash, attachment.Filename, "hashes of attachment %s do not match its content", attachment.Filename)
+			}
+		}
+		return nil
+	})
+
+	for id, slugs := range slugsByUuid {
+		if len(slugs) < 2 {
+			continue
+		}
+		for _, slug := range slugs {
+			problems = append(problems, Problem{
+				Bucket:  "notes",
+				Key:     slug,
+				Kind:    ProblemDuplicateUuid,
+				Message: fmt.Sprintf("UUID %s is used by %d notes", id, len(slugs)),
+			})
+		}
+	}
+	return problems
+}
+
+func checkRecipients(b *bolt.Bucket) (problems []Problem) {
+	buf := b.Get([]byte("recipients"))
+	if len(buf) == 0 {
+		return nil
+	}
+	var recipients []model.Recipient
+	if err := json.Unmarshal(buf, &recipients); err != nil {
+		return []Problem{{
+			Bucket:  "config",
+			Key:     "recipients",
+			Kind:    ProblemUnparsable,
+			Message: err.Error(),
+		}}
+	}
+	for _, r := range recipients {
+		if _, err := age.ParseX25519Recipient(r.Publickey); err != nil {
+			problems = append(problems, Problem{
+				Bucket:  "config",
+				Key:     "recipients",
+				Kind:    ProblemInvalidRecipient,
+				Message: fmt.Sprintf("recipient %s: %v", r.Alias, err),
+			})
+		}
+	}
+	return problems
+}
+
+// decryptCiphertext decodes and decrypts the ciphertext. Errors of age are wrapped, so decryptionProblem is able to
+// tell notes encrypted to other recipients from broken ones.
+func decryptCiphertext(ciphertext string, identity age.Identity) (content []byte, err error) {
+	decoded, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode ciphertext: %v", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(decoded), identity)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt: %w", err)
+	}
+	if content, err = io.ReadAll(r); err != nil {
+		return nil, fmt.Errorf("could not read decrypted content: %v", err)
+	}
+	return content, nil
+}
+
+// decryptionProblem returns ProblemNotRecipient if the ciphertext is intact but not encrypted to the identity,
+// ProblemDecryption otherwise, e.g. for bad headers, MACs or truncated streams.
+func decryptionProblem(err error) ProblemKind {
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return ProblemNotRecipient
+	}
+	return ProblemDecryption
+}
+
+// quarantineKey returns an unused key for a record identified by "<bucket>/<key>" in the quarantine. The time of the
+// repair is appended, so records quarantined by earlier repairs are never overwritten.
+func quarantineKey(quarantine *bolt.Bucket, id string) []byte {
+	prefix := id + "/" + time.Now().UTC().Format("20060102T150405Z")
+	key := prefix
+	for i := 2; quarantine.Get([]byte(key)) != nil; i++ {
+		key = prefix + "-" + strconv.Itoa(i)
+	}
+	return []byte(key)
+}
+
+// Repair handles the given problems, as far as they are repairable. Broken records are moved to the quarantine
+// bucket using "<bucket>/<key>/<time of repair>" as key, notes stored under a wrong slug are moved to the correct slug if it is
+// available and invalid recipients are moved to the quarantine and removed from the recipient list.
+// Broken attachments are removed from their note, a copy of the original note is kept in the quarantine.
+func (db *Database) Repair(problems []Problem) (repaired int, err error) {
+	type plan struct {
+		bucket, key       string
+		quarantine, rekey bool
+		recipients        bool
+		dropAttachments   map[string]bool
+	}
+	var plans []*plan
+	byId := map[string]*plan{}
+	for _, p := range problems {
+		if !p.Repairable() {
+			continue
+		}
+		id := p.Bucket + "/" + p.Key
+		current, ok := byId[id]
+		if !ok {
+			current = &plan{bucket: p.Bucket, key: p.Key, dropAttachments: map[string]bool{}}
+			byId[id] = current
+			plans = append(plans, current)
+		}
+		switch {
+		case p.Kind == ProblemInvalidRecipient:
+			current.recipients = true
+		case p.Kind == ProblemSlugMismatch:
+			current.rekey = true
+		case len(p.Attachment) > 0:
+			current.dropAttachments[p.Attachment] = true
+		default:
+			current.quarantine = true
+		}
+	}
+
+	err = db.Handle.Update(func(tx *bolt.Tx) error {
+		quarantine, err := db.ensureBucket(tx, []byte("quarantine"))
+		if err != nil {
+			return err
+		}
+		for _, p := range plans {
+			id := p.bucket + "/" + p.key
+			b := tx.Bucket([]byte(p.bucket))
+			if b == nil || b.Get([]byte(p.key)) == nil {
+				continue
+			}
+			value := append([]byte(nil), b.Get([]byte(p.key))...)
+
+			if p.recipients {
+				if err = quarantineRecipients(b, quarantine); err != nil {
+					return err
+				}
+				repaired++
+				continue
+			}
+			if p.quarantine {
+				if err = quarantine.Put(quarantineKey(quarantine, id), value); err != nil {
+					return err
+				}
+				if err = b.Delete([]byte(p.key)); err != nil {
+					return err
+				}
+				repaired++
+				continue
+			}
+
+			var note model.EncryptedNote
+			if err = json.Unmarshal(value, &note); err != nil {
+				return err
+			}
+			if len(p.dropAttachments) > 0 {
+				if err = quarantine.Put(quarantineKey(quarantine, id), value); err != nil {
+					return err
+				}
+				var attachments []model.EncryptedAttachment
+				for _, a := range note.Attachments {
+					if !p.dropAttachments[a.Filename] {
+						attachments = append(attachments, a)
+					}
+				}
+				note.Attachments = attachments
+				if value, err = json.Marshal(note); err != nil {
+					return err
+				}
+			}
+
+			key := p.key
+			if p.rekey {
+				key = note.Slug()
+				if len(key) == 0 || b.Get([]byte(key)) != nil {
+					if err = quarantine.Put(quarantineKey(quarantine, id), value); err != nil {
+						return err
+					}
+					if err = b.Delete([]byte(p.key)); err != nil {
+						return err
+					}
+					repaired++
+					continue
+				}
+				if err = b.Delete([]byte(p.key)); err != nil {
+					return err
+				}
+			}
+			if err = b.Put([]byte(key), value); err != nil {
+				return err
+			}
+			repaired++
+		}
+		return nil
+	})
+	return repaired, err
+}
+
+// quarantineRecipients moves recipients with invalid public keys from the recipient list to the quarantine.
+func quarantineRecipients(config, quarantine *bolt.Bucket) (err error) {
+	var recipients, valid []model.Recipient
+	if err = json.Unmarshal(config.Get([]byte("recipients")), &recipients); err != nil {
+		return err
+	}
+	for _, r := range recipients {
+		if _, err := age.ParseX25519Recipient(r.Publickey); err != nil {
+			buf, err := r.Json()
+			if err != nil {
+				return err
+			}
+			if err = quarantine.Put(quarantineKey(quarantine, "config/recipients/"+r.Alias), buf); err != nil {
+				return err
+			}
+			continue
+		}
+		valid = append(valid, r)
+	}
+	buf, err := json.Marshal(valid)
+	if err != nil {
+		return err
+	}
+	return config.Put([]byte("recipients"), buf)
+}
@@ -0,0 +1,147 @@
+package database_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCheckAndRepair(t *testing.T) {
+	DB := database.NewDatabaseInstance(filepath.Join(t.TempDir(), "notes.db"))
+	if err := DB.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer DB.Close()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	valid, err := model.NewNote("Valid", "Text").ToEncryptedNote(*id.Recipient())
+	if err != nil {
+		t.Fatalf("Could not encrypt note: %v", err)
+	}
+	if err = DB.SaveEncryptedNote(&valid); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+
+	moved := valid
+	moved.Title = "Moved"
+	movedJson, err := moved.Json()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DB.Handle.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("notes"))
+		if err := b.Put([]byte("broken"), []byte("{not json")); err != nil {
+			return err
+		}
+		return b.Put([]byte("wrong-slug"), movedJson)
+	})
+	if err != nil {
+		t.Fatalf("Could not write broken records: %v", err)
+	}
+
+	if _, err = DB.GetEncryptedNotes(); err == nil {
+		t.Fatal("GetEncryptedNotes should return an error for unparsable records")
+	}
+
+	problems, err := DB.Check(id)
+	if err != nil {
+		t.Fatalf("Could not check database: %v", err)
+	}
+	kinds := map[database.ProblemKind]int{}
+	for _, p := range problems {
+		t.Logf("Found problem: %s", p)
+		kinds[p.Kind]++
+	}
+	if kinds[database.ProblemUnparsable] != 1 || kinds[database.ProblemSlugMismatch] != 1 || kinds[database.ProblemDuplicateUuid] != 2 {
+		t.Fatalf("Unexpected problems found: %v", kinds)
+	}
+
+	if _, err = DB.Repair(problems); err != nil {
+		t.Fatalf("Could not repair database: %v", err)
+	}
+	notes, err := DB.GetEncryptedNotes()
+	if err != nil {
+		t.Fatalf("Notes should be readable after repair: %v", err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("Database should contain 2 notes after repair but contained %d", len(notes))
+	}
+	if available, _ := DB.CheckSlug("moved"); !available {
+		t.Fatal("Note stored under the wrong slug should have been moved")
+	}
+
+	// A second repair of the same slug must not overwrite the record quarantined before
+	err = DB.Handle.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("notes")).Put([]byte("broken"), []byte("{still not json"))
+	})
+	if err != nil {
+		t.Fatalf("Could not write broken record: %v", err)
+	}
+	if problems, err = DB.Check(id); err != nil {
+		t.Fatalf("Could not check database: %v", err)
+	}
+	if _, err = DB.Repair(problems); err != nil {
+		t.Fatalf("Could not repair database: %v", err)
+	}
+	quarantined := 0
+	err = DB.Handle.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("quarantine")).ForEach(func(k, v []byte) error {
+			if strings.HasPrefix(string(k), "notes/broken/") {
+				quarantined++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("Could not read quarantine: %v", err)
+	}
+	if quarantined != 2 {
+		t.Fatalf("Quarantine should contain both broken records but contained %d", quarantined)
+	}
+}
+
+func TestCheckOtherRecipient(t *testing.T) {
+	DB := database.NewDatabaseInstance(filepath.Join(t.TempDir(), "notes.db"))
+	if err := DB.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer DB.Close()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	note, err := model.NewNote("Shared", "Text").ToEncryptedNote(*other.Recipient())
+	if err != nil {
+		t.Fatalf("Could not encrypt note: %v", err)
+	}
+	if err = DB.SaveEncryptedNote(&note); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+
+	problems, err := DB.Check(id)
+	if err != nil {
+		t.Fatalf("Could not check database: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Kind != database.ProblemNotRecipient || problems[0].Repairable() {
+		t.Fatalf("Note of another recipient should be reported as not repairable: %v", problems)
+	}
+	if _, err = DB.Repair(problems); err != nil {
+		t.Fatalf("Could not repair database: %v", err)
+	}
+	if available, _ := DB.CheckSlug("shared"); !available {
+		t.Fatal("Note of another recipient should not be moved to the quarantine")
+	}
+}
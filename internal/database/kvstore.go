@@ -0,0 +1,266 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/model"
+	uuid "github.com/google/uuid"
+)
+
+// keyValue is the storage used by the in-memory and the directory backend. Like in the bolt database,
+// records are grouped in buckets.
+type keyValue interface {
+	get(bucket, key string) (value []byte, err error) // nil if the key is not available
+	put(bucket, key string, value []byte) error
+	delete(bucket, key string) error
+	keys(bucket string) (keys []string, err error)
+	close() error
+}
+
+// kvStore implements Store on top of a keyValue storage, using the same buckets and keys as the bolt database.
+type kvStore struct {
+	kv keyValue
+	mu sync.Mutex // serializes operations consisting of multiple reads and writes
+}
+
+func (s *kvStore) SaveEncryptedNote(encryptedNote *model.EncryptedNote) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slug := encryptedNote.Slug()
+	stored, err := s.kv.get("notes", slug)
+	if err != nil {
+		return err
+	}
+	encryptedNote.Revision = nextRevision(stored, encryptedNote)
+	buf, err := json.Marshal(encryptedNote)
+	if err != nil {
+		return err
+	}
+	return s.kv.put("notes", slug, buf)
+}
+
+// RenameEncryptedNote stores the note under its slug and removes the record stored under oldSlug afterwards. The
+// backends offer no transactions, but the lock keeps other operations from seeing the note stored twice.
+func (s *kvStore) RenameEncryptedNote(encryptedNote *model.EncryptedNote, oldSlug string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.kv.get("notes", oldSlug)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return fmt.Errorf("%w: %s", ErrNoteNotFound, oldSlug)
+	}
+	encryptedNote.Revision = nextRevision(stored, encryptedNote)
+	buf, err := json.Marshal(encryptedNote)
+	if err != nil {
+		return err
+	}
+	if err = s.kv.put("notes", encryptedNote.Slug(), buf); err != nil {
+		return err
+	}
+	return s.kv.delete("notes", oldSlug)
+}
+
+func (s *kvStore) GetEncryptedNotes() (notes []model.EncryptedNote, err error) {
+	notes, err = s.GetAllEncryptedNotes()
+	return withoutQuicknote(notes), err
+}
+
+func (s *kvStore) GetAllEncryptedNotes() (notes []model.EncryptedNote, err error) {
+	keys, err := s.kv.keys("notes")
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		note, err := s.GetEncryptedNoteBySlug(key)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, *note)
+	}
+	return notes, nil
+}
+
+func (s *kvStore) GetEncryptedNoteBySlug(slug string) (encryptedNote *model.EncryptedNote, err error) {
+	buf, err := s.kv.get("notes", slug)
+	if err != nil {
+		return nil, err
+	}
+	if buf == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoteNotFound, slug)
+	}
+	encryptedNote = &model.EncryptedNote{}
+	if err = json.Unmarshal(buf, encryptedNote); err != nil {
+		return nil, fmt.Errorf("could not parse note %s: %v", slug, err)
+	}
+	return encryptedNote, nil
+}
+
+func (s *kvStore) GetEncryptedNoteByUuid(id uuid.UUID) (encryptedNote *model.EncryptedNote, err error) {
+	notes, err := s.GetAllEncryptedNotes()
+	if err != nil {
+		return nil, err
+	}
+	return noteByUuid(notes, id)
+}
+
+func (s *kvStore) GetEncryptedNoteByIndex(idx uint) (encryptedNote *model.EncryptedNote, err error) {
+	notes, err := s.GetEncryptedNotes()
+	if err != nil {
+		return nil, err
+	}
+	return noteByIndex(notes, idx)
+}
+
+func (s *kvStore) GetEncryptedNoteByTag(tag string) (notes []model.EncryptedNote, err error) {
+	notes, err = s.GetEncryptedNotes()
+	return notesByTag(notes, tag), err
+}
+
+func (s *kvStore) CheckSlug(slug string) (available bool, err error) {
+	buf, err := s.kv.get("notes", slug)
+	return buf != nil, err
+}
+
+func (s *kvStore) DeleteNoteBySlug(slug string) (err error) {
+	if available, err := s.CheckSlug(slug); err != nil {
+		return err
+	} else if !available {
+		return fmt.Errorf("%w: %s", ErrNoteNotFound, slug)
+	}
+	return s.kv.delete("notes", slug)
+}
+
+func (s *kvStore) ApplyChanges(notes []model.EncryptedNote, deleted []uuid.UUID, recipients []model.Recipient) (result ApplyResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ours, err := s.GetAllEncryptedNotes()
+	if err != nil {
+		return ApplyResult{}, err
+	}
+	slugs := map[uuid.UUID]string{}
+	used := map[string]bool{}
+	for _, note := range ours {
+		slugs[note.Uuid] = note.Slug()
+		used[note.Slug()] = true
+	}
+
+	for _, id := range deleted {
+		slug, ok := slugs[id]
+		if !ok {
+			continue
+		}
+		if err = s.kv.delete("notes", slug); err != nil {
+			return result, err
+		}
+		delete(slugs, id)
+		delete(used, slug)
+		result.Deleted = append(result.Deleted, slug)
+	}
+	for i := range notes {
+		note := notes[i]
+		slug, ok := slugs[note.Uuid]
+		if ok {
+			if err = s.kv.delete("notes", slug); err != nil {
+				return result, err
+			}
+			delete(used, slug)
+		}
+		uniqueTitle(&note, func(slug string) bool { return used[slug] })
+		buf, err := json.Marshal(note)
+		if err != nil {
+			return result, err
+		}
+		if err = s.kv.put("notes", note.Slug(), buf); err != nil {
+			return result, err
+		}
+		slugs[note.Uuid] = note.Slug()
+		used[note.Slug()] = true
+		if ok {
+			result.Updated = append(result.Updated, note.Slug())
+		} else {
+			result.Added = append(result.Added, note.Slug())
+		}
+	}
+
+	ourRecipients, err := s.GetRecipients()
+	if err != nil {
+		return result, err
+	}
+	ourRecipients, result.Recipients = mergeRecipientList(ourRecipients, recipients)
+	if len(result.Recipients) == 0 {
+		return result, nil
+	}
+	return result, s.writeRecipients(ourRecipients)
+}
+
+func (s *kvStore) GetRecipients() (recipients []model.Recipient, err error) {
+	buf, err := s.kv.get("config", "recipients")
+	if err != nil || len(buf) == 0 {
+		return nil, err
+	}
+	return recipients, json.Unmarshal(buf, &recipients)
+}
+
+func (s *kvStore) writeRecipients(recipients []model.Recipient) (err error) {
+	buf, err := json.Marshal(recipients)
+	if err != nil {
+		return err
+	}
+	return s.kv.put("config", "recipients", buf)
+}
+
+func (s *kvStore) GetAgeRecipients() (ageRecipients []age.X25519Recipient, err error) {
+	recipients, err := s.GetRecipients()
+	if err != nil {
+		return nil, err
+	}
+	return parseAgeRecipients(recipients)
+}
+
+func (s *kvStore) AddRecipient(r model.Recipient) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recipients, err := s.GetRecipients()
+	if err != nil {
+		return err
+	}
+	recipients, changed := addRecipient(recipients, r)
+	if !changed {
+		return nil
+	}
+	return s.writeRecipients(recipients)
+}
+
+func (s *kvStore) RemoveRecipientByAlias(alias string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recipients, err := s.GetRecipients()
+	if err != nil {
+		return err
+	}
+	if recipients, err = removeRecipient(recipients, alias); err != nil {
+		return err
+	}
+	return s.writeRecipients(recipients)
+}
+
+func (s *kvStore) GetConfig(key string) (value []byte, err error) {
+	value, err = s.kv.get("config", key)
+	if len(value) == 0 {
+		return nil, err
+	}
+	return value, err
+}
+
+func (s *kvStore) SetConfig(key string, value []byte) (err error) {
+	return s.kv.put("config", key, value)
+}
+
+func (s *kvStore) Close() (err error) {
+	return s.kv.close()
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"sort"
+	"sync"
+)
+
+// memory keeps all records in maps, nothing is persisted.
+type memory struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemoryStore returns an empty store which only lives in memory, e.g. for tests.
+func NewMemoryStore() Store {
+	return &kvStore{kv: &memory{buckets: map[string]map[string][]byte{}}}
+}
+
+func (m *memory) get(bucket, key string) (value []byte, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if value, ok := m.buckets[bucket][key]; ok {
+		return append([]byte{}, value...), nil
+	}
+	return nil, nil
+}
+
+func (m *memory) put(bucket, key string, value []byte) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets[bucket] == nil {
+		m.buckets[bucket] = map[string][]byte{}
+	}
+	m.buckets[bucket][key] = append([]byte{}, value...)
+	return nil
+}
+
+func (m *memory) delete(bucket, key string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.buckets[bucket], key)
+	return nil
+}
+
+func (m *memory) keys(bucket string) (keys []string, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for key := range m.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *memory) close() (err error) {
+	return nil
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/3c7/aen/internal/model"
+	uuid "github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// MergeStrategy defines how notes are handled which are available in both databases but differ.
+type MergeStrategy string
+
+const (
+	MergeKeepBoth MergeStrategy = "keep-both" // keep the local note and add the other one as conflict copy
+	MergeNewest   MergeStrategy = "newest"    // keep the note modified last
+	MergeOurs     MergeStrategy = "ours"      // always keep the local note
+	MergeTheirs   MergeStrategy = "theirs"    // always take the note of the other database
+)
+
+// ParseMergeStrategy returns the strategy for the given name, an empty name results in MergeKeepBoth.
+func ParseMergeStrategy(name string) (strategy MergeStrategy, err error) {
+	switch MergeStrategy(name) {
+	case "", MergeKeepBoth:
+		return MergeKeepBoth, nil
+	case MergeNewest, MergeOurs, MergeTheirs:
+		return MergeStrategy(name), nil
+	}
+	return "", fmt.Errorf("unknown merge strategy %s", name)
+}
+
+// MergeResult summarizes the changes of a merge. Notes are referenced by their slug in this database.
+type MergeResult struct {
+	Added      []string
+	Updated    []string
+	Conflicts  []string // notes changed on both sides since the last merge, resolved by the strategy
+	Copies     []string // conflict copies added by MergeKeepBoth
+	Unchanged  int
+	Recipients []string // aliases of added recipients
+}
+
+// mergeStatePrefix is the config key of the revisions merged from another database, suffixed by its ID.
+const mergeStatePrefix = "merge-state-"
+
+// mergeBase maps the UUIDs of notes to the revisions of both databases after the last merge.
+type mergeBase map[uuid.UUID]mergeRevisions
+
+type mergeRevisions struct {
+	Ours   uint64
+	Theirs uint64
+}
+
+// Merge copies notes and recipients from the other database. Notes are matched by their UUID, notes which are
+// only available in the other database are added. The revisions of both sides are stored per ID of the other
+// database after every merge, so notes changed only in the other database since the last merge replace the local
+// ones, even if it is mounted at a different path. Databases without an ID, which were never opened with write
+// access, are identified by their absolute path instead. If a note was changed on both sides, or the databases
+// were not merged before, the given strategy is applied. As notes are stored by their slug, notes which would
+// overwrite a different note get a new title. The other database can be opened read-only.
+func (db *Database) Merge(other *Database, strategy MergeStrategy) (result MergeResult, err error) {
+	if !db.isOpen || !other.isOpen {
+		return MergeResult{}, errors.New("database is not open")
+	}
+	peer, err := other.ID()
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("could not read other database: %v", err)
+	}
+	if peer == "" {
+		if peer, err = filepath.Abs(other.Path); err != nil {
+			return MergeResult{}, err
+		}
+	}
+	var theirs []model.EncryptedNote
+	var theirRecipients []model.Recipient
+	err = other.Handle.View(func(tx *bolt.Tx) (err error) {
+		if theirs, err = readAllNotes(tx); err != nil {
+			return err
+		}
+		if b := tx.Bucket([]byte("config")); b != nil {
+			if buf := b.Get([]byte("recipients")); len(buf) > 0 {
+				return json.Unmarshal(buf, &theirRecipients)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return MergeResult{}, fmt.Errorf("could not read other database: %v", err)
+	}
+
+	err = db.Handle.Update(func(tx *bolt.Tx) error {
+		b, err := db.ensureBucket(tx, []byte("notes"))
+		if err != nil {
+			return err
+		}
+		config, err := db.ensureBucket(tx, []byte("config"))
+		if err != nil {
+			return err
+		}
+		base := mergeBase{}
+		if buf := config.Get([]byte(mergeStatePrefix + peer)); buf != nil {
+			if err = json.Unmarshal(buf, &base); err != nil {
+				return fmt.Errorf("could not parse merge state: %v", err)
+			}
+		}
+		ours, err := readAllNotes(tx)
+		if err != nil {
+			return err
+		}
+		byUuid := map[uuid.UUID]model.EncryptedNote{}
+		fingerprints := map[string]bool{}
+		for _, note := range ours {
+			byUuid[note.Uuid] = note
+			fingerprints[fingerprint(note)] = true
+		}
+
+		for _, theirNote := range theirs {
+			ourNote, ok := byUuid[theirNote.Uuid]
+			if !ok {
+				slug, err := putNote(b, &theirNote, "")
+				if err != nil {
+					return err
+				}
+				result.Added = append(result.Added, slug)
+				base[theirNote.Uuid] = mergeRevisions{Ours: theirNote.Revision, Theirs: theirNote.Revision}
+				continue
+			}
+
+			revisions, merged := base[theirNote.Uuid]
+			ourChange := !merged || ourNote.Revision != revisions.Ours
+			theirChange := !merged || theirNote.Revision != revisions.Theirs
+			base[theirNote.Uuid] = mergeRevisions{Ours: ourNote.Revision, Theirs: theirNote.Revision}
+
+			ourJson, err := json.Marshal(ourNote)
+			if err != nil {
+				return err
+			}
+			theirJson, err := json.Marshal(theirNote)
+			if err != nil {
+				return err
+			}
+			if !theirChange || bytes.Equal(ourJson, theirJson) {
+				result.Unchanged++
+				continue
+			}
+
+			if ourChange {
+				result.Conflicts = append(result.Conflicts, ourNote.Slug())
+				switch strategy {
+				case MergeOurs:
+					continue
+				case MergeNewest:
+					if !theirNote.LastModified().After(ourNote.LastModified()) {
+						continue
+					}
+				case MergeKeepBoth:
+					theirNote.Title = fmt.Sprintf("%s (conflict %s)", theirNote.Title, theirNote.Created.Format("2006-01-02 15:04:05"))
+					// A conflict copy of the same version might have been added by a previous merge
+					if fingerprints[fingerprint(theirNote)] {
+						continue
+					}
+					fingerprints[fingerprint(theirNote)] = true
+					theirNote.Uuid = uuid.New()
+					slug, err := putNote(b, &theirNote, "")
+					if err != nil {
+						return err
+					}
+					result.Copies = append(result.Copies, slug)
+					continue
+				}
+			}
+
+			slug, err := putNote(b, &theirNote, ourNote.Slug())
+			if err != nil {
+				return err
+			}
+			result.Updated = append(result.Updated, slug)
+			base[theirNote.Uuid] = mergeRevisions{Ours: theirNote.Revision, Theirs: theirNote.Revision}
+		}
+
+		buf, err := json.Marshal(base)
+		if err != nil {
+			return err
+		}
+		if err = config.Put([]byte(mergeStatePrefix+peer), buf); err != nil {
+			return err
+		}
+		result.Recipients, err = mergeRecipients(tx, theirRecipients)
+		return err
+	})
+	return result, err
+}
+
+// fingerprint identifies the content of a note independent of its UUID.
+func fingerprint(note model.EncryptedNote) string {
+	note.Uuid = uuid.Nil
+	buf, _ := json.Marshal(note)
+	return string(buf)
+}
+
+// putNote stores the note in the notes bucket. The note given by replaceSlug is deleted, if a slug is given.
+// If the slug of the note is already used by a different note, a suffix is appended to the title.
+func putNote(b *bolt.Bucket, note *model.EncryptedNote, replaceSlug string) (slug string, err error) {
+	if len(replaceSlug) > 0 {
+		if err = b.Delete([]byte(replaceSlug)); err != nil {
+			return "", err
+		}
+	}
+	uniqueTitle(note, func(slug string) bool { return b.Get([]byte(slug)) != nil })
+	buf, err := json.Marshal(note)
+	if err != nil {
+		return "", err
+	}
+	return note.Slug(), b.Put([]byte(note.Slug()), buf)
+}
+
+// mergeRecipients adds recipients unknown to this database, see mergeRecipientList.
+func mergeRecipients(tx *bolt.Tx, theirs []model.Recipient) (added []string, err error) {
+	b := tx.Bucket([]byte("config"))
+	if b == nil {
+		if b, err = tx.CreateBucket([]byte("config")); err != nil {
+			return nil, err
+		}
+	}
+	var ours []model.Recipient
+	if buf := b.Get([]byte("recipients")); len(buf) > 0 {
+		if err = json.Unmarshal(buf, &ours); err != nil {
+			return nil, err
+		}
+	}
+	ours, added = mergeRecipientList(ours, theirs)
+	if len(added) == 0 {
+		return nil, nil
+	}
+	buf, err := json.Marshal(ours)
+	if err != nil {
+		return nil, err
+	}
+	return added, b.Put([]byte("recipients"), buf)
+}
+
+// readAllNotes reads all notes, including the quick note, within the given transaction.
+func readAllNotes(tx *bolt.Tx) (notes []model.EncryptedNote, err error) {
+	b := tx.Bucket([]byte("notes"))
+	if b == nil {
+		return nil, nil
+	}
+	err = b.ForEach(func(k, v []byte) error {
+		var note model.EncryptedNote
+		if err := json.Unmarshal(v, &note); err != nil {
+			return fmt.Errorf("could not parse note %s: %v", string(k), err)
+		}
+		notes = append(notes, note)
+		return nil
+	})
+	return notes, err
+}
+
+// ApplyResult summarizes the changes made by ApplyChanges. Notes are referenced by their slug.
+type ApplyResult struct {
+	Added      []string
+	Updated    []string
+	Deleted    []string
+	Recipients []string
+}
+
+// ApplyChanges stores the given notes, replacing local notes with the same UUID, removes the notes with the given
+// UUIDs and adds unknown recipients. Unlike Merge, changes are applied unconditionally.
+func (db *Database) ApplyChanges(notes []model.EncryptedNote, deleted []uuid.UUID, recipients []model.Recipient) (result ApplyResult, err error) {
+	err = db.Handle.Update(func(tx *bolt.Tx) error {
+		b, err := db.ensureBucket(tx, []byte("notes"))
+		if err != nil {
+			return err
+		}
+		ours, err := readAllNotes(tx)
+		if err != nil {
+			return err
+		}
+		slugs := map[uuid.UUID]string{}
+		for _, note := range ours {
+			slugs[note.Uuid] = note.Slug()
+		}
+
+		for _, id := range deleted {
+			slug, ok := slugs[id]
+			if !ok {
+				continue
+			}
+			if err = b.Delete([]byte(slug)); err != nil {
+				return err
+			}
+			delete(slugs, id)
+			result.Deleted = append(result.Deleted, slug)
+		}
+		for i := range notes {
+			note := notes[i]
+			slug, ok := slugs[note.Uuid]
+			if slug, err = putNote(b, &note, slug); err != nil {
+				return err
+			}
+			slugs[note.Uuid] = slug
+			if ok {
+				result.Updated = append(result.Updated, slug)
+			} else {
+				result.Added = append(result.Added, slug)
+			}
+		}
+		result.Recipients, err = mergeRecipients(tx, recipients)
+		return err
+	})
+	return result, err
+}
@@ -0,0 +1,190 @@
+package database_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+)
+
+func provideMergeDatabases(t *testing.T) (ours, theirs *database.Database, shared model.EncryptedNote) {
+	dir := t.TempDir()
+	ours = database.NewDatabaseInstance(filepath.Join(dir, "ours.db"))
+	theirs = database.NewDatabaseInstance(filepath.Join(dir, "theirs.db"))
+	if err := ours.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	if err := theirs.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	shared, err = model.NewNote("Shared", "Text").ToEncryptedNote(*id.Recipient())
+	if err != nil {
+		t.Fatalf("Could not encrypt note: %v", err)
+	}
+	for _, db := range []*database.Database{ours, theirs} {
+		// Both databases get their own copy, as saving increments the revision
+		note := shared
+		if err = db.SaveEncryptedNote(&note); err != nil {
+			t.Fatalf("Could not save note: %v", err)
+		}
+	}
+	if err = theirs.AddRecipient(*model.NewRecipientFromIdentity("airgap", *id)); err != nil {
+		t.Fatalf("Could not add recipient: %v", err)
+	}
+	return ours, theirs, shared
+}
+
+func TestMergeAddsNotesAndRecipients(t *testing.T) {
+	ours, theirs, _ := provideMergeDatabases(t)
+	defer ours.Close()
+	defer theirs.Close()
+
+	added := model.EncryptedNote{Title: "Only theirs", Ciphertext: "ciphertext"}
+	if err := theirs.SaveEncryptedNote(&added); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+
+	result, err := ours.Merge(theirs, database.MergeKeepBoth)
+	if err != nil {
+		t.Fatalf("Could not merge databases: %v", err)
+	}
+	if len(result.Added) != 1 || result.Unchanged != 1 || len(result.Recipients) != 1 {
+		t.Fatalf("Unexpected merge result: %+v", result)
+	}
+	if available, _ := ours.CheckSlug("only-theirs"); !available {
+		t.Fatal("Note only-theirs should have been added")
+	}
+}
+
+// editNote saves a changed copy of the shared note with the given tag and modification time.
+func editNote(t *testing.T, db *database.Database, shared model.EncryptedNote, tag string, modified time.Time) {
+	changed := shared
+	changed.Tags = []string{tag}
+	changed.Modified = modified
+	if err := db.SaveEncryptedNote(&changed); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+}
+
+func TestMergeOneSidedChanges(t *testing.T) {
+	ours, theirs, shared := provideMergeDatabases(t)
+	defer ours.Close()
+	defer theirs.Close()
+
+	if _, err := ours.Merge(theirs, database.MergeKeepBoth); err != nil {
+		t.Fatalf("Could not merge databases: %v", err)
+	}
+	editNote(t, theirs, shared, "theirs", time.Now())
+	result, err := ours.Merge(theirs, database.MergeKeepBoth)
+	if err != nil {
+		t.Fatalf("Could not merge databases: %v", err)
+	}
+	if len(result.Updated) != 1 || len(result.Conflicts) != 0 || len(result.Copies) != 0 {
+		t.Fatalf("Note changed only in the other database should be fast-forwarded: %+v", result)
+	}
+
+	// Changing the local note afterwards is no conflict either, the local note is kept
+	note, err := ours.GetEncryptedNoteBySlug("shared")
+	if err != nil {
+		t.Fatalf("Could not get note: %v", err)
+	}
+	editNote(t, ours, *note, "ours", time.Now())
+	if result, err = ours.Merge(theirs, database.MergeKeepBoth); err != nil {
+		t.Fatalf("Could not merge databases: %v", err)
+	}
+	if result.Unchanged != 1 || len(result.Updated) != 0 || len(result.Conflicts) != 0 || len(result.Copies) != 0 {
+		t.Fatalf("Note changed only locally should be kept: %+v", result)
+	}
+	if note, err = ours.GetEncryptedNoteBySlug("shared"); err != nil || note.Tags[0] != "ours" {
+		t.Fatalf("Local change should have been kept: %v, %v", note, err)
+	}
+}
+
+func TestMergeMovedDatabase(t *testing.T) {
+	ours, theirs, shared := provideMergeDatabases(t)
+	defer ours.Close()
+
+	if _, err := ours.Merge(theirs, database.MergeKeepBoth); err != nil {
+		t.Fatalf("Could not merge databases: %v", err)
+	}
+	editNote(t, theirs, shared, "theirs", time.Now())
+	if err := theirs.Close(); err != nil {
+		t.Fatalf("Could not close database: %v", err)
+	}
+	// The other database is mounted at a different path when merging again
+	moved := filepath.Join(t.TempDir(), "moved.db")
+	if err := os.Rename(theirs.Path, moved); err != nil {
+		t.Fatalf("Could not move database: %v", err)
+	}
+	theirs = database.NewDatabaseInstance(moved)
+	if err := theirs.OpenReadOnly(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer theirs.Close()
+
+	result, err := ours.Merge(theirs, database.MergeKeepBoth)
+	if err != nil {
+		t.Fatalf("Could not merge databases: %v", err)
+	}
+	if len(result.Updated) != 1 || len(result.Conflicts) != 0 || len(result.Copies) != 0 {
+		t.Fatalf("Merge state should be kept for a moved database: %+v", result)
+	}
+}
+
+func TestMergeStrategies(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		strategy database.MergeStrategy
+		tag      string
+		copies   int
+	}{
+		{database.MergeOurs, "ours", 0},
+		{database.MergeTheirs, "theirs", 0},
+		{database.MergeNewest, "theirs", 0},
+		{database.MergeKeepBoth, "ours", 1},
+	} {
+		t.Run(string(test.strategy), func(t *testing.T) {
+			ours, theirs, shared := provideMergeDatabases(t)
+			defer ours.Close()
+			defer theirs.Close()
+
+			if _, err := ours.Merge(theirs, test.strategy); err != nil {
+				t.Fatalf("Could not merge databases: %v", err)
+			}
+			editNote(t, ours, shared, "ours", now)
+			editNote(t, theirs, shared, "theirs", now.Add(time.Hour))
+
+			result, err := ours.Merge(theirs, test.strategy)
+			if err != nil {
+				t.Fatalf("Could not merge databases: %v", err)
+			}
+			if len(result.Conflicts) != 1 || len(result.Copies) != test.copies {
+				t.Fatalf("Unexpected merge result: %+v", result)
+			}
+			note, err := ours.GetEncryptedNoteBySlug("shared")
+			if err != nil {
+				t.Fatalf("Could not get note: %v", err)
+			}
+			if len(note.Tags) != 1 || note.Tags[0] != test.tag {
+				t.Fatalf("Note should contain the tags of %s: %v", test.tag, note.Tags)
+			}
+
+			// The conflict is resolved, merging again does not change anything
+			if result, err = ours.Merge(theirs, test.strategy); err != nil {
+				t.Fatalf("Could not merge databases: %v", err)
+			}
+			if len(result.Conflicts) != 0 || len(result.Copies) != 0 || len(result.Updated) != 0 {
+				t.Fatalf("Merging again should not change anything: %+v", result)
+			}
+		})
+	}
+}
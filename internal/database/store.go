@@ -0,0 +1,189 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/model"
+	uuid "github.com/google/uuid"
+)
+
+// Store is implemented by all storage backends. Notes are stored by their slug, recipients and further settings
+// are kept as configuration values. The bolt database is the default backend, some features like backups,
+// integrity checks and merging are only available for it.
+type Store interface {
+	SaveEncryptedNote(encryptedNote *model.EncryptedNote) error
+	RenameEncryptedNote(encryptedNote *model.EncryptedNote, oldSlug string) error
+	GetEncryptedNotes() ([]model.EncryptedNote, error)
+	GetAllEncryptedNotes() ([]model.EncryptedNote, error)
+	GetEncryptedNoteBySlug(slug string) (*model.EncryptedNote, error)
+	GetEncryptedNoteByUuid(id uuid.UUID) (*model.EncryptedNote, error)
+	GetEncryptedNoteByIndex(idx uint) (*model.EncryptedNote, error)
+	GetEncryptedNoteByTag(tag string) ([]model.EncryptedNote, error)
+	CheckSlug(slug string) (available bool, err error)
+	DeleteNoteBySlug(slug string) error
+	ApplyChanges(notes []model.EncryptedNote, deleted []uuid.UUID, recipients []model.Recipient) (ApplyResult, error)
+	GetRecipients() ([]model.Recipient, error)
+	GetAgeRecipients() ([]age.X25519Recipient, error)
+	AddRecipient(r model.Recipient) error
+	RemoveRecipientByAlias(alias string) error
+	GetConfig(key string) ([]byte, error)
+	SetConfig(key string, value []byte) error
+	Close() error
+}
+
+var (
+	_ Store = (*Database)(nil)
+	_ Store = (*kvStore)(nil)
+)
+
+// Backends which can be selected with a URL-style path like "dir:///path/to/notebook". The in-memory store is
+// not persisted and therefore can not be selected by a path, it is created with NewMemoryStore.
+const (
+	BackendBolt      = "bolt"
+	BackendDirectory = "dir"
+)
+
+// ParseStorePath splits a URL-style path into backend and path. Paths without a scheme use the bolt backend.
+func ParseStorePath(storePath string) (backend, path string, err error) {
+	idx := strings.Index(storePath, "://")
+	if idx < 0 {
+		return BackendBolt, storePath, nil
+	}
+	backend, path = storePath[:idx], storePath[idx+3:]
+	switch backend {
+	case BackendBolt, BackendDirectory:
+		if path == "" {
+			return "", "", fmt.Errorf("path for backend %s must be given", backend)
+		}
+	default:
+		return "", "", fmt.Errorf("unknown backend %s", backend)
+	}
+	return backend, path, nil
+}
+
+// nextRevision returns the revision of a note which is saved over the stored record.
+func nextRevision(stored []byte, encryptedNote *model.EncryptedNote) uint64 {
+	revision := encryptedNote.Revision
+	if stored != nil {
+		var storedNote model.EncryptedNote
+		if json.Unmarshal(stored, &storedNote) == nil && storedNote.Uuid == encryptedNote.Uuid && storedNote.Revision > revision {
+			revision = storedNote.Revision
+		}
+	}
+	return revision + 1
+}
+
+// withoutQuicknote removes the quick note, which is not listed with the other notes.
+func withoutQuicknote(notes []model.EncryptedNote) (filtered []model.EncryptedNote) {
+	for _, note := range notes {
+		if note.Title != "quicknote" {
+			filtered = append(filtered, note)
+		}
+	}
+	return filtered
+}
+
+// noteByUuid returns the note with the given UUID.
+func noteByUuid(notes []model.EncryptedNote, id uuid.UUID) (encryptedNote *model.EncryptedNote, err error) {
+	for i := range notes {
+		if notes[i].Uuid == id {
+			return &notes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNoteNotFound, id)
+}
+
+// noteByIndex returns the note with the given index as shown by "aen list", starting at 1.
+func noteByIndex(notes []model.EncryptedNote, idx uint) (encryptedNote *model.EncryptedNote, err error) {
+	if idx == 0 || len(notes) < int(idx) {
+		return nil, fmt.Errorf("%w: %d", ErrIndexOutOfRange, idx)
+	}
+	model.SortNoteSlice(notes)
+	return &notes[idx-1], nil
+}
+
+// notesByTag returns the notes tagged with tag.
+func notesByTag(notes []model.EncryptedNote, tag string) (tagged []model.EncryptedNote) {
+	for i := range notes {
+		for j := range notes[i].Tags {
+			if notes[i].Tags[j] == tag {
+				tagged = append(tagged, notes[i])
+				break
+			}
+		}
+	}
+	return tagged
+}
+
+// parseAgeRecipients converts recipients to age recipients.
+func parseAgeRecipients(recipients []model.Recipient) (ageRecipients []age.X25519Recipient, err error) {
+	for _, recipient := range recipients {
+		r, err := age.ParseX25519Recipient(recipient.Publickey)
+		if err != nil {
+			return nil, err
+		}
+		ageRecipients = append(ageRecipients, *r)
+	}
+	return ageRecipients, nil
+}
+
+// addRecipient adds the recipient to the list. If the alias is already used, the public key is replaced.
+// If the public key is already available, the list is not changed.
+func addRecipient(recipients []model.Recipient, r model.Recipient) (updated []model.Recipient, changed bool) {
+	for idx, recipient := range recipients {
+		if r.Publickey == recipient.Publickey {
+			return recipients, false
+		} else if r.Alias == recipient.Alias {
+			recipients[idx].Publickey = r.Publickey
+			return recipients, true
+		}
+	}
+	return append(recipients, r), true
+}
+
+// removeRecipient removes the recipient with the given alias from the list.
+func removeRecipient(recipients []model.Recipient, alias string) (updated []model.Recipient, err error) {
+	for idx, r := range recipients {
+		if r.Alias == alias {
+			return append(recipients[:idx], recipients[idx+1:]...), nil
+		}
+	}
+	return nil, errors.New("alias not found")
+}
+
+// mergeRecipientList adds recipients unknown to ours. If an alias is already used for a different key,
+// a suffix is appended to the alias instead of replacing the key.
+func mergeRecipientList(ours, theirs []model.Recipient) (merged []model.Recipient, added []string) {
+	keys := map[string]bool{}
+	aliases := map[string]bool{}
+	for _, r := range ours {
+		keys[r.Publickey] = true
+		aliases[r.Alias] = true
+	}
+	for _, r := range theirs {
+		if keys[r.Publickey] {
+			continue
+		}
+		alias := r.Alias
+		for n := 2; aliases[r.Alias]; n++ {
+			r.Alias = fmt.Sprintf("%s-%d", alias, n)
+		}
+		ours = append(ours, r)
+		keys[r.Publickey] = true
+		aliases[r.Alias] = true
+		added = append(added, r.Alias)
+	}
+	return ours, added
+}
+
+// uniqueTitle appends a number to the title of the note, until its slug is not used by a different note.
+func uniqueTitle(note *model.EncryptedNote, used func(slug string) bool) {
+	title := note.Title
+	for n := 2; used(note.Slug()) || len(note.Slug()) == 0; n++ {
+		note.Title = fmt.Sprintf("%s %d", title, n)
+	}
+}
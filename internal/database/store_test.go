@@ -0,0 +1,112 @@
+package database_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+	uuid "github.com/google/uuid"
+)
+
+func provideStores(t *testing.T) map[string]database.Store {
+	dir := t.TempDir()
+	bolt := database.NewDatabaseInstance(filepath.Join(dir, "test.db"))
+	if err := bolt.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	directory, err := database.OpenDirectoryStore(filepath.Join(dir, "notes"), true)
+	if err != nil {
+		t.Fatalf("Could not open directory store: %v", err)
+	}
+	return map[string]database.Store{
+		"bolt":      bolt,
+		"directory": directory,
+		"memory":    database.NewMemoryStore(),
+	}
+}
+
+func TestStores(t *testing.T) {
+	for name, store := range provideStores(t) {
+		t.Run(name, func(t *testing.T) {
+			defer store.Close()
+
+			older := model.EncryptedNote{Uuid: uuid.New(), Title: "Older", Ciphertext: "ciphertext", Tags: []string{"tag"}}
+			newer := model.EncryptedNote{Uuid: uuid.New(), Title: "Newer", Ciphertext: "ciphertext"}
+			newer.Created = older.Created.Add(1)
+			for _, note := range []*model.EncryptedNote{&older, &newer} {
+				if err := store.SaveEncryptedNote(note); err != nil {
+					t.Fatalf("Could not save note: %v", err)
+				}
+			}
+			if err := store.SaveEncryptedNote(&older); err != nil || older.Revision != 2 {
+				t.Fatalf("Saving again should increment the revision: %d, %v", older.Revision, err)
+			}
+
+			if note, err := store.GetEncryptedNoteBySlug("older"); err != nil || note.Uuid != older.Uuid {
+				t.Fatalf("Could not get note by slug: %v", err)
+			}
+			if note, err := store.GetEncryptedNoteByUuid(newer.Uuid); err != nil || note.Title != "Newer" {
+				t.Fatalf("Could not get note by UUID: %v", err)
+			}
+			if note, err := store.GetEncryptedNoteByIndex(1); err != nil || note.Title != "Newer" {
+				t.Fatalf("Index 1 should be the newest note: %v", err)
+			}
+			if notes, err := store.GetEncryptedNoteByTag("tag"); err != nil || len(notes) != 1 {
+				t.Fatalf("Could not get notes by tag: %v", err)
+			}
+
+			renamed := older
+			renamed.Title = "Renamed"
+			if err := store.RenameEncryptedNote(&renamed, "older"); err != nil || renamed.Revision != 3 {
+				t.Fatalf("Could not rename note: %d, %v", renamed.Revision, err)
+			}
+			if available, err := store.CheckSlug("older"); err != nil || available {
+				t.Fatalf("Note should not be stored under its old slug: %v", err)
+			}
+
+			if err := store.DeleteNoteBySlug("renamed"); err != nil {
+				t.Fatalf("Could not delete note: %v", err)
+			}
+			if available, err := store.CheckSlug("renamed"); err != nil || available {
+				t.Fatalf("Note should have been deleted: %v", err)
+			}
+			if notes, err := store.GetEncryptedNotes(); err != nil || len(notes) != 1 {
+				t.Fatalf("Unexpected notes after deletion: %v, %v", notes, err)
+			}
+
+			if err := store.AddRecipient(*model.NewRecipient("alias", "age1key")); err != nil {
+				t.Fatalf("Could not add recipient: %v", err)
+			}
+			if recipients, err := store.GetRecipients(); err != nil || len(recipients) != 1 {
+				t.Fatalf("Unexpected recipients: %v, %v", recipients, err)
+			}
+			if err := store.RemoveRecipientByAlias("alias"); err != nil {
+				t.Fatalf("Could not remove recipient: %v", err)
+			}
+
+			if err := store.SetConfig("a/key", []byte("value")); err != nil {
+				t.Fatalf("Could not set config: %v", err)
+			}
+			if value, err := store.GetConfig("a/key"); err != nil || string(value) != "value" {
+				t.Fatalf("Unexpected config value: %s, %v", value, err)
+			}
+		})
+	}
+}
+
+func TestParseStorePath(t *testing.T) {
+	tests := map[string]string{
+		"notes.db":          database.BackendBolt,
+		"bolt:///notes.db":  database.BackendBolt,
+		"dir:///tmp/notes":  database.BackendDirectory,
+		"memory://":         "",
+		"unknown:///foobar": "",
+	}
+	for path, expected := range tests {
+		backend, _, err := database.ParseStorePath(path)
+		if backend != expected || (expected == "") != (err != nil) {
+			t.Fatalf("Unexpected backend for %s: %s, %v", path, backend, err)
+		}
+	}
+}
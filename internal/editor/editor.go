@@ -0,0 +1,153 @@
+// Package editor resolves and runs the external editor used for creating and editing notes.
+package editor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/3c7/aen/internal/utils"
+)
+
+// Placeholder is replaced by the path of the edited file in the arguments of an editor command.
+const Placeholder = "{}"
+
+// ErrNoEditor is returned if no editor is configured and none of the fallbacks is installed.
+var ErrNoEditor = errors.New("no editor found, set AENEDITOR, VISUAL or EDITOR or add \"editor = <command>\" to the config file")
+
+// Command is an editor command line split into words.
+type Command []string
+
+// Parse splits an editor command like a shell does, so paths containing spaces can be quoted,
+// e.g. "'/opt/My Editor/editor' --wait {}".
+func Parse(line string) (cmd Command, err error) {
+	words, err := utils.Split(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid editor command \"%s\": %v", line, err)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("invalid editor command \"%s\": command is empty", line)
+	}
+	return Command(words), nil
+}
+
+// Args returns the arguments for editing the file at path. Every placeholder is replaced by the path,
+// without placeholder the path is appended.
+func (cmd Command) Args(path string) []string {
+	args := make([]string, 0, len(cmd))
+	replaced := false
+	for _, arg := range cmd[1:] {
+		if strings.Contains(arg, Placeholder) {
+			arg = strings.ReplaceAll(arg, Placeholder, path)
+			replaced = true
+		}
+		args = append(args, arg)
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+	return args
+}
+
+// Run opens the file with the editor and waits until the editor exits. The editor is attached to the terminal,
+// so editors running inside of it can be used. The editor is killed if ctx is cancelled.
+func (cmd Command) Run(ctx context.Context, path string) error {
+	if len(cmd) == 0 {
+		return ErrNoEditor
+	}
+	c := exec.CommandContext(ctx, cmd[0], cmd.Args(path)...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %w", cmd[0], err)
+	}
+	return nil
+}
+
+// Env is the environment the editor is resolved from. Tests can replace it to use a scripted fake editor
+// without changing the environment of the process.
+type Env struct {
+	Getenv     func(key string) string
+	LookPath   func(file string) (string, error)
+	ConfigPath string // path of the config file, it is ignored if it does not exist
+}
+
+// SystemEnv returns the environment of the process, the config file is $XDG_CONFIG_HOME/aen/config
+// or the equivalent of the platform.
+func SystemEnv() Env {
+	env := Env{Getenv: os.Getenv, LookPath: exec.LookPath}
+	if dir, err := os.UserConfigDir(); err == nil {
+		env.ConfigPath = filepath.Join(dir, "aen", "config")
+	}
+	return env
+}
+
+// fallbacks are tried in order if no editor is configured.
+func fallbacks() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"codium -w", "code -w", "notepad"}
+	}
+	return []string{"codium -w", "code -w", "nvim", "vim", "nano", "vi"}
+}
+
+// Resolve returns the editor given by the first of AENEDITOR, the "editor" entry of the config file, VISUAL and
+// EDITOR which is set. If none is set, the first installed fallback is used.
+func Resolve(env Env) (cmd Command, err error) {
+	configured := env.Getenv("AENEDITOR")
+	if configured == "" && env.ConfigPath != "" {
+		if configured, err = readConfig(env.ConfigPath, "editor"); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range []string{"VISUAL", "EDITOR"} {
+		if configured == "" {
+			configured = env.Getenv(key)
+		}
+	}
+	if configured != "" {
+		return Parse(configured)
+	}
+	for _, fallback := range fallbacks() {
+		cmd, err = Parse(fallback)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = env.LookPath(cmd[0]); err == nil {
+			return cmd, nil
+		}
+	}
+	return nil, ErrNoEditor
+}
+
+// readConfig returns the value of key in the config file consisting of "<key> = <value>" lines. Empty lines
+// and lines starting with # are ignored. A missing file is not an error.
+func readConfig(path, key string) (value string, err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("%s:%d: expected <key> = <value>", path, line)
+		}
+		if strings.TrimSpace(parts[0]) == key {
+			value = strings.TrimSpace(parts[1])
+		}
+	}
+	return value, scanner.Err()
+}
@@ -0,0 +1,108 @@
+package editor_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/3c7/aen/internal/editor"
+)
+
+// Provides an environment with the given variables and installed programs
+func provideEnv(t *testing.T, vars map[string]string, installed ...string) editor.Env {
+	return editor.Env{
+		Getenv: func(key string) string { return vars[key] },
+		LookPath: func(file string) (string, error) {
+			for _, name := range installed {
+				if name == file {
+					return "/usr/bin/" + file, nil
+				}
+			}
+			return "", exec.ErrNotFound
+		},
+		ConfigPath: filepath.Join(t.TempDir(), "config"),
+	}
+}
+
+func TestResolveOrder(t *testing.T) {
+	env := provideEnv(t, map[string]string{"VISUAL": "visual", "EDITOR": "editor"}, "vim")
+	if err := os.WriteFile(env.ConfigPath, []byte("# comment\neditor = '/opt/My Editor/edit' --wait\n"), 0600); err != nil {
+		t.Fatalf("Could not write config: %v", err)
+	}
+	cmd, err := editor.Resolve(env)
+	if err != nil || cmd[0] != "/opt/My Editor/edit" || len(cmd) != 2 {
+		t.Fatalf("Editor of the config file should be used but was %q: %v", cmd, err)
+	}
+
+	env = provideEnv(t, map[string]string{"AENEDITOR": "aeneditor", "VISUAL": "visual"})
+	if cmd, err = editor.Resolve(env); err != nil || cmd[0] != "aeneditor" {
+		t.Fatalf("AENEDITOR should be used but was %q: %v", cmd, err)
+	}
+	env = provideEnv(t, map[string]string{"VISUAL": "visual", "EDITOR": "editor"})
+	if cmd, err = editor.Resolve(env); err != nil || cmd[0] != "visual" {
+		t.Fatalf("VISUAL should be used but was %q: %v", cmd, err)
+	}
+	env = provideEnv(t, map[string]string{"EDITOR": "editor"})
+	if cmd, err = editor.Resolve(env); err != nil || cmd[0] != "editor" {
+		t.Fatalf("EDITOR should be used but was %q: %v", cmd, err)
+	}
+	env = provideEnv(t, nil, "nano", "vim")
+	if cmd, err = editor.Resolve(env); err != nil || (runtime.GOOS != "windows" && cmd[0] != "vim") {
+		t.Fatalf("First installed fallback should be used but was %q: %v", cmd, err)
+	}
+	env = provideEnv(t, nil)
+	if _, err = editor.Resolve(env); !errors.Is(err, editor.ErrNoEditor) {
+		t.Fatalf("Resolve should fail without editor: %v", err)
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	cmd, err := editor.Parse(`"/opt/My Editor/edit" --file={} -n`)
+	if err != nil {
+		t.Fatalf("Could not parse command: %v", err)
+	}
+	if args := cmd.Args("/tmp/note.md"); strings.Join(args, "|") != "--file=/tmp/note.md|-n" {
+		t.Fatalf("Placeholder should be replaced but args were %q", args)
+	}
+	cmd, _ = editor.Parse("vim -f")
+	if args := cmd.Args("/tmp/note.md"); strings.Join(args, "|") != "-f|/tmp/note.md" {
+		t.Fatalf("Path should be appended but args were %q", args)
+	}
+	if _, err = editor.Parse(`vim "unterminated`); err == nil {
+		t.Fatal("Parse should fail for an unterminated quote")
+	}
+	if _, err = editor.Parse("  "); err == nil {
+		t.Fatal("Parse should fail for an empty command")
+	}
+}
+
+func TestRunFakeEditor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake editor is a shell script")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "fake editor.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho edited >> \"$2\"\n"), 0700); err != nil {
+		t.Fatalf("Could not write fake editor: %v", err)
+	}
+	env := provideEnv(t, map[string]string{"AENEDITOR": "'" + script + "' --wait {}"})
+	cmd, err := editor.Resolve(env)
+	if err != nil {
+		t.Fatalf("Could not resolve editor: %v", err)
+	}
+	path := filepath.Join(dir, "note.md")
+	if err = os.WriteFile(path, []byte("note\n"), 0600); err != nil {
+		t.Fatalf("Could not write note: %v", err)
+	}
+	if err = cmd.Run(context.Background(), path); err != nil {
+		t.Fatalf("Could not run fake editor: %v", err)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "note\nedited\n" {
+		t.Fatalf("Note should be edited by the fake editor but was %q: %v", content, err)
+	}
+}
@@ -0,0 +1,148 @@
+package export
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+	"github.com/3c7/aen/internal/utils"
+	uuid "github.com/google/uuid"
+)
+
+// IndexName is the name of the plaintext file describing the exported notes.
+const IndexName = "index.json"
+
+// Index is written as plaintext index.json and contains the metadata which is not part of the ciphertexts.
+type Index struct {
+	Exported   time.Time
+	Recipients []model.Recipient
+	Notes      []IndexNote
+}
+
+type IndexNote struct {
+	Uuid        uuid.UUID
+	Time        time.Time
+	Title       string
+	Slug        string
+	Tags        []string
+	IsFile      bool
+	File        string // path relative to the export directory
+	Attachments []IndexAttachment
+}
+
+type IndexAttachment struct {
+	Filename string
+	File     string // path relative to the export directory
+	Md5      string
+	Sha1     string
+	Sha256   string
+	Sha512   string
+}
+
+// ExportStore exports all notes of the store, including the quick note, and its recipients with Export.
+func ExportStore(store database.Store, dir string) (index *Index, err error) {
+	notes, err := store.GetAllEncryptedNotes()
+	if err != nil {
+		return nil, err
+	}
+	recipients, err := store.GetRecipients()
+	if err != nil {
+		return nil, err
+	}
+	return Export(notes, recipients, dir)
+}
+
+// Export writes every note into the directory dir. The stored ciphertexts are only base64 decoded, so the
+// files can be decrypted with the age CLI directly. Text notes are written to <slug>.md.age, file notes to
+// <slug>.age and attachments to <slug>/<filename>.age. If the names of different notes collide, e.g. as
+// both titles are empty, a number is appended to the slug. The metadata is written to the plaintext index.json.
+func Export(notes []model.EncryptedNote, recipients []model.Recipient, dir string) (index *Index, err error) {
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	index = &Index{
+		Exported:   time.Now(),
+		Recipients: recipients,
+	}
+	model.SortNoteSlice(notes)
+	usedNames := map[string]bool{}
+	for i := range notes {
+		note := &notes[i]
+		slug := uniqueName(usedNames, utils.SafeFilename(note.Slug()), note.ContainsFile())
+		entry := IndexNote{
+			Uuid:   note.Uuid,
+			Time:   note.Created,
+			Title:  note.Title,
+			Slug:   note.Slug(),
+			Tags:   note.Tags,
+			IsFile: note.ContainsFile(),
+			File:   slug + ".md.age",
+		}
+		if entry.IsFile {
+			entry.File = slug + ".age"
+		}
+		if err = writeCiphertext(filepath.Join(dir, entry.File), note.Ciphertext); err != nil {
+			return nil, fmt.Errorf("could not export note %s: %v", note.Slug(), err)
+		}
+
+		used := map[string]bool{}
+		for _, attachment := range note.Attachments {
+			name := utils.SafeFilename(attachment.Filename)
+			for n := 1; used[name]; n++ {
+				name = fmt.Sprintf("%d-%s", n, utils.SafeFilename(attachment.Filename))
+			}
+			used[name] = true
+			file := filepath.Join(slug, name+".age")
+			if err = os.MkdirAll(filepath.Join(dir, slug), 0700); err != nil {
+				return nil, err
+			}
+			if err = writeCiphertext(filepath.Join(dir, file), attachment.Ciphertext); err != nil {
+				return nil, fmt.Errorf("could not export attachment %s of note %s: %v", attachment.Filename, note.Slug(), err)
+			}
+			entry.Attachments = append(entry.Attachments, IndexAttachment{
+				Filename: attachment.Filename,
+				File:     file,
+				Md5:      attachment.Md5,
+				Sha1:     attachment.Sha1,
+				Sha256:   attachment.Sha256,
+				Sha512:   attachment.Sha512,
+			})
+		}
+		index.Notes = append(index.Notes, entry)
+	}
+
+	buf, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return index, os.WriteFile(filepath.Join(dir, IndexName), buf, 0600)
+}
+
+// uniqueName returns name, or name with a number appended, so that neither the file of the note nor the directory of
+// its attachments is used by a note exported before. The names used are added to used.
+func uniqueName(used map[string]bool, name string, isFile bool) string {
+	ext := ".md.age"
+	if isFile {
+		ext = ".age"
+	}
+	unique := name
+	for n := 2; used[unique] || used[unique+ext]; n++ {
+		unique = fmt.Sprintf("%s-%d", name, n)
+	}
+	used[unique] = true
+	used[unique+ext] = true
+	return unique
+}
+
+func writeCiphertext(path, ciphertext string) (err error) {
+	decoded, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return fmt.Errorf("could not decode ciphertext: %v", err)
+	}
+	return os.WriteFile(path, decoded, 0600)
+}
@@ -0,0 +1,116 @@
+package export_test
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/export"
+	"github.com/3c7/aen/internal/model"
+)
+
+func decryptFile(t *testing.T, path string, identity age.Identity) string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Could not open exported file: %v", err)
+	}
+	defer f.Close()
+	r, err := age.Decrypt(f, identity)
+	if err != nil {
+		t.Fatalf("Could not decrypt %s: %v", path, err)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Could not read %s: %v", path, err)
+	}
+	return string(content)
+}
+
+func TestExport(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	note := model.NewNote("Exported Note", "Secret text")
+	note.Attachments = append(note.Attachments, *model.NewAttachment("../data.txt", []byte("Attached")))
+	encryptedNote, err := note.ToEncryptedNote(*identity.Recipient())
+	if err != nil {
+		t.Fatalf("Could not encrypt note: %v", err)
+	}
+	fileNote, err := model.NewFileNote("capture.pcap", []byte{0xc0, 0xff, 0xee}).ToEncryptedNote(*identity.Recipient())
+	if err != nil {
+		t.Fatalf("Could not encrypt file note: %v", err)
+	}
+
+	dir := t.TempDir()
+	recipients := []model.Recipient{*model.NewRecipientFromIdentity("me", *identity)}
+	if _, err = export.Export([]model.EncryptedNote{encryptedNote, fileNote}, recipients, dir); err != nil {
+		t.Fatalf("Could not export notes: %v", err)
+	}
+
+	if text := decryptFile(t, filepath.Join(dir, "exported-note.md.age"), identity); text != "Secret text" {
+		t.Fatalf("Note text should be \"Secret text\" but was %q", text)
+	}
+	if content := decryptFile(t, filepath.Join(dir, "exported-note", ".._data.txt.age"), identity); content != "Attached" {
+		t.Fatalf("Attachment should be \"Attached\" but was %q", content)
+	}
+	if content := decryptFile(t, filepath.Join(dir, "capturepcap.age"), identity); content != "\xc0\xff\xee" {
+		t.Fatalf("File note content differs: %q", content)
+	}
+
+	buf, err := os.ReadFile(filepath.Join(dir, export.IndexName))
+	if err != nil {
+		t.Fatalf("Could not read index: %v", err)
+	}
+	var index export.Index
+	if err = json.Unmarshal(buf, &index); err != nil {
+		t.Fatalf("Could not parse index: %v", err)
+	}
+	if len(index.Notes) != 2 || len(index.Recipients) != 1 {
+		t.Fatalf("Index should contain 2 notes and 1 recipient: %+v", index)
+	}
+}
+
+func TestExportStore(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	store := database.NewMemoryStore()
+	if err = store.AddRecipient(*model.NewRecipientFromIdentity("me", *identity)); err != nil {
+		t.Fatalf("Could not add recipient: %v", err)
+	}
+	for _, note := range []*model.Note{
+		model.NewNote("quicknote", "Quick"),
+		model.NewNote("", "Untitled"),
+		model.NewNote("unnamed", "Named unnamed"),
+	} {
+		encryptedNote, err := note.ToEncryptedNote(*identity.Recipient())
+		if err != nil {
+			t.Fatalf("Could not encrypt note: %v", err)
+		}
+		if err = store.SaveEncryptedNote(&encryptedNote); err != nil {
+			t.Fatalf("Could not save note: %v", err)
+		}
+	}
+
+	dir := t.TempDir()
+	index, err := export.ExportStore(store, dir)
+	if err != nil {
+		t.Fatalf("Could not export notes: %v", err)
+	}
+	if len(index.Notes) != 3 {
+		t.Fatalf("Index should contain 3 notes including the quick note: %+v", index.Notes)
+	}
+	texts := map[string]bool{}
+	for _, note := range index.Notes {
+		texts[decryptFile(t, filepath.Join(dir, note.File), identity)] = true
+	}
+	if !texts["Quick"] || !texts["Untitled"] || !texts["Named unnamed"] {
+		t.Fatalf("Every note should be exported to its own file: %v", texts)
+	}
+}
@@ -0,0 +1,188 @@
+package frontmatter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Delimiter starts and ends a front matter block.
+const Delimiter = "---"
+
+// Field is a single key of a front matter block, either a scalar value or a list of values.
+type Field struct {
+	Key    string
+	Value  string
+	List   []string
+	IsList bool
+}
+
+// FrontMatter keeps the fields of a block in the order they were given.
+type FrontMatter []Field
+
+// Split separates a front matter block delimited by "---" lines from the remaining content.
+// If the content does not start with a front matter block, ok is false and body contains the whole content.
+func Split(content string) (block string, body string, ok bool) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	normalized := strings.ReplaceAll(content, "\r\n", "\n")
+	if !strings.HasPrefix(normalized, Delimiter+"\n") {
+		return "", content, false
+	}
+	rest := normalized[len(Delimiter)+1:]
+	if strings.HasPrefix(rest, Delimiter+"\n") || rest == Delimiter {
+		return "", strings.TrimPrefix(rest[len(Delimiter):], "\n"), true
+	}
+	end := strings.Index(rest, "\n"+Delimiter+"\n")
+	if end < 0 {
+		if strings.HasSuffix(rest, "\n"+Delimiter) {
+			return rest[:len(rest)-len(Delimiter)-1], "", true
+		}
+		return "", content, false
+	}
+	return rest[:end], rest[end+len(Delimiter)+2:], true
+}
+
+// Parse parses the subset of YAML used in front matter blocks: scalar values, inline lists ("[a, b]") and
+// block lists ("- a" on the following lines). Comments and empty lines are ignored.
+func Parse(block string) (fm FrontMatter, err error) {
+	lines := strings.Split(strings.ReplaceAll(block, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if len(fm) == 0 || !fm[len(fm)-1].IsList || len(fm[len(fm)-1].Value) > 0 {
+				return nil, fmt.Errorf("line %d: list item without key", i+1)
+			}
+			fm[len(fm)-1].List = append(fm[len(fm)-1].List, unquote(strings.TrimSpace(trimmed[1:])))
+			continue
+		}
+
+		sep := strings.Index(trimmed, ":")
+		if sep <= 0 {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		field := Field{
+			Key: strings.TrimSpace(trimmed[:sep]),
+		}
+		value := strings.TrimSpace(trimmed[sep+1:])
+		switch {
+		case len(value) == 0:
+			// Either an empty value or the start of a block list
+			field.IsList = true
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: unterminated list", i+1)
+			}
+			field.IsList = true
+			field.List = splitList(value[1 : len(value)-1])
+		default:
+			field.Value = unquote(value)
+		}
+		fm = append(fm, field)
+	}
+	return fm, nil
+}
+
+func splitList(s string) (items []string) {
+	var current strings.Builder
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+			current.WriteRune(r)
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+			current.WriteRune(r)
+		case quote == 0 && r == ',':
+			items = append(items, unquote(strings.TrimSpace(current.String())))
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if last := strings.TrimSpace(current.String()); len(last) > 0 {
+		items = append(items, unquote(last))
+	}
+	return items
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 {
+		if (s[0] == '"' && s[len(s)-1] == '"') || (s[0] == '\'' && s[len(s)-1] == '\'') {
+			return s[1 : len(s)-1]
+		}
+	}
+	// Strip trailing comments of unquoted values
+	if idx := strings.Index(s, " #"); idx >= 0 {
+		return strings.TrimSpace(s[:idx])
+	}
+	return s
+}
+
+// Lookup returns the field with the given key.
+func (fm FrontMatter) Lookup(key string) (field Field, err error) {
+	for _, f := range fm {
+		if f.Key == key {
+			return f, nil
+		}
+	}
+	return Field{}, errors.New("field not found")
+}
+
+// Get returns the scalar value of the given key or an empty string, if the key is not available.
+func (fm FrontMatter) Get(key string) string {
+	field, err := fm.Lookup(key)
+	if err != nil {
+		return ""
+	}
+	return field.Value
+}
+
+// Values returns the list given for a key. Scalar values are split on commas and spaces,
+// so "tags: a, b" and "tags: [a, b]" lead to the same result.
+func (fm FrontMatter) Values(key string) (values []string) {
+	field, err := fm.Lookup(key)
+	if err != nil {
+		return nil
+	}
+	if field.IsList {
+		return field.List
+	}
+	for _, v := range strings.FieldsFunc(field.Value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		values = append(values, strings.TrimSpace(v))
+	}
+	return values
+}
+
+// String formats the fields as front matter block including the delimiters, so it can be parsed again by
+// Split and Parse. Lists are written inline, values are quoted if necessary.
+func (fm FrontMatter) String() string {
+	var b strings.Builder
+	b.WriteString(Delimiter + "\n")
+	for _, field := range fm {
+		if field.IsList {
+			items := make([]string, len(field.List))
+			for i, item := range field.List {
+				items[i] = quote(item, ",]")
+			}
+			fmt.Fprintf(&b, "%s: [%s]\n", field.Key, strings.Join(items, ", "))
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\n", field.Key, quote(field.Value, ""))
+	}
+	b.WriteString(Delimiter + "\n")
+	return b.String()
+}
+
+// quote adds double quotes to values which would be changed by parsing them otherwise. As unquote only removes
+// the outer quotes, quotes inside the value do not need to be escaped.
+func quote(s, special string) string {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s[:1], "\"'#[-") || strings.Contains(s, " #") ||
+		strings.ContainsAny(s, special) {
+		return "\"" + s + "\""
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package frontmatter_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/3c7/aen/internal/frontmatter"
+)
+
+func TestSplit(t *testing.T) {
+	block, body, ok := frontmatter.Split("---\ntitle: Test\n---\n# Heading\nText")
+	if !ok {
+		t.Fatal("Front matter block should be found")
+	}
+	if block != "title: Test" {
+		t.Fatalf("Block should be \"title: Test\" but was %q", block)
+	}
+	if body != "# Heading\nText" {
+		t.Fatalf("Body should be \"# Heading\\nText\" but was %q", body)
+	}
+
+	if _, body, ok = frontmatter.Split("# No front matter\n---\n"); ok || body != "# No front matter\n---\n" {
+		t.Fatalf("Content without front matter should be returned unchanged, was %q", body)
+	}
+}
+
+func TestParse(t *testing.T) {
+	block := strings.Join([]string{
+		"title: \"Quoted: title\"",
+		"# comment",
+		"tags: [work, 'case notes']",
+		"aliases:",
+		"  - first",
+		"  - second",
+		"category: incident # trailing comment",
+		"empty:",
+	}, "\n")
+	fm, err := frontmatter.Parse(block)
+	if err != nil {
+		t.Fatalf("Could not parse front matter: %v", err)
+	}
+	if title := fm.Get("title"); title != "Quoted: title" {
+		t.Fatalf("Title should be \"Quoted: title\" but was %q", title)
+	}
+	if tags := strings.Join(fm.Values("tags"), "|"); tags != "work|case notes" {
+		t.Fatalf("Tags should be work|case notes but were %s", tags)
+	}
+	if aliases := strings.Join(fm.Values("aliases"), "|"); aliases != "first|second" {
+		t.Fatalf("Aliases should be first|second but were %s", aliases)
+	}
+	if category := fm.Get("category"); category != "incident" {
+		t.Fatalf("Category should be incident but was %q", category)
+	}
+	if len(fm.Values("empty")) != 0 {
+		t.Fatal("Empty field should not contain any values")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := frontmatter.Parse("no separator here"); err == nil {
+		t.Fatal("Parsing a line without key should fail")
+	}
+	if _, err := frontmatter.Parse("- item"); err == nil {
+		t.Fatal("Parsing a list item without key should fail")
+	}
+}
+
+func TestString(t *testing.T) {
+	fm := frontmatter.FrontMatter{
+		{Key: "title", Value: "Quoted: \"title\" # not a comment"},
+		{Key: "tags", IsList: true, List: []string{"work", "a, b"}},
+		{Key: "empty", IsList: true},
+		{Key: "plain", Value: "value"},
+	}
+	block, body, ok := frontmatter.Split(fm.String() + "Text")
+	if !ok || body != "Text" {
+		t.Fatalf("Formatted front matter should be split again: %q", body)
+	}
+	parsed, err := frontmatter.Parse(block)
+	if err != nil {
+		t.Fatalf("Could not parse formatted front matter: %v", err)
+	}
+	if title := parsed.Get("title"); title != fm[0].Value {
+		t.Fatalf("Title should be %q but was %q", fm[0].Value, title)
+	}
+	if tags := strings.Join(parsed.Values("tags"), "|"); tags != "work|a, b" {
+		t.Fatalf("Tags should be work|a, b but were %s", tags)
+	}
+	if len(parsed.Values("empty")) != 0 || parsed.Get("plain") != "value" {
+		t.Fatalf("Unexpected fields: %+v", parsed)
+	}
+}
@@ -0,0 +1,249 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/3c7/aen/internal/frontmatter"
+	"github.com/3c7/aen/internal/model"
+)
+
+var (
+	numberedTitle = regexp.MustCompile(`^(.*) [0-9]+$`)
+	markdownLink  = regexp.MustCompile(`!?\[[^\]]*\]\(<?([^)>]+?)>?(?:\s+"[^"]*")?\)`)
+	wikiLink      = regexp.MustCompile(`!?\[\[([^\]|#]+)(?:[#|][^\]]*)?\]\]`)
+)
+
+// Candidate is a Markdown file found by Scan which can be imported as note.
+type Candidate struct {
+	Path        string     // path of the Markdown file
+	Note        model.Note // note with title, text and the modification time of the file
+	Tags        []string   // tags derived from folders and front matter
+	Attachments []string   // paths of linked non-Markdown files
+	Hash        string     // content hash, see ContentHash
+	Duplicate   string     // slug of an existing note with the same content
+}
+
+// ContentHash returns the hash used for detecting notes which were already imported.
+func ContentHash(title, text string) string {
+	h := sha256.Sum256([]byte(title + "\n" + text))
+	return hex.EncodeToString(h[:])
+}
+
+// IsMarkdown returns true for files with a Markdown extension.
+func IsMarkdown(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// Scan walks the directory root and parses all Markdown files. Hidden files and directories, like the
+// .obsidian folder, are skipped.
+func Scan(root string) (candidates []Candidate, err error) {
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	var markdownFiles []string
+	filesByName := map[string][]string{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if IsMarkdown(path) {
+			markdownFiles = append(markdownFiles, path)
+		} else {
+			filesByName[strings.ToLower(d.Name())] = append(filesByName[strings.ToLower(d.Name())], path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range markdownFiles {
+		candidate, err := parseFile(root, path, filesByName)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s: %v", path, err)
+		}
+		candidates = append(candidates, *candidate)
+	}
+	return candidates, nil
+}
+
+func parseFile(root, path string, filesByName map[string][]string) (candidate *Candidate, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fm frontmatter.FrontMatter
+	block, body, ok := frontmatter.Split(string(content))
+	if ok {
+		if fm, err = frontmatter.Parse(block); err != nil {
+			return nil, fmt.Errorf("invalid front matter: %v", err)
+		}
+	}
+
+	title, text := splitTitle(body)
+	if t := fm.Get("title"); len(t) > 0 {
+		title = t
+	}
+	if len(title) == 0 {
+		title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	note := model.NewNote(title, text)
+	note.Created = info.ModTime()
+	candidate = &Candidate{
+		Path: path,
+		Note: *note,
+		Hash: ContentHash(title, text),
+	}
+
+	rel, err := filepath.Rel(root, filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	if rel != "." {
+		candidate.Tags = append(candidate.Tags, strings.Split(filepath.ToSlash(rel), "/")...)
+	}
+	for _, tag := range fm.Values("tags") {
+		candidate.Tags = append(candidate.Tags, strings.TrimPrefix(tag, "#"))
+	}
+	candidate.Tags = unique(candidate.Tags)
+	candidate.Attachments = findAttachments(root, path, body, filesByName)
+	return candidate, nil
+}
+
+// splitTitle uses the first line as title, if it is a heading, the same way as model.NotefileToNote.
+// Otherwise the title is empty and the whole content is used as text.
+func splitTitle(body string) (title, text string) {
+	body = strings.TrimLeft(body, "\n")
+	lines := strings.SplitN(body, "\n", 2)
+	if !strings.HasPrefix(lines[0], "#") {
+		return "", body
+	}
+	title = strings.TrimSpace(strings.TrimLeft(lines[0], "#"))
+	if len(lines) > 1 {
+		text = strings.TrimLeft(lines[1], "\n")
+	}
+	return title, text
+}
+
+// findAttachments returns the non-Markdown files inside root which are linked from the note. Markdown links are
+// resolved relative to the note, wiki links ("[[file.pdf]]") are looked up by their name in the whole directory.
+func findAttachments(root, path, body string, filesByName map[string][]string) (attachments []string) {
+	var targets []string
+	for _, match := range markdownLink.FindAllStringSubmatch(body, -1) {
+		link := match[1]
+		if strings.Contains(link, "://") || strings.HasPrefix(link, "#") || strings.HasPrefix(link, "mailto:") {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(link); err == nil {
+			link = unescaped
+		}
+		if idx := strings.Index(link, "#"); idx > 0 {
+			link = link[:idx]
+		}
+		targets = append(targets, filepath.Join(filepath.Dir(path), filepath.FromSlash(link)))
+	}
+	for _, match := range wikiLink.FindAllStringSubmatch(body, -1) {
+		link := strings.TrimSpace(match[1])
+		candidate := filepath.Join(filepath.Dir(path), filepath.FromSlash(link))
+		if _, err := os.Stat(candidate); err == nil {
+			targets = append(targets, candidate)
+		} else if found := filesByName[strings.ToLower(filepath.Base(link))]; len(found) > 0 {
+			targets = append(targets, found[0])
+		}
+	}
+
+	for _, target := range unique(targets) {
+		rel, err := filepath.Rel(root, target)
+		if err != nil || strings.HasPrefix(rel, "..") || IsMarkdown(target) {
+			continue
+		}
+		if info, err := os.Stat(target); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		attachments = append(attachments, target)
+	}
+	return attachments
+}
+
+func unique(values []string) (result []string) {
+	seen := map[string]bool{}
+	for _, v := range values {
+		if len(v) == 0 || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	return result
+}
+
+// MarkDuplicates sets Candidate.Duplicate for all candidates which have the same content as one of the existing
+// notes or an earlier candidate.
+func MarkDuplicates(candidates []Candidate, existing []model.Note) {
+	slugsByHash := map[string]string{}
+	for i := range existing {
+		slugsByHash[ContentHash(existing[i].Title, existing[i].Text)] = existing[i].Slug()
+		// Titles might have been numbered by ResolveTitles during a previous import
+		if match := numberedTitle.FindStringSubmatch(existing[i].Title); match != nil {
+			if _, ok := slugsByHash[ContentHash(match[1], existing[i].Text)]; !ok {
+				slugsByHash[ContentHash(match[1], existing[i].Text)] = existing[i].Slug()
+			}
+		}
+	}
+	for i := range candidates {
+		if slug, ok := slugsByHash[candidates[i].Hash]; ok {
+			candidates[i].Duplicate = slug
+			continue
+		}
+		slugsByHash[candidates[i].Hash] = candidates[i].Note.Slug()
+	}
+}
+
+// ResolveTitles changes the titles of candidates which would overwrite an existing note or another candidate,
+// as notes are stored by their slug. A counter is appended to the title in that case.
+func ResolveTitles(candidates []Candidate, usedSlugs []string) {
+	used := map[string]bool{}
+	for _, slug := range usedSlugs {
+		used[slug] = true
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Note.Created.Before(candidates[j].Note.Created)
+	})
+	for i := range candidates {
+		if len(candidates[i].Duplicate) > 0 {
+			continue
+		}
+		note := &candidates[i].Note
+		title := note.Title
+		for n := 2; used[note.Slug()] || len(note.Slug()) == 0; n++ {
+			note.Title = fmt.Sprintf("%s %d", title, n)
+		}
+		used[note.Slug()] = true
+	}
+}
@@ -0,0 +1,102 @@
+package importer_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/3c7/aen/internal/importer"
+	"github.com/3c7/aen/internal/model"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	vault := t.TempDir()
+	writeFile(t, filepath.Join(vault, "work", "incidents", "case.md"),
+		"---\ntags: [urgent, \"#phishing\"]\n---\n# Case 42\nSee ![[mail.eml]] and [report](../report%20final.pdf).\n")
+	writeFile(t, filepath.Join(vault, "work", "report final.pdf"), "PDF")
+	writeFile(t, filepath.Join(vault, "attachments", "mail.eml"), "Mail")
+	writeFile(t, filepath.Join(vault, "plain.md"), "No heading here")
+	writeFile(t, filepath.Join(vault, ".obsidian", "hidden.md"), "# Hidden")
+	modified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(vault, "plain.md"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates, err := importer.Scan(vault)
+	if err != nil {
+		t.Fatalf("Could not scan directory: %v", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("Scan should find 2 notes but found %d", len(candidates))
+	}
+
+	for _, c := range candidates {
+		switch filepath.Base(c.Path) {
+		case "case.md":
+			if c.Note.Title != "Case 42" {
+				t.Errorf("Title should be \"Case 42\" but was %q", c.Note.Title)
+			}
+			if tags := strings.Join(c.Tags, ","); tags != "work,incidents,urgent,phishing" {
+				t.Errorf("Tags should be work,incidents,urgent,phishing but were %s", tags)
+			}
+			if len(c.Attachments) != 2 {
+				t.Errorf("Note should have 2 attachments but had %v", c.Attachments)
+			}
+		case "plain.md":
+			if c.Note.Title != "plain" || c.Note.Text != "No heading here" {
+				t.Errorf("Title should be derived from the filename: %+v", c.Note)
+			}
+			if !c.Note.Created.Equal(modified) {
+				t.Errorf("Time should be %s but was %s", modified, c.Note.Created)
+			}
+		default:
+			t.Errorf("Unexpected note %s", c.Path)
+		}
+	}
+}
+
+func TestDuplicatesAndTitles(t *testing.T) {
+	vault := t.TempDir()
+	writeFile(t, filepath.Join(vault, "a.md"), "# Same\nText")
+	writeFile(t, filepath.Join(vault, "b.md"), "# Same\nOther text")
+	candidates, err := importer.Scan(vault)
+	if err != nil {
+		t.Fatalf("Could not scan directory: %v", err)
+	}
+
+	existing := []model.Note{*model.NewNote("Same", "Text")}
+	importer.MarkDuplicates(candidates, existing)
+	importer.ResolveTitles(candidates, []string{"same"})
+	for _, c := range candidates {
+		switch filepath.Base(c.Path) {
+		case "a.md":
+			if c.Duplicate != "same" {
+				t.Errorf("a.md should be detected as duplicate of \"same\"")
+			}
+		case "b.md":
+			if c.Duplicate != "" || c.Note.Title != "Same 2" {
+				t.Errorf("b.md should be imported as \"Same 2\" but was %+v", c)
+			}
+		}
+	}
+
+	// Importing again must detect the renamed note as well
+	existing = append(existing, *model.NewNote("Same 2", "Other text"))
+	importer.MarkDuplicates(candidates, existing)
+	for _, c := range candidates {
+		if c.Duplicate == "" {
+			t.Errorf("%s should be detected as duplicate", c.Path)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package model
+
+import "errors"
+
+// Errors returned by the model, callers can check for them using errors.Is.
+var (
+	ErrNoRecipients    = errors.New("no recipients given")
+	ErrDecryptFailed   = errors.New("decryption failed")
+	ErrIndexOutOfRange = errors.New("index is out of range")
+	ErrTagNotFound     = errors.New("tag not found")
+	ErrTooLarge        = errors.New("content is too large")
+)
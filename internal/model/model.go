@@ -12,7 +12,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	gopath "path"
 	"regexp"
@@ -21,6 +20,7 @@ import (
 	"time"
 
 	"filippo.io/age"
+	"github.com/3c7/aen/internal/frontmatter"
 	uuid "github.com/google/uuid"
 )
 
@@ -49,10 +49,13 @@ func (r *Recipient) Json() (j []byte, err error) {
 
 type Note struct {
 	Uuid        uuid.UUID
-	Time        time.Time
+	Created     time.Time `json:"Time"` // named Time in records written before Modified was added
+	Modified    time.Time
 	Title       string
 	Text        string
 	Attachments []Attachment
+	Tags        []string
+	Fields      map[string]string // custom fields, stored unencrypted like tags
 }
 
 type Attachment struct {
@@ -71,11 +74,12 @@ type FileNote struct {
 
 func NewNote(title string, text string) (note *Note) {
 	return &Note{
-		uuid.New(),
-		time.Now(),
-		title,
-		text,
-		[]Attachment{},
+		Uuid:        uuid.New(),
+		Created:     time.Now(),
+		Title:       title,
+		Text:        text,
+		Attachments: []Attachment{},
+		Tags:        []string{},
 	}
 }
 
@@ -121,13 +125,11 @@ func NewFileNote(title string, content []byte) (note *FileNote) {
 	}
 }
 
-func (note *Note) Slug() (slug string) {
-	regex, err := regexp.Compile("[^a-zA-Z0-9 ]+")
-	if err != nil {
-		log.Fatalf("Error compiling regular expression: %v", err)
-	}
+// slugRegex matches all characters removed from titles for creating slugs
+var slugRegex = regexp.MustCompile("[^a-zA-Z0-9 ]+")
 
-	slug = regex.ReplaceAllString(note.Title, "")
+func (note *Note) Slug() (slug string) {
+	slug = slugRegex.ReplaceAllString(note.Title, "")
 	slug = strings.ReplaceAll(slug, " ", "-")
 	slug = strings.ToLower(slug)
 	return slug
@@ -149,7 +151,18 @@ func (note *Note) AttachFile(filepath, filename string) (err error) {
 	return nil
 }
 
-// Reads a file and parses it's content. The resulting Note does not have a UUID or a Time set.
+// Keys of the front matter written by ToFile, all other keys are custom fields.
+const (
+	keyTitle   = "title"
+	keyTags    = "tags"
+	keyCreated = "created"
+	// keyModified is only written for information, it is set when the note is saved
+	keyModified = "modified"
+)
+
+// Reads a file and parses it's content. The resulting Note does not have a UUID set. If the file starts with a
+// front matter block, title, tags, creation time and custom fields are taken from it. Otherwise the first line
+// is used as title and the time is not set. Invalid front matter results in an error describing the problem.
 func NotefileToNote(path string) (note *Note, err error) {
 	if _, err = os.Stat(path); err != nil {
 		return nil, err
@@ -160,6 +173,10 @@ func NotefileToNote(path string) (note *Note, err error) {
 		return nil, err
 	}
 
+	block, body, ok := frontmatter.Split(string(content))
+	if ok {
+		return parseFrontMatter(block, body)
+	}
 	lines := strings.Split(string(content), "\n")
 	title := lines[0]
 	if len(title) > 2 {
@@ -176,6 +193,50 @@ func NotefileToNote(path string) (note *Note, err error) {
 	}, nil
 }
 
+func parseFrontMatter(block, body string) (note *Note, err error) {
+	fm, err := frontmatter.Parse(block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid front matter: %v", err)
+	}
+	note = &Note{Text: body, Tags: []string{}}
+	for _, field := range fm {
+		switch field.Key {
+		case keyTitle:
+			note.Title = field.Value
+		case keyTags:
+			for _, tag := range fm.Values(keyTags) {
+				if tag != "" && !containsString(note.Tags, tag) {
+					note.Tags = append(note.Tags, tag)
+				}
+			}
+		case keyCreated:
+			if field.Value == "" {
+				continue
+			}
+			if note.Created, err = time.Parse(time.RFC3339, field.Value); err != nil {
+				return nil, fmt.Errorf("invalid front matter: created must be given as %s", time.RFC3339)
+			}
+		case keyModified:
+			continue
+		default:
+			if field.IsList && len(field.List) > 0 {
+				return nil, fmt.Errorf("invalid front matter: field %s must be a single value", field.Key)
+			}
+			if note.Fields == nil {
+				note.Fields = map[string]string{}
+			}
+			if _, given := note.Fields[field.Key]; given {
+				return nil, fmt.Errorf("invalid front matter: field %s is given twice", field.Key)
+			}
+			note.Fields[field.Key] = field.Value
+		}
+	}
+	if slugRegex.ReplaceAllString(note.Title, "") == "" {
+		return nil, errors.New("invalid front matter: title must contain at least one letter or digit")
+	}
+	return note, nil
+}
+
 func FileNoteFromFile(path string, title string) (bNote *FileNote, err error) {
 	if _, err = os.Stat(path); err != nil {
 		return nil, err
@@ -190,9 +251,9 @@ func FileNoteFromFile(path string, title string) (bNote *FileNote, err error) {
 	}
 	return &FileNote{
 		Note: Note{
-			Uuid:  uuid.New(),
-			Title: title,
-			Time:  time.Now(),
+			Uuid:    uuid.New(),
+			Title:   title,
+			Created: time.Now(),
 		},
 		Content: content,
 	}, nil
@@ -203,16 +264,19 @@ func (note *Note) Encrypt(x25519recipients ...age.X25519Recipient) (ciphertext s
 	for r := range x25519recipients {
 		recipients = append(recipients, &x25519recipients[r])
 	}
+	if len(recipients) == 0 {
+		return "", nil, ErrNoRecipients
+	}
 	out := &bytes.Buffer{}
 	w, err := age.Encrypt(out, recipients...)
 	if err != nil {
-		log.Fatalf("Failed to create encrypted note with uuid %s.", note.Uuid.String())
+		return "", nil, fmt.Errorf("could not create encrypted note with uuid %s: %w", note.Uuid.String(), err)
 	}
 	if _, err := io.WriteString(w, note.Text); err != nil {
-		log.Fatalf("Failed to encrypt data for note %s: %v", note.Uuid.String(), err)
+		return "", nil, fmt.Errorf("could not encrypt data for note %s: %w", note.Uuid.String(), err)
 	}
 	if err := w.Close(); err != nil {
-		log.Fatalf("Error on closing encrypted note with uuid %s.", note.Uuid.String())
+		return "", nil, fmt.Errorf("could not close encrypted note with uuid %s: %w", note.Uuid.String(), err)
 	}
 	ciphertext = base64.StdEncoding.EncodeToString(out.Bytes())
 	for i := range note.Attachments {
@@ -253,17 +317,22 @@ func (attachment *Attachment) Encrypt(x25519Recipients ...age.X25519Recipient) (
 	for i := range x25519Recipients {
 		recipients = append(recipients, &x25519Recipients[i])
 	}
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
 
 	out := &bytes.Buffer{}
 	w, err := age.Encrypt(out, recipients...)
 	if err != nil {
 		return nil, err
 	}
-	defer w.Close()
-
 	if _, err = w.Write(attachment.Content); err != nil {
 		return nil, err
 	}
+	// The last chunk is only written when closing the writer, so this must happen before reading the buffer
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
 	encryptedAttachmentStruct.Ciphertext = base64.StdEncoding.EncodeToString(out.Bytes())
 	return &encryptedAttachmentStruct, nil
 }
@@ -272,11 +341,13 @@ func (note *Note) ToEncryptedNote(x25519recipients ...age.X25519Recipient) (encr
 	ciphertext, attachments, err := note.Encrypt(x25519recipients...)
 	return EncryptedNote{
 		Uuid:        note.Uuid,
-		Time:        note.Time,
+		Created:     note.Created,
+		Modified:    note.Modified,
 		Title:       note.Title,
 		Ciphertext:  ciphertext,
 		IsFile:      false,
-		Tags:        []string{},
+		Tags:        append([]string{}, note.Tags...),
+		Fields:      copyFields(note.Fields),
 		Attachments: attachments,
 	}, err
 }
@@ -285,53 +356,87 @@ func (note *Note) Json() (encodedNote []byte, err error) {
 	return json.Marshal(note)
 }
 
-// Writes note to a file in the format of Title\nText.
-func (note *Note) ToFile(path string) (err error) {
-	content := strings.Join([]string{note.Title, note.Text}, "\n")
-	content = "# " + content
-	return os.WriteFile(path, []byte(content), 0600)
-}
+// plaintextNotice is the first line of front matter blocks written by ToFile, as the values of the block are stored
+// unencrypted. Comments are ignored when parsing the block.
+const plaintextNotice = "# title, tags and fields are stored unencrypted, only the text below is encrypted"
 
-func (bNote *FileNote) Encrypt(x25519recipients ...age.X25519Recipient) (ciphertext string, err error) {
-	var recipients []age.Recipient
-	for r := range x25519recipients {
-		recipients = append(recipients, &x25519recipients[r])
+// Writes note to a file, starting with a front matter block containing title, tags, creation time and custom fields.
+func (note *Note) ToFile(path string) (err error) {
+	fm := frontmatter.FrontMatter{
+		{Key: keyTitle, Value: note.Title},
+		{Key: keyTags, IsList: true, List: note.Tags},
 	}
-	out := &bytes.Buffer{}
-	w, err := age.Encrypt(out, recipients...)
-	if err != nil {
-		log.Fatalf("Failed to create encrypted note with uuid %s.", bNote.Uuid.String())
+	if !note.Created.IsZero() {
+		fm = append(fm, frontmatter.Field{Key: keyCreated, Value: note.Created.Format(time.RFC3339)})
 	}
-	if _, err = w.Write(bNote.Content); err != nil {
-		log.Fatalf("Failed to encrypt data for note %s: %v", bNote.Uuid.String(), err)
+	if !note.Modified.IsZero() {
+		fm = append(fm, frontmatter.Field{Key: keyModified, Value: note.Modified.Format(time.RFC3339)})
 	}
-	if err := w.Close(); err != nil {
-		log.Fatalf("Error on closing encrypted note with uuid %s.", bNote.Uuid.String())
+	keys := make([]string, 0, len(note.Fields))
+	for key := range note.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fm = append(fm, frontmatter.Field{Key: key, Value: note.Fields[key]})
+	}
+	block := strings.Replace(fm.String(), frontmatter.Delimiter+"\n", frontmatter.Delimiter+"\n"+plaintextNotice+"\n", 1)
+	return os.WriteFile(path, []byte(block+note.Text), 0600)
+}
+
+func (bNote *FileNote) Encrypt(x25519recipients ...age.X25519Recipient) (ciphertext string, err error) {
+	if ciphertext, err = EncryptReader(bytes.NewReader(bNote.Content), x25519recipients...); err != nil && !errors.Is(err, ErrNoRecipients) {
+		return "", fmt.Errorf("could not encrypt data for note %s: %w", bNote.Uuid.String(), err)
 	}
-	return base64.StdEncoding.EncodeToString(out.Bytes()), nil
+	return ciphertext, err
 }
 
 func (bNote *FileNote) ToEncryptedNote(x25519recipients ...age.X25519Recipient) (encryptedNote EncryptedNote, err error) {
 	ciphertext, err := bNote.Encrypt(x25519recipients...)
 	return EncryptedNote{
 		Uuid:       bNote.Uuid,
-		Time:       bNote.Time,
+		Created:    bNote.Created,
+		Modified:   bNote.Modified,
 		Title:      bNote.Title,
 		Ciphertext: ciphertext,
 		IsFile:     true,
-		Tags:       []string{},
+		Tags:       append([]string{}, bNote.Tags...),
+		Fields:     copyFields(bNote.Fields),
 	}, err
 }
 
 type EncryptedNote struct {
 	Uuid        uuid.UUID
-	Time        time.Time
+	Created     time.Time `json:"Time"` // named Time in records written before Modified was added
+	Modified    time.Time // zero if the note was not changed since its creation
 	Title       string
 	Ciphertext  string
 	IsBinary    bool // deprecated
 	IsFile      bool
 	Tags        []string
 	Attachments []EncryptedAttachment
+	Revision    uint64            // incremented on every save, used for detecting conflicts when syncing
+	Fields      map[string]string `json:",omitempty"` // custom fields set in the front matter, not encrypted
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func copyFields(fields map[string]string) map[string]string {
+	if len(fields) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(fields))
+	for k, v := range fields {
+		copied[k] = v
+	}
+	return copied
 }
 
 type EncryptedAttachment struct {
@@ -344,12 +449,7 @@ type EncryptedAttachment struct {
 }
 
 func (encryptedNote *EncryptedNote) Slug() (slug string) {
-	regex, err := regexp.Compile("[^a-zA-Z0-9 ]+")
-	if err != nil {
-		log.Fatalf("Error compiling regular expression: %v", err)
-	}
-
-	slug = regex.ReplaceAllString(encryptedNote.Title, "")
+	slug = slugRegex.ReplaceAllString(encryptedNote.Title, "")
 	slug = strings.ReplaceAll(slug, " ", "-")
 	slug = strings.ToLower(slug)
 	return slug
@@ -362,25 +462,16 @@ func (encryptedNote *EncryptedNote) ContainsFile() bool {
 
 // Decrypt decrypts a notes text. For decrypting one of the possible attachments, DecryptAttachment must be called.
 func (encryptedNote EncryptedNote) Decrypt(identity age.Identity) (text string, err error) {
-	var decoded []byte
-	if decoded, err = base64.StdEncoding.DecodeString(encryptedNote.Ciphertext); err != nil {
-		log.Fatalf("Error decoding encrypted note's ciphertext: %v.", err)
-	}
-	r, err := age.Decrypt(bytes.NewReader(decoded), identity)
+	content, err := encryptedNote.DecryptContent(identity)
 	if err != nil {
 		return "", err
 	}
-	buffer := &bytes.Buffer{}
-	if n, err := buffer.ReadFrom(r); err != nil {
-		return "", fmt.Errorf("error while after %d bytes from decryption reader: %v", n, err)
-	}
-	text = buffer.String()
-	return text, nil
+	return string(content), nil
 }
 
 func (encryptedNote *EncryptedNote) DecryptAttachment(num int, identity age.Identity) (attachment Attachment, err error) {
-	if num > len(encryptedNote.Attachments) {
-		return Attachment{}, errors.New("attachment index out of range.")
+	if num < 0 || num >= len(encryptedNote.Attachments) {
+		return Attachment{}, fmt.Errorf("attachment %d: %w", num, ErrIndexOutOfRange)
 	}
 
 	encryptedAttachment := encryptedNote.Attachments[num]
@@ -394,7 +485,7 @@ func (encryptedNote *EncryptedNote) DecryptAttachment(num int, identity age.Iden
 
 	r, err := age.Decrypt(bytes.NewReader(decoded), identity)
 	if err != nil {
-		return Attachment{}, fmt.Errorf("error decrypting attachment: %v", err)
+		return Attachment{}, fmt.Errorf("%w: could not decrypt attachment: %v", ErrDecryptFailed, err)
 	}
 	buffer := &bytes.Buffer{}
 	if n, err := buffer.ReadFrom(r); err != nil {
@@ -411,18 +502,18 @@ func (encryptedNote *EncryptedNote) DecryptAttachment(num int, identity age.Iden
 }
 
 func (encryptedNote EncryptedNote) DecryptContent(identity age.Identity) (content []byte, err error) {
-	var decoded []byte
-	if decoded, err = base64.StdEncoding.DecodeString(encryptedNote.Ciphertext); err != nil {
-		log.Fatalf("Error decoding encrypted note's ciphertext: %v.", err)
+	decoded, err := base64.StdEncoding.DecodeString(encryptedNote.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not decode ciphertext of note %s: %v", ErrDecryptFailed, encryptedNote.Uuid.String(), err)
 	}
 	r, err := age.Decrypt(bytes.NewReader(decoded), identity)
 	if err != nil {
-		return []byte(""), err
+		return nil, fmt.Errorf("%w: %v", ErrDecryptFailed, err)
 	}
 	if content, err = io.ReadAll(r); err != nil {
-		log.Fatalf("Could not decrypt note with uuid %s.", encryptedNote.Uuid.String())
+		return nil, fmt.Errorf("%w: could not read note %s: %v", ErrDecryptFailed, encryptedNote.Uuid.String(), err)
 	}
-	return
+	return content, nil
 }
 
 func (encryptedNote EncryptedNote) ToDecryptedNote(identity age.Identity) (note Note, err error) {
@@ -432,11 +523,13 @@ func (encryptedNote EncryptedNote) ToDecryptedNote(identity age.Identity) (note
 
 	text, err := encryptedNote.Decrypt(identity)
 	return Note{
-		encryptedNote.Uuid,
-		encryptedNote.Time,
-		encryptedNote.Title,
-		text,
-		nil,
+		Uuid:     encryptedNote.Uuid,
+		Created:  encryptedNote.Created,
+		Modified: encryptedNote.Modified,
+		Title:    encryptedNote.Title,
+		Text:     text,
+		Tags:     append([]string{}, encryptedNote.Tags...),
+		Fields:   copyFields(encryptedNote.Fields),
 	}, err
 }
 
@@ -447,11 +540,12 @@ func (encryptedNote EncryptedNote) ToDecryptedFileNote(identity age.Identity) (b
 	content, err := encryptedNote.DecryptContent(identity)
 	return FileNote{
 		Note{
-			encryptedNote.Uuid,
-			encryptedNote.Time,
-			encryptedNote.Title,
-			"",
-			nil,
+			Uuid:     encryptedNote.Uuid,
+			Created:  encryptedNote.Created,
+			Modified: encryptedNote.Modified,
+			Title:    encryptedNote.Title,
+			Tags:     append([]string{}, encryptedNote.Tags...),
+			Fields:   copyFields(encryptedNote.Fields),
 		},
 		content,
 	}, err
@@ -474,6 +568,14 @@ func (encryptedNote *EncryptedNote) Flags() (flags string) {
 	return flags
 }
 
+// LastModified returns the time the note was modified last, which is the creation time for unchanged notes.
+func (encryptedNote *EncryptedNote) LastModified() time.Time {
+	if encryptedNote.Modified.IsZero() {
+		return encryptedNote.Created
+	}
+	return encryptedNote.Modified
+}
+
 func (encryptedNote *EncryptedNote) AddTag(t string) {
 	encryptedNote.Tags = append(encryptedNote.Tags, t)
 }
@@ -487,7 +589,7 @@ func (encryptedNote *EncryptedNote) RemoveTag(t string) error {
 			return nil
 		}
 	}
-	return errors.New("tag not found")
+	return ErrTagNotFound
 }
 
 // CheckSha256Hash loops over all attachment's hashes and compares them to the given hash `h`.
@@ -507,7 +609,7 @@ func (encryptedNote EncryptedNote) Json() (encodedNote []byte, err error) {
 
 func SortNoteSlice(notes []EncryptedNote) []EncryptedNote {
 	sort.Slice(notes, func(i, j int) bool {
-		return notes[i].Time.After(notes[j].Time)
+		return sortsBefore(notes[i].Created, notes[i].Uuid, notes[j].Created, notes[j].Uuid)
 	})
 	return notes
 }
@@ -8,6 +8,8 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"path"
 	"strings"
@@ -85,6 +87,36 @@ func TestNoteEncryptionAndDecryption(t *testing.T) {
 	}
 }
 
+func TestEncryptionErrors(t *testing.T) {
+	note := model.NewNote("Test", "Testing errors")
+	if _, err := note.ToEncryptedNote(); !errors.Is(err, model.ErrNoRecipients) {
+		t.Fatalf("Encrypting without recipients should fail: %v", err)
+	}
+
+	recipient, err := age.ParseX25519Recipient(pub)
+	if err != nil {
+		t.Fatalf("Could not parse public key: %v", err)
+	}
+	encryptedNote, err := note.ToEncryptedNote(*recipient)
+	if err != nil {
+		t.Fatalf("Could not encrypt note: %v", err)
+	}
+	identity, err := age.ParseX25519Identity(key2)
+	if err != nil {
+		t.Fatalf("Could not parse private key: %v", err)
+	}
+	if _, err = encryptedNote.Decrypt(identity); !errors.Is(err, model.ErrDecryptFailed) {
+		t.Fatalf("Decrypting with a wrong key should fail: %v", err)
+	}
+	encryptedNote.Ciphertext = "not base64"
+	if _, err = encryptedNote.Decrypt(identity); !errors.Is(err, model.ErrDecryptFailed) {
+		t.Fatalf("Decrypting an invalid ciphertext should fail: %v", err)
+	}
+	if _, err = encryptedNote.DecryptAttachment(0, identity); !errors.Is(err, model.ErrIndexOutOfRange) {
+		t.Fatalf("Decrypting a missing attachment should fail: %v", err)
+	}
+}
+
 func TestSlugCreation(t *testing.T) {
 	title := "!\"§$%&/()=?Hello World!"
 	expected := "hello-world"
@@ -103,7 +135,7 @@ func TestJsonMarshallNotes(t *testing.T) {
 	}
 	note := model.EncryptedNote{
 		Uuid:       id,
-		Time:       time.Now(),
+		Created:    time.Now(),
 		Title:      "This is my Title!",
 		Ciphertext: "Imagine some base64 encoded ciphertext here.",
 	}
@@ -311,3 +343,132 @@ func TestAttachmentEncryption(t *testing.T) {
 		}
 	}
 }
+
+func TestSingleAttachmentEncryption(t *testing.T) {
+	attachment := model.NewAttachment("attachment.txt", []byte("This is some data.\n"))
+	i1, err := age.ParseX25519Identity(key)
+	if err != nil {
+		t.Fatalf("Could not parse identity: %v", err)
+	}
+
+	encryptedAttachment, err := attachment.Encrypt(*i1.Recipient())
+	if err != nil {
+		t.Fatalf("Could not encrypt attachment: %v", err)
+	}
+	enc := model.EncryptedNote{
+		Attachments: []model.EncryptedAttachment{*encryptedAttachment},
+	}
+	decryptedAttachment, err := enc.DecryptAttachment(0, i1)
+	if err != nil {
+		t.Fatalf("Error during decrypting attachment: %v", err)
+	}
+	if string(decryptedAttachment.Content) != string(attachment.Content) {
+		t.Fatalf("Content should be %q but was %q", attachment.Content, decryptedAttachment.Content)
+	}
+}
+
+func TestStreamingEncryption(t *testing.T) {
+	i1, err := age.ParseX25519Identity(key)
+	if err != nil {
+		t.Fatalf("Could not parse identity: %v", err)
+	}
+	// Larger than a single chunk of age and the buffers of the base64 encoder
+	data := strings.Repeat("This is some data.\n", 10000)
+
+	encryptedAttachment, err := model.NewEncryptedAttachment("attachment.txt", strings.NewReader(data), *i1.Recipient())
+	if err != nil {
+		t.Fatalf("Could not encrypt attachment: %v", err)
+	}
+	attachment := model.NewAttachment("attachment.txt", []byte(data))
+	if encryptedAttachment.Sha256 != attachment.Sha256 || encryptedAttachment.Md5 != attachment.Md5 {
+		t.Fatalf("Hashes differ from NewAttachment: %s, %s", encryptedAttachment.Sha256, attachment.Sha256)
+	}
+	enc := model.EncryptedNote{Attachments: []model.EncryptedAttachment{*encryptedAttachment}}
+	decryptedAttachment, err := enc.DecryptAttachment(0, i1)
+	if err != nil || string(decryptedAttachment.Content) != data {
+		t.Fatalf("Could not decrypt attachment encrypted while reading: %v", err)
+	}
+
+	enc.Ciphertext, err = model.EncryptReader(strings.NewReader(data), *i1.Recipient())
+	if err != nil {
+		t.Fatalf("Could not encrypt content: %v", err)
+	}
+	r, err := enc.ContentReader(i1)
+	if err != nil {
+		t.Fatalf("Could not decrypt content: %v", err)
+	}
+	content := &strings.Builder{}
+	if _, err = io.Copy(content, r); err != nil || content.String() != data {
+		t.Fatalf("Content differs after decrypting while reading: %v", err)
+	}
+	if _, err = enc.AttachmentReader(1, i1); !errors.Is(err, model.ErrIndexOutOfRange) {
+		t.Fatalf("Attachment 1 should be out of range: %v", err)
+	}
+}
+
+// zeros is an endless reader of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestEncryptReaderLimit(t *testing.T) {
+	i1, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	if _, err = model.EncryptReader(io.LimitReader(zeros{}, model.MaxContentSize), *i1.Recipient()); err != nil {
+		t.Fatalf("Content of the maximum size should be encrypted: %v", err)
+	}
+	if _, err = model.EncryptReader(zeros{}, *i1.Recipient()); !errors.Is(err, model.ErrTooLarge) {
+		t.Fatalf("Content exceeding the maximum size should be rejected: %v", err)
+	}
+}
+
+func TestNoteFileFrontMatter(t *testing.T) {
+	note := model.NewNote("Title: with colon", "Text\n---\nmore")
+	note.Tags = []string{"one", "two"}
+	note.Fields = map[string]string{"project": "aen"}
+	notePath := path.Join(t.TempDir(), "note.md")
+	if err := note.ToFile(notePath); err != nil {
+		t.Fatalf("Could not write note to file: %v", err)
+	}
+	if content, err := os.ReadFile(notePath); err != nil || !strings.Contains(string(content), "stored unencrypted") {
+		t.Fatalf("Front matter should state that its values are not encrypted: %q, %v", content, err)
+	}
+	parsed, err := model.NotefileToNote(notePath)
+	if err != nil {
+		t.Fatalf("Could not parse note file: %v", err)
+	}
+	if parsed.Title != note.Title || parsed.Text != note.Text || strings.Join(parsed.Tags, ",") != "one,two" || parsed.Fields["project"] != "aen" {
+		t.Fatalf("Parsed note differs: %+v", parsed)
+	}
+	if !parsed.Created.Equal(note.Created.Truncate(time.Second)) {
+		t.Fatalf("Creation time should be kept in seconds: %v, %v", parsed.Created, note.Created)
+	}
+
+	invalid := map[string]string{
+		"---\ntitle: Test\ncreated: yesterday\n---\n": "created",
+		"---\ntitle: \"\"\n---\ntext":                 "title",
+		"---\ntitle: Test\nproject: [a, b]\n---\n":    "project",
+	}
+	for content, field := range invalid {
+		if err = os.WriteFile(notePath, []byte(content), 0600); err != nil {
+			t.Fatalf("Could not write note file: %v", err)
+		}
+		if _, err = model.NotefileToNote(notePath); err == nil || !strings.Contains(err.Error(), field) {
+			t.Fatalf("Invalid %s should be reported: %v", field, err)
+		}
+	}
+
+	if err = os.WriteFile(notePath, []byte("# Legacy title\nText"), 0600); err != nil {
+		t.Fatalf("Could not write note file: %v", err)
+	}
+	if parsed, err = model.NotefileToNote(notePath); err != nil || parsed.Title != "Legacy title" || parsed.Tags != nil {
+		t.Fatalf("Files without front matter should use the first line as title: %+v, %v", parsed, err)
+	}
+}
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/google/uuid"
+)
+
+// PageOptions describes the part of a note list which should be returned by Paginate.
+type PageOptions struct {
+	Limit  int    // maximum number of notes on a page, 0 means no limit
+	Offset int    // number of notes to skip, must be 0 if a cursor is given
+	Cursor string // token of a previous page (Page.Next) to continue after
+	Sort   string // SortCreated (default) or SortModified
+}
+
+const (
+	SortCreated  = "created"
+	SortModified = "modified"
+)
+
+// Page is a slice of a sorted note list together with the information required for displaying it.
+type Page struct {
+	Notes  []EncryptedNote
+	Offset int    // position of the first note of the page in the complete list
+	Total  int    // number of notes in the complete list
+	Limit  int    // limit the page was created with
+	Next   string // cursor token for the following page, empty if this is the last page
+}
+
+// Number returns the current page number starting at 1 and the number of pages available.
+func (p *Page) Number() (current int, pages int) {
+	if p.Limit <= 0 {
+		return 1, 1
+	}
+	current = p.Offset/p.Limit + 1
+	pages = (p.Total + p.Limit - 1) / p.Limit
+	if pages < current {
+		pages = current
+	}
+	return current, pages
+}
+
+// Cursor marks a position in a note list sorted by SortNotes. As it references the time and UUID of the last
+// note shown instead of a numeric offset, notes added in the meantime do not shift the following pages.
+type Cursor struct {
+	Time time.Time
+	Uuid uuid.UUID
+}
+
+// CursorFromNote returns a cursor pointing behind the given note in a list sorted by the given field.
+func CursorFromNote(note *EncryptedNote, by string) Cursor {
+	return Cursor{
+		Time: sortTime(note, by),
+		Uuid: note.Uuid,
+	}
+}
+
+// String encodes the cursor as URL safe token.
+func (c Cursor) String() string {
+	raw := fmt.Sprintf("%d:%s", c.Time.UnixNano(), c.Uuid.String())
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a token created by Cursor.String.
+func ParseCursor(token string) (cursor Cursor, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor token: %v", err)
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return Cursor{}, errors.New("invalid cursor token")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor token: %v", err)
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor token: %v", err)
+	}
+	return Cursor{
+		Time: time.Unix(0, nanos),
+		Uuid: id,
+	}, nil
+}
+
+// sortsBefore defines the order used for listing notes: newest first and the UUID as tie breaker,
+// so the order is stable for notes sharing the same timestamp.
+func sortsBefore(t1 time.Time, id1 uuid.UUID, t2 time.Time, id2 uuid.UUID) bool {
+	if !t1.Equal(t2) {
+		return t1.After(t2)
+	}
+	return bytes.Compare(id1[:], id2[:]) < 0
+}
+
+// sortTime returns the time of the note the list is sorted by.
+func sortTime(note *EncryptedNote, by string) time.Time {
+	if by == SortModified {
+		return note.LastModified()
+	}
+	return note.Created
+}
+
+// SortNotes sorts the notes by the given field, newest first. An empty field sorts by creation time.
+func SortNotes(notes []EncryptedNote, by string) error {
+	switch by {
+	case "", SortCreated, SortModified:
+	default:
+		return fmt.Errorf("notes can only be sorted by %s or %s", SortCreated, SortModified)
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		return sortsBefore(sortTime(&notes[i], by), notes[i].Uuid, sortTime(&notes[j], by), notes[j].Uuid)
+	})
+	return nil
+}
+
+// Paginate sorts the given notes and returns the page described by the options.
+func Paginate(notes []EncryptedNote, opts PageOptions) (page Page, err error) {
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return Page{}, errors.New("limit and offset must not be negative")
+	}
+	if len(opts.Cursor) > 0 && opts.Offset > 0 {
+		return Page{}, errors.New("offset and cursor cannot be combined")
+	}
+	if err = SortNotes(notes, opts.Sort); err != nil {
+		return Page{}, err
+	}
+
+	start := opts.Offset
+	if len(opts.Cursor) > 0 {
+		cursor, err := ParseCursor(opts.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		start = sort.Search(len(notes), func(i int) bool {
+			return sortsBefore(cursor.Time, cursor.Uuid, sortTime(&notes[i], opts.Sort), notes[i].Uuid)
+		})
+	}
+	if start > len(notes) {
+		start = len(notes)
+	}
+
+	end := len(notes)
+	if opts.Limit > 0 && start+opts.Limit < end {
+		end = start + opts.Limit
+	}
+
+	page = Page{
+		Notes:  notes[start:end],
+		Offset: start,
+		Total:  len(notes),
+		Limit:  opts.Limit,
+	}
+	if end < len(notes) && end > start {
+		page.Next = CursorFromNote(&notes[end-1], opts.Sort).String()
+	}
+	return page, nil
+}
@@ -0,0 +1,106 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/3c7/aen/internal/model"
+	"github.com/google/uuid"
+)
+
+func provideNotes(count int, start time.Time) (notes []model.EncryptedNote) {
+	for i := 0; i < count; i++ {
+		notes = append(notes, model.EncryptedNote{
+			Uuid:    uuid.New(),
+			Created: start.Add(time.Duration(i) * time.Minute),
+			Title:   "Note",
+		})
+	}
+	return notes
+}
+
+func TestPaginateOffset(t *testing.T) {
+	notes := provideNotes(25, time.Now())
+	page, err := model.Paginate(notes, model.PageOptions{Limit: 10, Offset: 20})
+	if err != nil {
+		t.Fatalf("Error paginating notes: %v", err)
+	}
+	if len(page.Notes) != 5 {
+		t.Fatalf("Page should contain 5 notes but contained %d", len(page.Notes))
+	}
+	if page.Next != "" {
+		t.Fatalf("Last page should not have a next cursor but had %s", page.Next)
+	}
+	current, pages := page.Number()
+	if current != 3 || pages != 3 {
+		t.Fatalf("Page should be 3 of 3 but was %d of %d", current, pages)
+	}
+}
+
+func TestPaginateCursorIsStable(t *testing.T) {
+	now := time.Now()
+	notes := provideNotes(25, now)
+	first, err := model.Paginate(notes, model.PageOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Error paginating notes: %v", err)
+	}
+	lastShown := first.Notes[9].Uuid
+
+	// Newer notes are sorted to the front and would shift an offset based second page
+	notes = append(notes, provideNotes(3, now.Add(time.Hour))...)
+	second, err := model.Paginate(notes, model.PageOptions{Limit: 10, Cursor: first.Next})
+	if err != nil {
+		t.Fatalf("Error paginating notes: %v", err)
+	}
+	for i := range notes {
+		if notes[i].Uuid == lastShown {
+			if second.Offset != i+1 {
+				t.Fatalf("Second page should start at %d but started at %d", i+1, second.Offset)
+			}
+		}
+	}
+	if second.Notes[0].Created.After(first.Notes[9].Created) {
+		t.Fatal("Second page starts with a note newer than the last note of the first page")
+	}
+	if second.Total != 28 {
+		t.Fatalf("Total should be 28 but was %d", second.Total)
+	}
+}
+
+func TestPaginateInvalidCursor(t *testing.T) {
+	notes := provideNotes(3, time.Now())
+	if _, err := model.Paginate(notes, model.PageOptions{Cursor: "not a cursor"}); err == nil {
+		t.Fatal("Paginate should return an error for an invalid cursor")
+	}
+	first, err := model.Paginate(notes, model.PageOptions{Limit: 1})
+	if err != nil {
+		t.Fatalf("Error paginating notes: %v", err)
+	}
+	if _, err = model.Paginate(notes, model.PageOptions{Offset: 1, Cursor: first.Next}); err == nil {
+		t.Fatal("Paginate should return an error if offset and cursor are given")
+	}
+}
+
+func TestPaginateSortModified(t *testing.T) {
+	now := time.Now()
+	notes := provideNotes(5, now)
+	// The oldest note was modified last
+	notes[0].Modified = now.Add(time.Hour)
+	page, err := model.Paginate(notes, model.PageOptions{Limit: 2, Sort: model.SortModified})
+	if err != nil {
+		t.Fatalf("Error paginating notes: %v", err)
+	}
+	if page.Notes[0].Modified.IsZero() {
+		t.Fatalf("Modified note should be listed first but was %s", page.Notes[0].Created)
+	}
+	second, err := model.Paginate(notes, model.PageOptions{Limit: 2, Sort: model.SortModified, Cursor: page.Next})
+	if err != nil {
+		t.Fatalf("Error paginating notes: %v", err)
+	}
+	if second.Offset != 2 || !second.Notes[0].Created.Equal(now.Add(3*time.Minute)) {
+		t.Fatalf("Second page should continue with the third newest note, offset was %d", second.Offset)
+	}
+	if _, err = model.Paginate(notes, model.PageOptions{Sort: "title"}); err == nil {
+		t.Fatal("Paginate should return an error for an unknown sort field")
+	}
+}
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// MaxContentSize is the maximum size in bytes of the plaintext encrypted by EncryptReader. Notes are stored as single
+// database records, so the ciphertext of a note and its attachments is held in memory while it is stored.
+const MaxContentSize = 64 << 20
+
+// EncryptReader encrypts everything read from r and returns the base64 encoded ciphertext as stored in the
+// database. The plaintext is not buffered, but the returned ciphertext is held in memory, so reading more than
+// MaxContentSize bytes fails with ErrTooLarge.
+func EncryptReader(r io.Reader, x25519recipients ...age.X25519Recipient) (ciphertext string, err error) {
+	var recipients []age.Recipient
+	for i := range x25519recipients {
+		recipients = append(recipients, &x25519recipients[i])
+	}
+	if len(recipients) == 0 {
+		return "", ErrNoRecipients
+	}
+	out := &strings.Builder{}
+	encoder := base64.NewEncoder(base64.StdEncoding, out)
+	w, err := age.Encrypt(encoder, recipients...)
+	if err != nil {
+		return "", err
+	}
+	limited := &io.LimitedReader{R: r, N: MaxContentSize + 1}
+	if _, err = io.Copy(w, limited); err != nil {
+		return "", err
+	}
+	if limited.N == 0 {
+		return "", fmt.Errorf("%w: at most %d MiB can be stored", ErrTooLarge, MaxContentSize>>20)
+	}
+	// Both writers keep the last chunk until they are closed, the age writer must be closed first
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	if err = encoder.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// NewEncryptedAttachment encrypts the attachment read from r. The hashes are calculated while reading.
+func NewEncryptedAttachment(filename string, r io.Reader, x25519recipients ...age.X25519Recipient) (encryptedAttachment *EncryptedAttachment, err error) {
+	md5Hash, sha1Hash, sha256Hash, sha512Hash := md5.New(), sha1.New(), sha256.New(), sha512.New()
+	hashes := io.MultiWriter(md5Hash, sha1Hash, sha256Hash, sha512Hash)
+	ciphertext, err := EncryptReader(io.TeeReader(r, hashes), x25519recipients...)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedAttachment{
+		Filename:   filename,
+		Md5:        hex.EncodeToString(md5Hash.Sum(nil)),
+		Sha1:       hex.EncodeToString(sha1Hash.Sum(nil)),
+		Sha256:     hex.EncodeToString(sha256Hash.Sum(nil)),
+		Sha512:     hex.EncodeToString(sha512Hash.Sum(nil)),
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// decryptReader returns a reader decrypting the base64 encoded ciphertext while reading.
+func decryptReader(ciphertext string, identity age.Identity) (r io.Reader, err error) {
+	decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(ciphertext))
+	if r, err = age.Decrypt(decoder, identity); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptFailed, err)
+	}
+	return r, nil
+}
+
+// ContentReader returns a reader decrypting the content of the note while reading, e.g. for writing large
+// file notes to a file without holding the plaintext in memory.
+func (encryptedNote *EncryptedNote) ContentReader(identity age.Identity) (r io.Reader, err error) {
+	return decryptReader(encryptedNote.Ciphertext, identity)
+}
+
+// AttachmentReader returns a reader decrypting the attachment with the given index while reading.
+func (encryptedNote *EncryptedNote) AttachmentReader(num int, identity age.Identity) (r io.Reader, err error) {
+	if num < 0 || num >= len(encryptedNote.Attachments) {
+		return nil, fmt.Errorf("attachment %d: %w", num, ErrIndexOutOfRange)
+	}
+	return decryptReader(encryptedNote.Attachments[num].Ciphertext, identity)
+}
@@ -0,0 +1,66 @@
+// Package placeholder expands the placeholders of note templates, e.g. "{{date}}" or "{{prompt:Case ID}}".
+package placeholder
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	uuid "github.com/google/uuid"
+)
+
+const promptPrefix = "prompt:"
+
+var placeholderRegex = regexp.MustCompile(`{{\s*([^{}]+?)\s*}}`)
+
+// Vars are the values placeholders are expanded with.
+type Vars struct {
+	Now    time.Time
+	Uuid   uuid.UUID
+	Prompt func(label string) (string, error) // asks for the value of {{prompt:<label>}}
+}
+
+// Expand replaces the placeholders {{date}} (e.g. 2022-02-14), {{time}} (e.g. 14:03), {{datetime}} (RFC 3339),
+// {{uuid}} (vars.Uuid) and {{prompt:<label>}} in text. The value of a prompt is asked for through vars.Prompt once
+// per label. Unknown placeholders are kept, so text containing braces for other reasons is not changed.
+func Expand(text string, vars Vars) (expanded string, err error) {
+	answers := map[string]string{}
+	expanded = placeholderRegex.ReplaceAllStringFunc(text, func(match string) string {
+		if err != nil {
+			return match
+		}
+		name := placeholderRegex.FindStringSubmatch(match)[1]
+		switch {
+		case name == "date":
+			return vars.Now.Format("2006-01-02")
+		case name == "time":
+			return vars.Now.Format("15:04")
+		case name == "datetime":
+			return vars.Now.Format(time.RFC3339)
+		case name == "uuid":
+			return vars.Uuid.String()
+		case strings.HasPrefix(name, promptPrefix):
+			label := strings.TrimSpace(strings.TrimPrefix(name, promptPrefix))
+			if answer, given := answers[label]; given {
+				return answer
+			}
+			if vars.Prompt == nil {
+				err = fmt.Errorf("no value given for %s", label)
+				return match
+			}
+			var answer string
+			if answer, err = vars.Prompt(label); err != nil {
+				err = fmt.Errorf("no value given for %s: %w", label, err)
+				return match
+			}
+			answers[label] = answer
+			return answer
+		}
+		return match
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
@@ -0,0 +1,43 @@
+package placeholder_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/3c7/aen/internal/placeholder"
+	uuid "github.com/google/uuid"
+)
+
+func TestExpand(t *testing.T) {
+	id := uuid.New()
+	prompts := 0
+	vars := placeholder.Vars{
+		Now:  time.Date(2022, 2, 14, 14, 3, 53, 0, time.UTC),
+		Uuid: id,
+		Prompt: func(label string) (string, error) {
+			prompts++
+			return "value of " + label, nil
+		},
+	}
+	text := "# Incident {{date}} {{ time }}\nID: {{uuid}}\nCase: {{prompt:Case ID}}, again {{prompt: Case ID}}\n{{unknown}} {{datetime}}"
+	expanded, err := placeholder.Expand(text, vars)
+	if err != nil {
+		t.Fatalf("Could not expand placeholders: %v", err)
+	}
+	expected := "# Incident 2022-02-14 14:03\nID: " + id.String() + "\nCase: value of Case ID, again value of Case ID\n{{unknown}} 2022-02-14T14:03:53Z"
+	if expanded != expected {
+		t.Fatalf("Expanded text should be %q but was %q", expected, expanded)
+	}
+	if prompts != 1 {
+		t.Fatalf("Every label should be asked for once but was asked for %d times", prompts)
+	}
+}
+
+func TestExpandPromptFails(t *testing.T) {
+	vars := placeholder.Vars{Prompt: func(label string) (string, error) { return "", io.EOF }}
+	if _, err := placeholder.Expand("{{prompt:Case ID}}", vars); !errors.Is(err, io.EOF) {
+		t.Fatalf("Expand should fail if no value is given: %v", err)
+	}
+}
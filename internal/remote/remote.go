@@ -0,0 +1,412 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+	uuid "github.com/google/uuid"
+)
+
+const (
+	NotesDir       = "notes"           // directory inside the remote containing one file per note
+	RecipientsName = "recipients.json" // file inside the remote containing the recipients
+
+	remotesKey  = "remotes"       // config key of the configured remotes
+	statePrefix = "remote-state-" // config key of the revisions synced with a remote, suffixed by its name
+)
+
+// Remote is a directory, e.g. a git working tree, which notes are pushed to and pulled from.
+type Remote struct {
+	Name string
+	Dir  string
+}
+
+// Result summarizes a push or pull. Notes are referenced by their slug.
+type Result struct {
+	Added     []string
+	Updated   []string
+	Deleted   []string
+	Conflicts []string // notes changed on both sides since the last sync, which were left untouched
+}
+
+// state maps the UUIDs of notes to the revision which was last synced with a remote.
+type state map[uuid.UUID]uint64
+
+// List returns the configured remotes sorted by name.
+func List(db database.Store) (remotes []Remote, err error) {
+	buf, err := db.GetConfig(remotesKey)
+	if err != nil || buf == nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(buf, &remotes); err != nil {
+		return nil, fmt.Errorf("could not parse remotes: %v", err)
+	}
+	return remotes, nil
+}
+
+// Get returns the remote with the given name. If the name is empty and exactly one remote is configured,
+// that remote is returned.
+func Get(db database.Store, name string) (remote Remote, err error) {
+	remotes, err := List(db)
+	if err != nil {
+		return Remote{}, err
+	}
+	if name == "" {
+		if len(remotes) != 1 {
+			return Remote{}, errors.New("remote name must be given")
+		}
+		return remotes[0], nil
+	}
+	for _, r := range remotes {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+	return Remote{}, fmt.Errorf("remote %s not found", name)
+}
+
+func writeRemotes(db database.Store, remotes []Remote) (err error) {
+	sort.Slice(remotes, func(i, j int) bool { return remotes[i].Name < remotes[j].Name })
+	buf, err := json.Marshal(remotes)
+	if err != nil {
+		return err
+	}
+	return db.SetConfig(remotesKey, buf)
+}
+
+// Add configures a new remote. The directory is stored as absolute path and created if necessary.
+func Add(db database.Store, name, dir string) (err error) {
+	if name == "" || dir == "" {
+		return errors.New("name and directory must be given")
+	}
+	remotes, err := List(db)
+	if err != nil {
+		return err
+	}
+	for _, r := range remotes {
+		if r.Name == name {
+			return fmt.Errorf("remote %s already exists", name)
+		}
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Join(dir, NotesDir), 0700); err != nil {
+		return err
+	}
+	return writeRemotes(db, append(remotes, Remote{Name: name, Dir: dir}))
+}
+
+// Remove removes a remote and its sync state. The directory is left untouched.
+func Remove(db database.Store, name string) (err error) {
+	remotes, err := List(db)
+	if err != nil {
+		return err
+	}
+	for idx, r := range remotes {
+		if r.Name == name {
+			if err = db.SetConfig(statePrefix+name, []byte("{}")); err != nil {
+				return err
+			}
+			return writeRemotes(db, append(remotes[:idx], remotes[idx+1:]...))
+		}
+	}
+	return fmt.Errorf("remote %s not found", name)
+}
+
+func readState(db database.Store, name string) (s state, err error) {
+	s = state{}
+	buf, err := db.GetConfig(statePrefix + name)
+	if err != nil || buf == nil {
+		return s, err
+	}
+	return s, json.Unmarshal(buf, &s)
+}
+
+func writeState(db database.Store, name string, s state) (err error) {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return db.SetConfig(statePrefix+name, buf)
+}
+
+// noteFilename returns the path of the file a note is stored in.
+func (r Remote) noteFilename(id uuid.UUID) string {
+	return filepath.Join(r.Dir, NotesDir, id.String()+".json")
+}
+
+// readNotes reads all notes of the remote.
+func (r Remote) readNotes() (notes map[uuid.UUID]model.EncryptedNote, err error) {
+	notes = map[uuid.UUID]model.EncryptedNote{}
+	entries, err := os.ReadDir(filepath.Join(r.Dir, NotesDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return notes, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		buf, err := os.ReadFile(filepath.Join(r.Dir, NotesDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var note model.EncryptedNote
+		if err = json.Unmarshal(buf, &note); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %v", entry.Name(), err)
+		}
+		if entry.Name() != note.Uuid.String()+".json" {
+			return nil, fmt.Errorf("%s contains note %s", entry.Name(), note.Uuid)
+		}
+		notes[note.Uuid] = note
+	}
+	return notes, nil
+}
+
+// readRecipients reads the recipients of the remote.
+func (r Remote) readRecipients() (recipients []model.Recipient, err error) {
+	buf, err := os.ReadFile(filepath.Join(r.Dir, RecipientsName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(buf, &recipients); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %v", RecipientsName, err)
+	}
+	return recipients, nil
+}
+
+// writeFile writes the value as indented JSON, so changes of single fields result in small diffs.
+// The file is replaced atomically.
+func writeFile(path string, v interface{}) (err error) {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".aen*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// equal compares the content of two notes.
+func equal(a, b model.EncryptedNote) bool {
+	bufA, errA := json.Marshal(a)
+	bufB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(bufA, bufB)
+}
+
+// changed reports whether a note was added, modified or deleted compared to the synced revision.
+func changed(id uuid.UUID, note model.EncryptedNote, available bool, s state) bool {
+	revision, synced := s[id]
+	return available != synced || (available && note.Revision != revision)
+}
+
+// sortedIds returns the union of all UUIDs in a stable order.
+func sortedIds(maps ...map[uuid.UUID]model.EncryptedNote) (ids []uuid.UUID) {
+	seen := map[uuid.UUID]bool{}
+	for _, m := range maps {
+		for id := range m {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	return ids
+}
+
+func localNotes(db database.Store) (notes map[uuid.UUID]model.EncryptedNote, err error) {
+	all, err := db.GetAllEncryptedNotes()
+	if err != nil {
+		return nil, err
+	}
+	notes = map[uuid.UUID]model.EncryptedNote{}
+	for _, note := range all {
+		notes[note.Uuid] = note
+	}
+	return notes, nil
+}
+
+// Push writes all notes changed locally since the last sync to the remote and removes the files of deleted notes.
+// Notes which were changed in the remote as well are reported as conflicts and skipped, unless force is set.
+func Push(db database.Store, r Remote, force bool) (result Result, err error) {
+	if err = os.MkdirAll(filepath.Join(r.Dir, NotesDir), 0700); err != nil {
+		return Result{}, err
+	}
+	s, err := readState(db, r.Name)
+	if err != nil {
+		return Result{}, err
+	}
+	ours, err := localNotes(db)
+	if err != nil {
+		return Result{}, err
+	}
+	theirs, err := r.readNotes()
+	if err != nil {
+		return Result{}, err
+	}
+
+	for _, id := range sortedIds(ours, theirs, idsOf(s)) {
+		ourNote, ourOk := ours[id]
+		theirNote, theirOk := theirs[id]
+		if !changed(id, ourNote, ourOk, s) {
+			continue
+		}
+		if !ourOk && !theirOk {
+			delete(s, id)
+			continue
+		}
+		if ourOk && theirOk && equal(ourNote, theirNote) {
+			s[id] = ourNote.Revision
+			continue
+		}
+		slug := ourNote.Slug()
+		if !ourOk {
+			slug = theirNote.Slug()
+		}
+		if changed(id, theirNote, theirOk, s) && !force {
+			result.Conflicts = append(result.Conflicts, slug)
+			continue
+		}
+
+		switch {
+		case !ourOk:
+			if err = os.Remove(r.noteFilename(id)); err != nil {
+				return result, err
+			}
+			result.Deleted = append(result.Deleted, slug)
+			delete(s, id)
+			continue
+		case theirOk:
+			result.Updated = append(result.Updated, slug)
+		default:
+			result.Added = append(result.Added, slug)
+		}
+		if err = writeFile(r.noteFilename(id), ourNote); err != nil {
+			return result, err
+		}
+		s[id] = ourNote.Revision
+	}
+
+	if err = pushRecipients(db, r); err != nil {
+		return result, err
+	}
+	return result, writeState(db, r.Name, s)
+}
+
+// pushRecipients writes the local recipients, including those only available in the remote, sorted by alias.
+func pushRecipients(db database.Store, r Remote) (err error) {
+	recipients, err := db.GetRecipients()
+	if err != nil {
+		return err
+	}
+	theirs, err := r.readRecipients()
+	if err != nil {
+		return err
+	}
+	keys := map[string]bool{}
+	for _, recipient := range recipients {
+		keys[recipient.Publickey] = true
+	}
+	for _, recipient := range theirs {
+		if !keys[recipient.Publickey] {
+			recipients = append(recipients, recipient)
+			keys[recipient.Publickey] = true
+		}
+	}
+	sort.Slice(recipients, func(i, j int) bool { return recipients[i].Alias < recipients[j].Alias })
+	return writeFile(filepath.Join(r.Dir, RecipientsName), recipients)
+}
+
+// Pull applies all notes changed in the remote since the last sync and removes notes deleted in the remote.
+// Notes which were changed locally as well are reported as conflicts and skipped, unless force is set.
+func Pull(db database.Store, r Remote, force bool) (result Result, err error) {
+	s, err := readState(db, r.Name)
+	if err != nil {
+		return Result{}, err
+	}
+	ours, err := localNotes(db)
+	if err != nil {
+		return Result{}, err
+	}
+	theirs, err := r.readNotes()
+	if err != nil {
+		return Result{}, err
+	}
+	recipients, err := r.readRecipients()
+	if err != nil {
+		return Result{}, err
+	}
+
+	var notes []model.EncryptedNote
+	var deleted []uuid.UUID
+	for _, id := range sortedIds(ours, theirs, idsOf(s)) {
+		ourNote, ourOk := ours[id]
+		theirNote, theirOk := theirs[id]
+		if !changed(id, theirNote, theirOk, s) {
+			continue
+		}
+		if !ourOk && !theirOk {
+			delete(s, id)
+			continue
+		}
+		if ourOk && theirOk && equal(ourNote, theirNote) {
+			s[id] = theirNote.Revision
+			continue
+		}
+		if changed(id, ourNote, ourOk, s) && !force {
+			slug := ourNote.Slug()
+			if !ourOk {
+				slug = theirNote.Slug()
+			}
+			result.Conflicts = append(result.Conflicts, slug)
+			continue
+		}
+		if theirOk {
+			notes = append(notes, theirNote)
+			s[id] = theirNote.Revision
+		} else {
+			deleted = append(deleted, id)
+			delete(s, id)
+		}
+	}
+
+	applied, err := db.ApplyChanges(notes, deleted, recipients)
+	if err != nil {
+		return result, err
+	}
+	result.Added, result.Updated, result.Deleted = applied.Added, applied.Updated, applied.Deleted
+	return result, writeState(db, r.Name, s)
+}
+
+// idsOf returns a map containing the UUIDs of the state, so they are considered by sortedIds.
+func idsOf(s state) map[uuid.UUID]model.EncryptedNote {
+	ids := map[uuid.UUID]model.EncryptedNote{}
+	for id := range s {
+		ids[id] = model.EncryptedNote{Uuid: id}
+	}
+	return ids
+}
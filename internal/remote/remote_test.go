@@ -0,0 +1,97 @@
+package remote_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+	"github.com/3c7/aen/internal/remote"
+	uuid "github.com/google/uuid"
+)
+
+func TestPushPull(t *testing.T) {
+	dir := t.TempDir()
+	alice := database.NewDatabaseInstance(filepath.Join(t.TempDir(), "alice.db"))
+	if err := alice.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer alice.Close()
+	bob := database.NewDatabaseInstance(filepath.Join(t.TempDir(), "bob.db"))
+	if err := bob.Open(); err != nil {
+		t.Fatalf("Could not open database: %v", err)
+	}
+	defer bob.Close()
+	for _, db := range []*database.Database{alice, bob} {
+		if err := remote.Add(db, "origin", dir); err != nil {
+			t.Fatalf("Could not add remote: %v", err)
+		}
+	}
+	r, err := remote.Get(alice, "")
+	if err != nil {
+		t.Fatalf("Could not get remote: %v", err)
+	}
+
+	note := model.EncryptedNote{Uuid: uuid.New(), Title: "Shared", Ciphertext: "ciphertext"}
+	if err = alice.SaveEncryptedNote(&note); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+	result, err := remote.Push(alice, r, false)
+	if err != nil {
+		t.Fatalf("Could not push: %v", err)
+	}
+	if len(result.Added) != 1 {
+		t.Fatalf("Unexpected push result: %+v", result)
+	}
+	if _, err = os.Stat(filepath.Join(dir, remote.NotesDir, note.Uuid.String()+".json")); err != nil {
+		t.Fatalf("Note file should have been written: %v", err)
+	}
+
+	result, err = remote.Pull(bob, r, false)
+	if err != nil {
+		t.Fatalf("Could not pull: %v", err)
+	}
+	if len(result.Added) != 1 {
+		t.Fatalf("Unexpected pull result: %+v", result)
+	}
+
+	// Change the note on both sides
+	aliceNote, _ := alice.GetEncryptedNoteBySlug("shared")
+	aliceNote.Tags = []string{"alice"}
+	if err = alice.SaveEncryptedNote(aliceNote); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+	bobNote, _ := bob.GetEncryptedNoteBySlug("shared")
+	bobNote.Tags = []string{"bob"}
+	if err = bob.SaveEncryptedNote(bobNote); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+	if result, err = remote.Push(alice, r, false); err != nil || len(result.Updated) != 1 {
+		t.Fatalf("Could not push change: %+v, %v", result, err)
+	}
+	if result, err = remote.Push(bob, r, false); err != nil || len(result.Conflicts) != 1 {
+		t.Fatalf("Push of bob should conflict: %+v, %v", result, err)
+	}
+	if result, err = remote.Pull(bob, r, false); err != nil || len(result.Conflicts) != 1 {
+		t.Fatalf("Pull of bob should conflict: %+v, %v", result, err)
+	}
+	if result, err = remote.Pull(bob, r, true); err != nil || len(result.Updated) != 1 {
+		t.Fatalf("Forced pull should take the remote note: %+v, %v", result, err)
+	}
+	bobNote, _ = bob.GetEncryptedNoteBySlug("shared")
+	if len(bobNote.Tags) != 1 || bobNote.Tags[0] != "alice" {
+		t.Fatalf("Unexpected tags after pull: %v", bobNote.Tags)
+	}
+
+	// Deletions are propagated
+	if err = alice.DeleteNoteBySlug("shared"); err != nil {
+		t.Fatalf("Could not delete note: %v", err)
+	}
+	if result, err = remote.Push(alice, r, false); err != nil || len(result.Deleted) != 1 {
+		t.Fatalf("Deletion should be pushed: %+v, %v", result, err)
+	}
+	if result, err = remote.Pull(bob, r, false); err != nil || len(result.Deleted) != 1 {
+		t.Fatalf("Deletion should be pulled: %+v, %v", result, err)
+	}
+}
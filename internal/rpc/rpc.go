@@ -0,0 +1,515 @@
+// Package rpc implements a JSON-RPC 2.0 server for editor integrations. Every message is a single line of JSON,
+// requests are read from one stream and responses and notifications are written to another, e.g. stdin and
+// stdout of "aen serve --stdio".
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/3c7/aen"
+	uuid "github.com/google/uuid"
+)
+
+// Version is the JSON-RPC version spoken by the server.
+const Version = "2.0"
+
+// NotifyNoteChanged is the method of notifications sent after a note was saved, tagged, attached to or deleted.
+const NotifyNoteChanged = "noteChanged"
+
+// Error codes defined by JSON-RPC and the ones used for errors of the notebook.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	CodeNoteNotFound    = -32001
+	CodeIndexOutOfRange = -32002
+	CodeNoteExists      = -32003
+	CodeNoRecipients    = -32004
+	CodeDecryptFailed   = -32005
+	CodeReadOnly        = -32006
+	CodeInvalidNote     = -32007
+)
+
+// Request is a JSON-RPC request. Requests without an ID are notifications and are not answered.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC response, either Result or Error is set.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Notification is sent by the server without being requested.
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// Error is a structured JSON-RPC error. Data contains details about errors of the notebook.
+type Error struct {
+	Code    int        `json:"code"`
+	Message string     `json:"message"`
+	Data    *ErrorData `json:"data,omitempty"`
+}
+
+// ErrorData describes the failed operation and the note it was called for.
+type ErrorData struct {
+	Op  string `json:"op,omitempty"`
+	Ref string `json:"ref,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NoteSummary describes a note without its decrypted content.
+type NoteSummary struct {
+	Uuid        uuid.UUID `json:"uuid"`
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Created     time.Time `json:"created"`
+	Modified    time.Time `json:"modified"` // equals created for notes not modified since their creation
+	Tags        []string  `json:"tags"`
+	Attachments []string  `json:"attachments"`
+	IsFile      bool      `json:"isFile"`
+	Revision    uint64    `json:"revision"`
+}
+
+// NoteContent is a decrypted note. Text is set for text notes, Content for file notes.
+type NoteContent struct {
+	NoteSummary
+	Text    string `json:"text,omitempty"`
+	Content []byte `json:"content,omitempty"`
+}
+
+// ChangeEvent is the parameter of noteChanged notifications. Event is "saved" or "deleted".
+type ChangeEvent struct {
+	Event        string      `json:"event"`
+	Note         NoteSummary `json:"note"`
+	PreviousSlug string      `json:"previousSlug,omitempty"`
+}
+
+// RefParams references a note by slug, index as shown by "aen list" or UUID.
+type RefParams struct {
+	Slug  string    `json:"slug,omitempty"`
+	Index uint      `json:"index,omitempty"`
+	Uuid  uuid.UUID `json:"uuid,omitempty"`
+}
+
+func (p RefParams) ref() aen.Ref {
+	return aen.Ref{Slug: p.Slug, Index: p.Index, Uuid: p.Uuid}
+}
+
+func (p RefParams) empty() bool {
+	return p.Slug == "" && p.Index == 0 && p.Uuid == uuid.Nil
+}
+
+// ListParams are the parameters of "list".
+type ListParams struct {
+	Tag    string `json:"tag,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Sort   string `json:"sort,omitempty"` // "created" (default) or "modified"
+}
+
+// ListResult is the result of "list".
+type ListResult struct {
+	Notes  []NoteSummary `json:"notes"`
+	Offset int           `json:"offset"`
+	Total  int           `json:"total"`
+	Next   string        `json:"next,omitempty"`
+}
+
+// GetParams are the parameters of "get". If Attachment is given, only the attachment with this index is returned.
+type GetParams struct {
+	RefParams
+	Attachment *int `json:"attachment,omitempty"`
+}
+
+// AttachmentContent is the result of "get" for attachments.
+type AttachmentContent struct {
+	Filename string `json:"filename"`
+	Content  []byte `json:"content"`
+}
+
+// SaveParams are the parameters of "save". Without a reference a new note is written, otherwise the referenced
+// note is replaced. An empty title keeps the title of an existing note. Given tags replace the tags of an existing
+// note, an empty list removes all of them, without tags the tags are kept.
+type SaveParams struct {
+	RefParams
+	Title string   `json:"title"`
+	Text  string   `json:"text"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// TagParams are the parameters of "tag".
+type TagParams struct {
+	RefParams
+	Add    []string `json:"add,omitempty"`
+	Remove []string `json:"remove,omitempty"`
+}
+
+// AttachParams are the parameters of "attach", the content is base64 encoded.
+type AttachParams struct {
+	RefParams
+	Filename string `json:"filename"`
+	Content  []byte `json:"content"`
+}
+
+// SearchParams are the parameters of "search".
+type SearchParams struct {
+	Query string `json:"query"`
+}
+
+// SearchResult is an element of the result of "search".
+type SearchResult struct {
+	Note   NoteSummary `json:"note"`
+	Fields []string    `json:"fields"`
+}
+
+type handler func(ctx context.Context, params json.RawMessage) (result interface{}, err error)
+
+// Server answers requests using a notebook which stays open until the server stops.
+type Server struct {
+	nb      *aen.Notebook
+	methods map[string]handler
+	mu      sync.Mutex
+	enc     *json.Encoder
+	pending []ChangeEvent
+}
+
+// NewServer returns a server for the given notebook.
+func NewServer(nb *aen.Notebook) *Server {
+	s := &Server{nb: nb}
+	s.methods = map[string]handler{
+		"list":   s.list,
+		"get":    s.get,
+		"save":   s.save,
+		"tag":    s.tag,
+		"attach": s.attach,
+		"search": s.search,
+		"delete": s.delete,
+	}
+	return s
+}
+
+// Serve reads requests from r until it is closed or ctx is canceled and writes responses to w. Requests are
+// handled one after another, so notifications about changes are always sent after the response of the request
+// which caused them.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.enc = json.NewEncoder(w)
+	reader := bufio.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, readErr := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			if err := s.handle(ctx, line); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// handle processes a single message and writes the response and pending notifications.
+func (s *Server) handle(ctx context.Context, line []byte) error {
+	var req Request
+	if err := json.Unmarshal(line, &req); err != nil {
+		code := CodeParseError
+		if json.Valid(line) {
+			code = CodeInvalidRequest
+		}
+		return s.write(Response{JSONRPC: Version, ID: json.RawMessage("null"), Error: &Error{Code: code, Message: err.Error()}})
+	}
+
+	var result interface{}
+	var err error
+	if method, ok := s.methods[req.Method]; req.JSONRPC != Version || req.Method == "" {
+		err = &Error{Code: CodeInvalidRequest, Message: "invalid JSON-RPC 2.0 request"}
+	} else if !ok {
+		err = &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %s not found", req.Method)}
+	} else {
+		result, err = method(ctx, req.Params)
+	}
+
+	if req.ID != nil {
+		resp := Response{JSONRPC: Version, ID: req.ID, Result: result}
+		if err != nil {
+			resp.Result, resp.Error = nil, toError(err)
+		}
+		if err = s.write(resp); err != nil {
+			return err
+		}
+	}
+	for _, event := range s.pending {
+		if err = s.write(Notification{JSONRPC: Version, Method: NotifyNoteChanged, Params: event}); err != nil {
+			return err
+		}
+	}
+	s.pending = nil
+	return nil
+}
+
+func (s *Server) write(v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(v)
+}
+
+// notify queues a noteChanged notification, it is sent after the response.
+func (s *Server) notify(event string, note *aen.EncryptedNote, previousSlug string) {
+	changed := ChangeEvent{Event: event, Note: Summarize(note)}
+	if previousSlug != changed.Note.Slug {
+		changed.PreviousSlug = previousSlug
+	}
+	s.pending = append(s.pending, changed)
+}
+
+// toError converts errors of the notebook to structured JSON-RPC errors.
+func toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	e := &Error{Code: CodeInternalError, Message: err.Error()}
+	var noteErr *aen.NoteError
+	if errors.As(err, &noteErr) {
+		e.Data = &ErrorData{Op: noteErr.Op, Ref: noteErr.Ref}
+	}
+	switch {
+	case errors.Is(err, aen.ErrNoteNotFound):
+		e.Code = CodeNoteNotFound
+	case errors.Is(err, aen.ErrIndexOutOfRange):
+		e.Code = CodeIndexOutOfRange
+	case errors.Is(err, aen.ErrNoteExists):
+		e.Code = CodeNoteExists
+	case errors.Is(err, aen.ErrNoRecipients):
+		e.Code = CodeNoRecipients
+	case errors.Is(err, aen.ErrDecryptFailed):
+		e.Code = CodeDecryptFailed
+	case errors.Is(err, aen.ErrDatabaseReadOnly):
+		e.Code = CodeReadOnly
+	case errors.Is(err, aen.ErrEmptyTitle), errors.Is(err, aen.ErrFileNote), errors.Is(err, aen.ErrTextNote),
+		errors.Is(err, aen.ErrDuplicateAttachment), errors.Is(err, aen.ErrTagNotFound):
+		e.Code = CodeInvalidNote
+	}
+	return e
+}
+
+// decode unmarshals the parameters, missing parameters are treated like an empty object.
+func decode(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// decodeRef unmarshals parameters which must reference a note.
+func decodeRef(params json.RawMessage, v interface{}, ref *RefParams) error {
+	if err := decode(params, v); err != nil {
+		return err
+	}
+	if ref.empty() {
+		return &Error{Code: CodeInvalidParams, Message: "slug, index or uuid must be given"}
+	}
+	return nil
+}
+
+// Summarize returns the summary of a note, it is also used by the HTTP API.
+func Summarize(note *aen.EncryptedNote) NoteSummary {
+	summary := NoteSummary{
+		Uuid:        note.Uuid,
+		Slug:        note.Slug(),
+		Title:       note.Title,
+		Created:     note.Created,
+		Modified:    note.LastModified(),
+		Tags:        note.Tags,
+		Attachments: []string{},
+		IsFile:      note.ContainsFile(),
+		Revision:    note.Revision,
+	}
+	if summary.Tags == nil {
+		summary.Tags = []string{}
+	}
+	for _, attachment := range note.Attachments {
+		summary.Attachments = append(summary.Attachments, attachment.Filename)
+	}
+	return summary
+}
+
+func (s *Server) list(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p ListParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	page, err := s.nb.List(ctx, aen.ListOptions{
+		Tag:         p.Tag,
+		PageOptions: aen.PageOptions{Limit: p.Limit, Offset: p.Offset, Cursor: p.Cursor, Sort: p.Sort},
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := ListResult{Notes: []NoteSummary{}, Offset: page.Offset, Total: page.Total, Next: page.Next}
+	for i := range page.Notes {
+		result.Notes = append(result.Notes, Summarize(&page.Notes[i]))
+	}
+	return result, nil
+}
+
+func (s *Server) get(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p GetParams
+	if err := decodeRef(params, &p, &p.RefParams); err != nil {
+		return nil, err
+	}
+	if p.Attachment != nil {
+		attachment, err := s.nb.GetAttachment(ctx, p.ref(), *p.Attachment)
+		if err != nil {
+			return nil, err
+		}
+		return AttachmentContent{Filename: attachment.Filename, Content: attachment.Content}, nil
+	}
+
+	encryptedNote, err := s.nb.GetEncrypted(ctx, p.ref())
+	if err != nil {
+		return nil, err
+	}
+	result := NoteContent{NoteSummary: Summarize(encryptedNote)}
+	// The UUID is used for decrypting, so the note found above is returned even if the index changed meanwhile
+	ref := aen.ByUuid(encryptedNote.Uuid)
+	if encryptedNote.ContainsFile() {
+		fileNote, err := s.nb.GetFile(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		result.Content = fileNote.Content
+	} else {
+		note, err := s.nb.Get(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		result.Text = note.Text
+	}
+	return result, nil
+}
+
+func (s *Server) save(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p SaveParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.empty() {
+		encryptedNote, err := s.nb.Write(ctx, p.Title, p.Text, p.Tags...)
+		if err != nil {
+			return nil, err
+		}
+		s.notify("saved", encryptedNote, "")
+		return Summarize(encryptedNote), nil
+	}
+
+	stored, err := s.nb.GetEncrypted(ctx, p.ref())
+	if err != nil {
+		return nil, err
+	}
+	encryptedNote, err := s.nb.Edit(ctx, aen.ByUuid(stored.Uuid), func(note *aen.Note) error {
+		if p.Title != "" {
+			note.Title = p.Title
+		}
+		note.Text = p.Text
+		if p.Tags != nil {
+			aen.SetTags(note, p.Tags)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.notify("saved", encryptedNote, stored.Slug())
+	return Summarize(encryptedNote), nil
+}
+
+func (s *Server) tag(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p TagParams
+	if err := decodeRef(params, &p, &p.RefParams); err != nil {
+		return nil, err
+	}
+	encryptedNote, err := s.nb.Tag(ctx, p.ref(), p.Add, p.Remove)
+	if err != nil {
+		return nil, err
+	}
+	s.notify("saved", encryptedNote, "")
+	return Summarize(encryptedNote), nil
+}
+
+func (s *Server) attach(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p AttachParams
+	if err := decodeRef(params, &p, &p.RefParams); err != nil {
+		return nil, err
+	}
+	if p.Filename == "" {
+		return nil, &Error{Code: CodeInvalidParams, Message: "filename must be given"}
+	}
+	encryptedNote, err := s.nb.Attach(ctx, p.ref(), p.Filename, bytes.NewReader(p.Content))
+	if err != nil {
+		return nil, err
+	}
+	s.notify("saved", encryptedNote, "")
+	return Summarize(encryptedNote), nil
+}
+
+func (s *Server) search(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p SearchParams
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	results, err := s.nb.Search(ctx, p.Query)
+	if err != nil {
+		return nil, err
+	}
+	converted := []SearchResult{}
+	for i := range results {
+		converted = append(converted, SearchResult{Note: Summarize(&results[i].Note), Fields: results[i].Fields})
+	}
+	return converted, nil
+}
+
+func (s *Server) delete(ctx context.Context, params json.RawMessage) (interface{}, error) {
+	var p RefParams
+	if err := decodeRef(params, &p, &p); err != nil {
+		return nil, err
+	}
+	encryptedNote, err := s.nb.Delete(ctx, p.ref())
+	if err != nil {
+		return nil, err
+	}
+	s.notify("deleted", encryptedNote, "")
+	return Summarize(encryptedNote), nil
+}
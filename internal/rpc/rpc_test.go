@@ -0,0 +1,139 @@
+package rpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/rpc"
+)
+
+// message contains the fields of responses and notifications
+type message struct {
+	ID     json.RawMessage  `json:"id"`
+	Method string           `json:"method"`
+	Result json.RawMessage  `json:"result"`
+	Error  *rpc.Error       `json:"error"`
+	Params *rpc.ChangeEvent `json:"params"`
+}
+
+// Serves the given request lines using an in-memory notebook and returns the messages written by the server
+func serve(t *testing.T, requests ...string) (messages []message) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	nb := aen.NewNotebook(database.NewMemoryStore(), identity)
+	defer nb.Close()
+	if err = nb.AddRecipient(context.Background(), "test", identity.Recipient().String()); err != nil {
+		t.Fatalf("Could not add recipient: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	if err = rpc.NewServer(nb).Serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), out); err != nil {
+		t.Fatalf("Could not serve requests: %v", err)
+	}
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var msg message
+		if err = dec.Decode(&msg); err != nil {
+			t.Fatalf("Could not decode message: %v", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func TestServeNoteLifecycle(t *testing.T) {
+	messages := serve(t,
+		`{"jsonrpc":"2.0","id":1,"method":"save","params":{"title":"Hello World","text":"first"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"save","params":{"slug":"hello-world","title":"Renamed","text":"second"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tag","params":{"index":1,"add":["rpc"]}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"get","params":{"slug":"renamed"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"list","params":{"tag":"rpc"}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"delete","params":{"slug":"renamed"}}`,
+	)
+	if len(messages) != 10 {
+		t.Fatalf("Expected 6 responses and 4 notifications, got %d messages", len(messages))
+	}
+	for _, msg := range messages {
+		if msg.Error != nil {
+			t.Fatalf("Unexpected error: %v", msg.Error)
+		}
+	}
+
+	renamed := messages[3]
+	if renamed.Method != rpc.NotifyNoteChanged || renamed.Params.PreviousSlug != "hello-world" || renamed.Params.Note.Slug != "renamed" {
+		t.Fatalf("Unexpected notification after renaming: %+v", renamed)
+	}
+	var note rpc.NoteContent
+	if err := json.Unmarshal(messages[6].Result, &note); err != nil || note.Text != "second" || len(note.Tags) != 1 {
+		t.Fatalf("Unexpected note: %+v, %v", note, err)
+	}
+	var list rpc.ListResult
+	if err := json.Unmarshal(messages[7].Result, &list); err != nil || list.Total != 1 {
+		t.Fatalf("Unexpected list: %+v, %v", list, err)
+	}
+	if deleted := messages[9]; deleted.Params == nil || deleted.Params.Event != "deleted" {
+		t.Fatalf("Expected notification about deletion: %+v", deleted)
+	}
+}
+
+func TestServeSaveReplacesTags(t *testing.T) {
+	messages := serve(t,
+		`{"jsonrpc":"2.0","id":1,"method":"save","params":{"title":"Tagged","text":"text","tags":["a","b"]}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"save","params":{"slug":"tagged","text":"text","tags":["b","c","c"]}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"get","params":{"slug":"tagged"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"save","params":{"slug":"tagged","text":"text","tags":[]}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"get","params":{"slug":"tagged"}}`,
+	)
+	var replaced, removed rpc.NoteContent
+	for _, msg := range messages {
+		if msg.Error != nil {
+			t.Fatalf("Unexpected error: %v", msg.Error)
+		}
+		switch string(msg.ID) {
+		case "3":
+			if err := json.Unmarshal(msg.Result, &replaced); err != nil {
+				t.Fatalf("Could not parse note: %v", err)
+			}
+		case "5":
+			if err := json.Unmarshal(msg.Result, &removed); err != nil {
+				t.Fatalf("Could not parse note: %v", err)
+			}
+		}
+	}
+	if strings.Join(replaced.Tags, ",") != "b,c" {
+		t.Fatalf("Tags should have been replaced: %v", replaced.Tags)
+	}
+	if len(removed.Tags) != 0 {
+		t.Fatalf("Tags should have been removed: %v", removed.Tags)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	messages := serve(t,
+		`{"jsonrpc":"2.0","id":1,"method":"get","params":{"slug":"missing"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"unknown"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"delete","params":{}}`,
+		`not json`,
+		`{"jsonrpc":"2.0","method":"delete","params":{"slug":"missing"}}`,
+	)
+	expected := []int{rpc.CodeNoteNotFound, rpc.CodeMethodNotFound, rpc.CodeInvalidParams, rpc.CodeParseError}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d responses, got %d", len(expected), len(messages))
+	}
+	for i, code := range expected {
+		if messages[i].Error == nil || messages[i].Error.Code != code {
+			t.Fatalf("Expected error code %d for message %d: %+v", code, i, messages[i].Error)
+		}
+	}
+	if data := messages[0].Error.Data; data == nil || data.Op != "get" || data.Ref != "missing" {
+		t.Fatalf("Unexpected error data: %+v", data)
+	}
+}
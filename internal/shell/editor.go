@@ -0,0 +1,167 @@
+// Package shell provides the line editor of "aen shell": reading commands with history, tab completion
+// and splitting them into words.
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrInterrupted is returned by ReadLine if the line was discarded with Ctrl+C.
+var ErrInterrupted = errors.New("interrupted")
+
+// Editor reads lines from a terminal. If the input is no terminal, lines are read without editing.
+type Editor struct {
+	// Complete returns the candidates for the last word of the line.
+	Complete func(line string) (candidates []string)
+	// Interactive enables line editing, history and completion. It is set by NewEditor if the input is a terminal.
+	Interactive bool
+
+	in      *bufio.Reader
+	fd      int
+	out     io.Writer
+	history []string
+}
+
+// NewEditor returns an editor reading from in and echoing to out.
+func NewEditor(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{in: bufio.NewReader(in), fd: -1, out: out}
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		e.fd = int(f.Fd())
+		e.Interactive = true
+	}
+	return e
+}
+
+// Reader returns the buffered input of the editor. Commands reading further input, e.g. answers to questions, must
+// use it instead of stdin, as it may already contain the lines following the current command.
+func (e *Editor) Reader() *bufio.Reader {
+	return e.in
+}
+
+// ReadLine prints the prompt and returns the line entered without the line break. At the end of the input or
+// on Ctrl+D on an empty line io.EOF is returned. The terminal is only in raw mode while reading, so commands
+// started afterwards, e.g. editors, can use it as usual. Without terminal no prompt is printed.
+func (e *Editor) ReadLine(prompt string) (line string, err error) {
+	if !e.Interactive {
+		line, err = e.in.ReadString('\n')
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	fmt.Fprint(e.out, prompt)
+	if e.fd >= 0 {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+	line, err = e.edit(prompt)
+	if err == nil && strings.TrimSpace(line) != "" {
+		e.history = append(e.history, line)
+	}
+	return line, err
+}
+
+// edit handles the key presses until the line is entered.
+func (e *Editor) edit(prompt string) (string, error) {
+	var line []rune
+	pos := len(e.history)
+	redraw := func() { fmt.Fprintf(e.out, "\r\x1b[K%s%s", prompt, string(line)) }
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case 3: // Ctrl+C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl+D
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+		case 127, 8: // Backspace
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		case 21: // Ctrl+U
+			line = line[:0]
+		case 23: // Ctrl+W
+			trimmed := strings.TrimRight(string(line), " ")
+			line = []rune(trimmed[:strings.LastIndex(trimmed, " ")+1])
+		case '\t':
+			line = e.complete(line, redraw)
+		case 27: // Escape sequences, only the arrows up and down are used for the history
+			if next, _, _ := e.in.ReadRune(); next != '[' {
+				continue
+			}
+			switch key, _, _ := e.in.ReadRune(); {
+			case key == 'A' && pos > 0:
+				pos--
+				line = []rune(e.history[pos])
+			case key == 'B' && pos < len(e.history):
+				pos++
+				line = nil
+				if pos < len(e.history) {
+					line = []rune(e.history[pos])
+				}
+			}
+		default:
+			if r >= ' ' {
+				line = append(line, r)
+			}
+		}
+		redraw()
+	}
+}
+
+// complete extends the last word of the line by the common prefix of all candidates. If the word can't be
+// extended, the candidates are printed.
+func (e *Editor) complete(line []rune, redraw func()) []rune {
+	if e.Complete == nil {
+		return line
+	}
+	s := string(line)
+	word := s[strings.LastIndexAny(s, " \t")+1:]
+	var matches []string
+	for _, candidate := range e.Complete(s) {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return line
+	case 1:
+		return []rune(s + matches[0][len(word):] + " ")
+	}
+	sort.Strings(matches)
+	prefix := commonPrefix(matches)
+	if len(prefix) > len(word) {
+		return []rune(s + prefix[len(word):])
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(matches, "  "))
+	return line
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,43 @@
+package shell_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/3c7/aen/internal/shell"
+)
+
+func TestEditor(t *testing.T) {
+	// Completes the slug, removes a character, recalls the line from the history and discards a line
+	input := "get -s he\t\x7fo\r\x1b[A\r\x03\x04"
+	editor := shell.NewEditor(strings.NewReader(input), &bytes.Buffer{})
+	editor.Interactive = true
+	editor.Complete = func(line string) []string { return []string{"hello", "world"} }
+
+	expected := []string{"get -s helloo", "get -s helloo"}
+	for i := range expected {
+		if line, err := editor.ReadLine("> "); err != nil || line != expected[i] {
+			t.Fatalf("Unexpected line %d: %q, %v", i, line, err)
+		}
+	}
+	if _, err := editor.ReadLine("> "); err != shell.ErrInterrupted {
+		t.Fatalf("Ctrl+C should discard the line: %v", err)
+	}
+	if _, err := editor.ReadLine("> "); err != io.EOF {
+		t.Fatalf("Ctrl+D should end the input: %v", err)
+	}
+}
+
+func TestEditorWithoutTerminal(t *testing.T) {
+	editor := shell.NewEditor(strings.NewReader("list\nget -i 1"), &bytes.Buffer{})
+	for _, expected := range []string{"list", "get -i 1"} {
+		if line, err := editor.ReadLine("> "); err != nil || line != expected {
+			t.Fatalf("Unexpected line: %q, %v", line, err)
+		}
+	}
+	if _, err := editor.ReadLine("> "); err != io.EOF {
+		t.Fatalf("Expected end of input: %v", err)
+	}
+}
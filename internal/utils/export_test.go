@@ -0,0 +1,4 @@
+package utils
+
+// Link replaces the function used to publish files without force, so file systems without hard links can be tested.
+var Link = &link
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// PrivateTempDir creates a directory only accessible by the current user for files containing plaintext. RAM backed
+// file systems are preferred, so the plaintext is not written to disk: $XDG_RUNTIME_DIR and /dev/shm are tried first.
+// If neither of them is RAM backed, the directory is created in the default directory for temporary files and
+// ramBacked is false.
+func PrivateTempDir(pattern string) (dir string, ramBacked bool, err error) {
+	for _, base := range []string{os.Getenv("XDG_RUNTIME_DIR"), "/dev/shm"} {
+		if base == "" || !isRAMBacked(base) {
+			continue
+		}
+		if dir, err = os.MkdirTemp(base, pattern); err == nil {
+			return dir, true, os.Chmod(dir, 0700)
+		}
+	}
+	if dir, err = os.MkdirTemp("", pattern); err != nil {
+		return "", false, err
+	}
+	return dir, false, os.Chmod(dir, 0700)
+}
+
+// ShredDir overwrites all files in the directory with random data and removes the directory afterwards. Files created
+// by other programs, e.g. swap and backup files of editors, are shredded as well. The directory is removed even if
+// a file could not be overwritten, the first error is returned.
+func ShredDir(dir string) (err error) {
+	walkErr := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		return OverwriteFileContent(path)
+	})
+	if err = os.RemoveAll(dir); walkErr != nil {
+		return walkErr
+	}
+	return err
+}
@@ -0,0 +1,12 @@
+package utils
+
+import "golang.org/x/sys/unix"
+
+// isRAMBacked checks whether the path is located on a tmpfs or ramfs file system.
+func isRAMBacked(path string) bool {
+	var fs unix.Statfs_t
+	if err := unix.Statfs(path, &fs); err != nil {
+		return false
+	}
+	return fs.Type == unix.TMPFS_MAGIC || fs.Type == unix.RAMFS_MAGIC
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+// isRAMBacked can not detect RAM backed file systems on this platform, so temporary files are never considered to be
+// kept in memory.
+func isRAMBacked(path string) bool {
+	return false
+}
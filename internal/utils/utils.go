@@ -3,8 +3,13 @@ package utils
 import (
 	"crypto/rand"
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"unicode"
 
 	"filippo.io/age"
 )
@@ -67,3 +72,95 @@ func IsPipe() bool {
 	fi, _ := os.Stdin.Stat()
 	return fi.Mode()&os.ModeCharDevice == 0
 }
+
+// SafeFilename reduces a name, e.g. taken from a note title, to a basename which can not escape the directory
+// it is written to. Path separators are replaced and names consisting only of dots are rejected.
+func SafeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if strings.Trim(name, ".") == "" {
+		return "unnamed"
+	}
+	return name
+}
+
+// link publishes a temporary file without replacing an existing file, it is replaced in tests.
+var link = os.Link
+
+// WriteFileAtomic writes the content read from r to a temporary file in the same directory, which is renamed to
+// path afterwards, so the file is either written completely or not at all. An existing file is only replaced
+// if force is set, otherwise an error wrapping os.ErrExist is returned. Without force, the temporary file is
+// published with a hard link, which fails if the file was created meanwhile, instead of being renamed. File systems
+// without hard links, e.g. FAT formatted drives, fall back to copying the temporary file into a newly created file.
+func WriteFileAtomic(path string, r io.Reader, force bool) (err error) {
+	if !force {
+		if _, err = os.Lstat(path); err == nil {
+			return fmt.Errorf("%s: %w, use --force to overwrite it", path, os.ErrExist)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = io.Copy(tmp, r); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if force {
+		return os.Rename(tmp.Name(), path)
+	}
+	if err = link(tmp.Name(), path); err != nil && !errors.Is(err, os.ErrExist) {
+		err = copyExclusive(tmp.Name(), path)
+	}
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s: %w, use --force to overwrite it", path, os.ErrExist)
+	} else if err != nil {
+		return err
+	}
+	return os.Remove(tmp.Name())
+}
+
+// copyExclusive copies the file at src to a new file at dst, which fails with os.ErrExist if dst is available. If
+// copying fails, the incomplete file at dst is removed.
+func copyExclusive(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+	}()
+	if _, err = io.Copy(out, in); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
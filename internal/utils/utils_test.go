@@ -1,8 +1,13 @@
 package utils_test
 
 import (
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/3c7/aen/internal/utils"
@@ -40,3 +45,141 @@ func TestOverwriteFileContents(t *testing.T) {
 	t.Logf("File content seems to be overwritten: %s", string(content))
 	os.Remove(tmp.Name())
 }
+
+func TestSafeFilename(t *testing.T) {
+	cases := map[string]string{
+		"notes.txt":      "notes.txt",
+		"../../.bashrc":  ".._.._.bashrc",
+		"/etc/passwd":    "_etc_passwd",
+		"..":             "unnamed",
+		"":               "unnamed",
+		"dir\\file.txt":  "dir_file.txt",
+		"line\nbreak.md": "line_break.md",
+	}
+	for name, expected := range cases {
+		if safe := utils.SafeFilename(name); safe != expected {
+			t.Errorf("SafeFilename(%q) should be %q but was %q", name, expected, safe)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := utils.WriteFileAtomic(path, strings.NewReader("first"), false); err != nil {
+		t.Fatalf("Could not write file: %v", err)
+	}
+	if err := utils.WriteFileAtomic(path, strings.NewReader("second"), false); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("Existing file should not be overwritten without force: %v", err)
+	}
+	if err := utils.WriteFileAtomic(path, strings.NewReader("third"), true); err != nil {
+		t.Fatalf("Could not overwrite file: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "third" {
+		t.Fatalf("Unexpected content %q: %v", content, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("File should only be readable by the owner: %v, %v", info.Mode(), err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Temporary files should be removed: %v, %v", entries, err)
+	}
+}
+
+func TestPrivateTempDirAndShredDir(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	dir, _, err := utils.PrivateTempDir("aen-test*")
+	if err != nil {
+		t.Fatalf("Could not create temporary directory: %v", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("Directory should only be accessible by the owner: %v, %v", info.Mode(), err)
+	}
+	// Editors place swap and backup files next to the edited file
+	for _, name := range []string{"note.md", ".note.md.swp", "note.md~"} {
+		if err = os.WriteFile(filepath.Join(dir, name), []byte("secret"), 0600); err != nil {
+			t.Fatalf("Could not write file: %v", err)
+		}
+	}
+	if err = utils.ShredDir(dir); err != nil {
+		t.Fatalf("Could not shred directory: %v", err)
+	}
+	if _, err = os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Directory should be removed: %v", err)
+	}
+}
+
+// createOnRead creates the file at path while the content is read, like a concurrent writer would.
+type createOnRead struct {
+	path string
+	r    io.Reader
+}
+
+func (c *createOnRead) Read(p []byte) (int, error) {
+	if c.path != "" {
+		if err := os.WriteFile(c.path, []byte("concurrent"), 0600); err != nil {
+			return 0, err
+		}
+		c.path = ""
+	}
+	return c.r.Read(p)
+}
+
+func TestWriteFileAtomicConcurrentCreate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	r := &createOnRead{path: path, r: strings.NewReader("mine")}
+	if err := utils.WriteFileAtomic(path, r, false); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("File created meanwhile should not be overwritten without force: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "concurrent" {
+		t.Fatalf("Unexpected content %q: %v", content, err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Temporary files should be removed: %v, %v", entries, err)
+	}
+}
+
+func TestWriteFileAtomicWithoutHardLinks(t *testing.T) {
+	defer func(link func(string, string) error) { *utils.Link = link }(*utils.Link)
+	*utils.Link = func(string, string) error { return syscall.EPERM }
+
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := utils.WriteFileAtomic(path, strings.NewReader("copied"), false); err != nil {
+		t.Fatalf("Could not write file without hard links: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "copied" {
+		t.Fatalf("Unexpected content %q: %v", content, err)
+	}
+	r := &createOnRead{path: path + ".new", r: strings.NewReader("mine")}
+	if err = utils.WriteFileAtomic(path+".new", r, false); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("File created meanwhile should not be overwritten without force: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Temporary files should be removed: %v, %v", entries, err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := map[string][]string{
+		`get -s hello`:                {"get", "-s", "hello"},
+		`write -t "Hello World" -m x`: {"write", "-t", "Hello World", "-m", "x"},
+		`tag -a 'a b' c\ d`:           {"tag", "-a", "a b", "c d"},
+		`  `:                          nil,
+	}
+	for line, expected := range tests {
+		words, err := utils.Split(line)
+		if err != nil || !reflect.DeepEqual(words, expected) {
+			t.Fatalf("Unexpected words for %s: %q, %v", line, words, err)
+		}
+	}
+	if _, err := utils.Split(`write -t "unterminated`); err == nil {
+		t.Fatal("Unterminated quotes should fail")
+	}
+}
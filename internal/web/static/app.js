@@ -0,0 +1,119 @@
+"use strict";
+
+// current is the slug of the note shown in the editor, empty for a new note
+let current = "";
+
+async function api(method, path, body) {
+  const options = { method: method, headers: {} };
+  if (body !== undefined) {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body);
+  }
+  const response = await fetch(path, options);
+  const result = await response.json();
+  if (!response.ok) {
+    throw new Error(result.error);
+  }
+  return result;
+}
+
+function status(message) {
+  document.getElementById("status").textContent = message;
+}
+
+function showNotes(notes) {
+  const list = document.getElementById("notes");
+  list.replaceChildren();
+  for (const note of notes) {
+    const item = document.createElement("li");
+    const time = document.createElement("small");
+    item.textContent = note.title;
+    time.textContent = new Date(note.created).toLocaleString() + (note.tags.length ? " · " + note.tags.join(", ") : "");
+    item.appendChild(time);
+    item.addEventListener("click", () => openNote(note.slug));
+    list.appendChild(item);
+  }
+}
+
+async function loadNotes() {
+  const query = document.getElementById("query").value;
+  try {
+    if (query) {
+      showNotes((await api("GET", "/api/search?q=" + encodeURIComponent(query))).map(result => result.note));
+    } else {
+      showNotes((await api("GET", "/api/notes")).notes);
+    }
+  } catch (e) {
+    status(e.message);
+  }
+}
+
+async function openNote(slug) {
+  try {
+    const note = await api("GET", "/api/notes/" + encodeURIComponent(slug));
+    current = slug;
+    document.getElementById("title").value = note.title;
+    document.getElementById("text").value = note.text || "";
+    document.getElementById("text").disabled = note.isFile;
+    document.getElementById("tags").textContent = note.tags.join(", ");
+    const attachments = document.getElementById("attachments");
+    attachments.replaceChildren();
+    const links = note.isFile ? [[note.title, "file"]] : note.attachments.map((name, i) => [name, "attachments/" + i]);
+    for (const [name, path] of links) {
+      const item = document.createElement("li");
+      const link = document.createElement("a");
+      link.textContent = name;
+      link.href = "/api/notes/" + encodeURIComponent(slug) + "/" + path;
+      item.appendChild(link);
+      attachments.appendChild(item);
+    }
+    document.getElementById("editor").hidden = false;
+    status("");
+  } catch (e) {
+    status(e.message);
+  }
+}
+
+function newNote() {
+  current = "";
+  for (const id of ["title", "text"]) {
+    document.getElementById(id).value = "";
+  }
+  document.getElementById("text").disabled = false;
+  document.getElementById("tags").textContent = "";
+  document.getElementById("attachments").replaceChildren();
+  document.getElementById("editor").hidden = false;
+}
+
+async function saveNote(event) {
+  event.preventDefault();
+  const body = { title: document.getElementById("title").value, text: document.getElementById("text").value };
+  try {
+    const note = current ? await api("PUT", "/api/notes/" + encodeURIComponent(current), body) : await api("POST", "/api/notes", body);
+    await loadNotes();
+    await openNote(note.slug);
+    status("Saved " + note.slug + ".");
+  } catch (e) {
+    status(e.message);
+  }
+}
+
+async function deleteNote() {
+  if (!current || !confirm("Delete " + current + "?")) {
+    return;
+  }
+  try {
+    await api("DELETE", "/api/notes/" + encodeURIComponent(current));
+    document.getElementById("editor").hidden = true;
+    current = "";
+    await loadNotes();
+  } catch (e) {
+    status(e.message);
+  }
+}
+
+document.getElementById("search").addEventListener("submit", event => { event.preventDefault(); loadNotes(); });
+document.getElementById("new").addEventListener("click", newNote);
+document.getElementById("editor").addEventListener("submit", saveNote);
+document.getElementById("delete").addEventListener("click", deleteNote);
+loadNotes();
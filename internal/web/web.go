@@ -0,0 +1,336 @@
+// Package web implements the HTTP API and the embedded web UI of "aen web". Every request must carry the
+// session token, either as bearer token or as cookie, which is set when opening the UI with ?token=<token>.
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/rpc"
+)
+
+// CookieName is the name of the cookie containing the session token.
+const CookieName = "aen_token"
+
+// maxBodySize limits the size of request bodies, e.g. of uploaded attachments.
+const maxBodySize = 64 << 20
+
+//go:embed static
+var static embed.FS
+
+// Server serves the API below /api/ and the UI for a single notebook.
+type Server struct {
+	nb    *aen.Notebook
+	token string
+	mux   *http.ServeMux
+}
+
+// NoteParams is the body of requests creating or updating notes. An empty title keeps the title of an existing note.
+// Given tags replace the tags of an existing note, an empty list removes all of them, without tags they are kept.
+type NoteParams struct {
+	Title string   `json:"title"`
+	Text  string   `json:"text"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// NewToken returns a random token for a session.
+func NewToken() (token string, err error) {
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// CheckListen returns an error if the address does not refer to a loopback interface and allowRemote is not set.
+func CheckListen(addr string, allowRemote bool) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if allowRemote {
+		return nil
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%s is not a loopback address", addr)
+	}
+	return nil
+}
+
+// NewServer returns a server requiring the given token.
+func NewServer(nb *aen.Notebook, token string) *Server {
+	s := &Server{nb: nb, token: token, mux: http.NewServeMux()}
+	ui, _ := fs.Sub(static, "static")
+	s.mux.Handle("/", http.FileServer(http.FS(ui)))
+	s.mux.HandleFunc("/api/notes", s.notes)
+	s.mux.HandleFunc("/api/notes/", s.note)
+	s.mux.HandleFunc("/api/search", s.search)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if query := r.URL.Query().Get("token"); query != "" && s.valid(query) && r.Method == http.MethodGet && r.URL.Path == "/" {
+		// Opening the printed URL stores the token in a cookie and removes it from the address bar
+		http.SetCookie(w, &http.Cookie{Name: CookieName, Value: query, Path: "/", HttpOnly: true, SameSite: http.SameSiteStrictMode})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'")
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) valid(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); bearer != "" && s.valid(bearer) {
+		return true
+	}
+	cookie, err := r.Cookie(CookieName)
+	return err == nil && s.valid(cookie.Value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// fail writes an error of the notebook using a matching status code.
+func fail(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, aen.ErrNoteNotFound), errors.Is(err, aen.ErrIndexOutOfRange):
+		status = http.StatusNotFound
+	case errors.Is(err, aen.ErrNoteExists):
+		status = http.StatusConflict
+	case errors.Is(err, aen.ErrEmptyTitle), errors.Is(err, aen.ErrFileNote), errors.Is(err, aen.ErrTextNote),
+		errors.Is(err, aen.ErrDuplicateAttachment), errors.Is(err, aen.ErrTagNotFound):
+		status = http.StatusBadRequest
+	case errors.Is(err, aen.ErrDatabaseReadOnly):
+		status = http.StatusForbidden
+	}
+	writeError(w, status, err)
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+func readParams(w http.ResponseWriter, r *http.Request) (p NoteParams, ok bool) {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&p); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return p, false
+	}
+	return p, true
+}
+
+// notes handles GET /api/notes for listing and POST /api/notes for creating notes.
+func (s *Server) notes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		opts := aen.ListOptions{Tag: query.Get("tag"), PageOptions: aen.PageOptions{Cursor: query.Get("cursor"), Sort: query.Get("sort")}}
+		var err error
+		if v := query.Get("limit"); v != "" {
+			if opts.Limit, err = strconv.Atoi(v); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if v := query.Get("offset"); v != "" {
+			if opts.Offset, err = strconv.Atoi(v); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		page, err := s.nb.List(r.Context(), opts)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		result := rpc.ListResult{Notes: []rpc.NoteSummary{}, Offset: page.Offset, Total: page.Total, Next: page.Next}
+		for i := range page.Notes {
+			result.Notes = append(result.Notes, rpc.Summarize(&page.Notes[i]))
+		}
+		writeJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		p, ok := readParams(w, r)
+		if !ok {
+			return
+		}
+		encryptedNote, err := s.nb.Write(r.Context(), p.Title, p.Text, p.Tags...)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, rpc.Summarize(encryptedNote))
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// note handles /api/notes/<slug>, /api/notes/<slug>/file and /api/notes/<slug>/attachments/<index>.
+func (s *Server) note(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/notes/"), "/")
+	ref := aen.BySlug(parts[0])
+	switch {
+	case parts[0] == "":
+		writeError(w, http.StatusNotFound, aen.ErrNoteNotFound)
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodGet:
+			s.getNote(w, r, ref)
+		case http.MethodPut:
+			s.updateNote(w, r, ref)
+		case http.MethodDelete:
+			encryptedNote, err := s.nb.Delete(r.Context(), ref)
+			if err != nil {
+				fail(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, rpc.Summarize(encryptedNote))
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+		}
+	case len(parts) == 2 && parts[1] == "file":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		fileNote, err := s.nb.GetFile(r.Context(), ref)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		download(w, fileNote.Title, fileNote.Content)
+	case len(parts) == 2 && parts[1] == "attachments":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		filename := r.URL.Query().Get("filename")
+		if filename == "" {
+			writeError(w, http.StatusBadRequest, errors.New("filename must be given"))
+			return
+		}
+		encryptedNote, err := s.nb.Attach(r.Context(), ref, filename, http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rpc.Summarize(encryptedNote))
+	case len(parts) == 3 && parts[1] == "attachments":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		idx, err := strconv.Atoi(parts[2])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		attachment, err := s.nb.GetAttachment(r.Context(), ref, idx)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		download(w, attachment.Filename, attachment.Content)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) getNote(w http.ResponseWriter, r *http.Request, ref aen.Ref) {
+	encryptedNote, err := s.nb.GetEncrypted(r.Context(), ref)
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	result := rpc.NoteContent{NoteSummary: rpc.Summarize(encryptedNote)}
+	// File notes are downloaded via /file, so only the metadata is returned here
+	if !encryptedNote.ContainsFile() {
+		note, err := s.nb.Get(r.Context(), ref)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		result.Text = note.Text
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) updateNote(w http.ResponseWriter, r *http.Request, ref aen.Ref) {
+	p, ok := readParams(w, r)
+	if !ok {
+		return
+	}
+	encryptedNote, err := s.nb.Edit(r.Context(), ref, func(note *aen.Note) error {
+		if p.Title != "" {
+			note.Title = p.Title
+		}
+		note.Text = p.Text
+		if p.Tags != nil {
+			aen.SetTags(note, p.Tags)
+		}
+		return nil
+	})
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rpc.Summarize(encryptedNote))
+}
+
+// search handles GET /api/search?q=<query>.
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	results, err := s.nb.Search(r.Context(), r.URL.Query().Get("q"))
+	if err != nil {
+		fail(w, err)
+		return
+	}
+	converted := []rpc.SearchResult{}
+	for i := range results {
+		converted = append(converted, rpc.SearchResult{Note: rpc.Summarize(&results[i].Note), Fields: results[i].Fields})
+	}
+	writeJSON(w, http.StatusOK, converted)
+}
+
+// download writes the content as file download.
+func download(w http.ResponseWriter, filename string, content []byte) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.Write(content)
+}
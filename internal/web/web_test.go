@@ -0,0 +1,157 @@
+package web_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/rpc"
+	"github.com/3c7/aen/internal/web"
+)
+
+const token = "secret"
+
+// Provides a test server using an in-memory notebook
+func provideServer(t *testing.T) *httptest.Server {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	nb := aen.NewNotebook(database.NewMemoryStore(), identity)
+	if err = nb.AddRecipient(context.Background(), "test", identity.Recipient().String()); err != nil {
+		t.Fatalf("Could not add recipient: %v", err)
+	}
+	server := httptest.NewServer(web.NewServer(nb, token))
+	t.Cleanup(func() {
+		server.Close()
+		nb.Close()
+	})
+	return server
+}
+
+// Sends an authorized request and decodes the JSON response into v, if given
+func request(t *testing.T, server *httptest.Server, method, path, body string, v interface{}) int {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Could not send request: %v", err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("Could not decode response of %s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestToken(t *testing.T) {
+	server := provideServer(t)
+	resp, err := http.Get(server.URL + "/api/notes")
+	if err != nil {
+		t.Fatalf("Could not send request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Requests without token must be rejected: %d", resp.StatusCode)
+	}
+
+	// Opening the UI with the token sets a cookie, which the client uses after being redirected
+	client := server.Client()
+	if client.Jar, err = cookiejar.New(nil); err != nil {
+		t.Fatalf("Could not create cookie jar: %v", err)
+	}
+	resp, err = client.Get(server.URL + "/?token=" + token)
+	if err != nil {
+		t.Fatalf("Could not send request: %v", err)
+	}
+	page, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(page), "Age Encrypted Notebook") {
+		t.Fatalf("Expected UI after redirect: %d", resp.StatusCode)
+	}
+}
+
+func TestNotesAPI(t *testing.T) {
+	server := provideServer(t)
+
+	var summary rpc.NoteSummary
+	if status := request(t, server, "POST", "/api/notes", `{"title":"Hello World","text":"first","tags":["web"]}`, &summary); status != http.StatusCreated {
+		t.Fatalf("Could not create note: %d", status)
+	}
+	if status := request(t, server, "POST", "/api/notes", `{"title":"Hello World","text":"again"}`, nil); status != http.StatusConflict {
+		t.Fatalf("Creating a note with an existing slug should conflict: %d", status)
+	}
+	if status := request(t, server, "PUT", "/api/notes/hello-world", `{"text":"second"}`, &summary); status != http.StatusOK || len(summary.Tags) != 1 {
+		t.Fatalf("Could not update note: %d, %+v", status, summary)
+	}
+
+	var note rpc.NoteContent
+	if status := request(t, server, "GET", "/api/notes/hello-world", "", &note); status != http.StatusOK || note.Text != "second" || note.Title != "Hello World" {
+		t.Fatalf("Unexpected note: %d, %+v", status, note)
+	}
+	var list rpc.ListResult
+	if status := request(t, server, "GET", "/api/notes?tag=web", "", &list); status != http.StatusOK || list.Total != 1 {
+		t.Fatalf("Unexpected list: %d, %+v", status, list)
+	}
+	if status := request(t, server, "PUT", "/api/notes/hello-world", `{"text":"second","tags":["api"]}`, &summary); status != http.StatusOK || len(summary.Tags) != 1 || summary.Tags[0] != "api" {
+		t.Fatalf("Tags should have been replaced: %d, %+v", status, summary)
+	}
+	var results []rpc.SearchResult
+	if status := request(t, server, "GET", "/api/search?q=SECOND", "", &results); status != http.StatusOK || len(results) != 1 {
+		t.Fatalf("Unexpected search results: %d, %+v", status, results)
+	}
+
+	if status := request(t, server, "POST", "/api/notes/hello-world/attachments?filename=a.txt", "attached", nil); status != http.StatusOK {
+		t.Fatalf("Could not attach file: %d", status)
+	}
+	req, _ := http.NewRequest("GET", server.URL+"/api/notes/hello-world/attachments/0", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Could not download attachment: %v", err)
+	}
+	content, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(content) != "attached" || !strings.Contains(resp.Header.Get("Content-Disposition"), "a.txt") {
+		t.Fatalf("Unexpected attachment download: %s, %v", content, resp.Header)
+	}
+
+	if status := request(t, server, "DELETE", "/api/notes/hello-world", "", nil); status != http.StatusOK {
+		t.Fatalf("Could not delete note: %d", status)
+	}
+	if status := request(t, server, "GET", "/api/notes/hello-world", "", nil); status != http.StatusNotFound {
+		t.Fatalf("Deleted note should not be found: %d", status)
+	}
+}
+
+func TestCheckListen(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8080": true,
+		"[::1]:8080":     true,
+		"localhost:8080": true,
+		"0.0.0.0:8080":   false,
+		":8080":          false,
+		"10.0.0.1:8080":  false,
+	}
+	for addr, allowed := range tests {
+		if err := web.CheckListen(addr, false); (err == nil) != allowed {
+			t.Fatalf("Unexpected result for %s: %v", addr, err)
+		}
+	}
+	if err := web.CheckListen("0.0.0.0:8080", true); err != nil {
+		t.Fatalf("Remote addresses should be allowed explicitly: %v", err)
+	}
+}
@@ -0,0 +1,708 @@
+package aen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"filippo.io/age"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+	"github.com/3c7/aen/internal/utils"
+	uuid "github.com/google/uuid"
+)
+
+// Types used by the Notebook API. They are aliases, so they can be used outside of this module.
+type (
+	Note                = model.Note
+	FileNote            = model.FileNote
+	Attachment          = model.Attachment
+	EncryptedAttachment = model.EncryptedAttachment
+	EncryptedNote       = model.EncryptedNote
+	Recipient           = model.Recipient
+	Page                = model.Page
+	PageOptions         = model.PageOptions
+	Store               = database.Store
+)
+
+// Fields notes can be sorted by, see PageOptions.Sort.
+const (
+	SortCreated  = model.SortCreated
+	SortModified = model.SortModified
+)
+
+// Notebook provides the operations of the command line tool as a library. No method terminates the program,
+// errors are returned as *NoteError wrapping one of the Err* errors or the error of the underlying store.
+type Notebook struct {
+	store    Store
+	identity age.Identity
+}
+
+// Ref references a note by its slug, its index as shown by "aen list" (starting at 1) or its UUID.
+// The first field set is used.
+type Ref struct {
+	Slug  string
+	Index uint
+	Uuid  uuid.UUID
+}
+
+// BySlug returns a reference to the note with the given slug.
+func BySlug(slug string) Ref {
+	return Ref{Slug: slug}
+}
+
+// ByIndex returns a reference to the note with the given index, see "aen list".
+func ByIndex(idx uint) Ref {
+	return Ref{Index: idx}
+}
+
+// ByUuid returns a reference to the note with the given UUID.
+func ByUuid(id uuid.UUID) Ref {
+	return Ref{Uuid: id}
+}
+
+func (r Ref) String() string {
+	switch {
+	case r.Slug != "":
+		return r.Slug
+	case r.Index > 0:
+		return fmt.Sprintf("#%d", r.Index)
+	case r.Uuid != uuid.Nil:
+		return r.Uuid.String()
+	}
+	return ""
+}
+
+// ListOptions selects the notes returned by List. Only notes with the given tag are listed, if Tag is set.
+type ListOptions struct {
+	Tag string
+	PageOptions
+}
+
+// SearchResult is a note matching a search and the fields which matched: "title", "tag", "field", "attachment" or
+// "text".
+type SearchResult struct {
+	Note   EncryptedNote
+	Fields []string
+}
+
+// Open opens the notebook given by path, see OpenStore for the supported paths. The identity is only needed
+// for decrypting notes and can be nil, if notes are only listed, written or tagged.
+func Open(path string, identity age.Identity) (nb *Notebook, err error) {
+	store, err := OpenStore(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return NewNotebook(store, identity), nil
+}
+
+// NewNotebook returns a notebook using an already opened store, e.g. database.NewMemoryStore for tests.
+func NewNotebook(store Store, identity age.Identity) *Notebook {
+	return &Notebook{store: store, identity: identity}
+}
+
+// LoadKey reads an age identity from a keyfile without creating it, unlike EnsureKey.
+func LoadKey(path string) (identity *age.X25519Identity, err error) {
+	return utils.IdentityFromKeyfile(path)
+}
+
+// SetIdentity replaces the identity used for decrypting notes. Setting nil removes it, e.g. for locking a session.
+func (nb *Notebook) SetIdentity(identity age.Identity) {
+	nb.identity = identity
+}
+
+// Store returns the underlying store, e.g. for functions only available for a specific backend.
+func (nb *Notebook) Store() Store {
+	return nb.store
+}
+
+// Close closes the underlying store.
+func (nb *Notebook) Close() error {
+	return nb.store.Close()
+}
+
+func fail(op string, ref Ref, err error) error {
+	return &NoteError{Op: op, Ref: ref.String(), Err: err}
+}
+
+// lookup returns the encrypted note referenced by ref.
+func (nb *Notebook) lookup(ref Ref) (encryptedNote *EncryptedNote, err error) {
+	switch {
+	case ref.Slug != "":
+		available, err := nb.store.CheckSlug(ref.Slug)
+		if err != nil {
+			return nil, err
+		}
+		if !available {
+			return nil, ErrNoteNotFound
+		}
+		return nb.store.GetEncryptedNoteBySlug(ref.Slug)
+	case ref.Index > 0:
+		notes, err := nb.store.GetEncryptedNotes()
+		if err != nil {
+			return nil, err
+		}
+		if int(ref.Index) > len(notes) {
+			return nil, fmt.Errorf("%w: %d", ErrIndexOutOfRange, ref.Index)
+		}
+		model.SortNoteSlice(notes)
+		return &notes[ref.Index-1], nil
+	case ref.Uuid != uuid.Nil:
+		notes, err := nb.store.GetAllEncryptedNotes()
+		if err != nil {
+			return nil, err
+		}
+		for i := range notes {
+			if notes[i].Uuid == ref.Uuid {
+				return &notes[i], nil
+			}
+		}
+		return nil, ErrNoteNotFound
+	}
+	return nil, errors.New("slug, index or UUID must be given")
+}
+
+// save stores the note. If oldSlug differs from the slug of the note, e.g. because the title changed,
+// the note stored under oldSlug is removed in the same write. Notes are never saved over a different note.
+// An oldSlug marks the note as changed, so its modification time is set.
+func (nb *Notebook) save(encryptedNote *EncryptedNote, oldSlug string) (err error) {
+	slug := encryptedNote.Slug()
+	if slug == "" {
+		return ErrEmptyTitle
+	}
+	if oldSlug != "" {
+		encryptedNote.Modified = time.Now()
+	}
+	if slug != oldSlug {
+		available, err := nb.store.CheckSlug(slug)
+		if err != nil {
+			return err
+		}
+		if available {
+			existing, err := nb.store.GetEncryptedNoteBySlug(slug)
+			if err != nil {
+				return err
+			}
+			if existing.Uuid != encryptedNote.Uuid {
+				return ErrNoteExists
+			}
+		}
+	}
+	if oldSlug != "" && oldSlug != slug {
+		return nb.store.RenameEncryptedNote(encryptedNote, oldSlug)
+	}
+	return nb.store.SaveEncryptedNote(encryptedNote)
+}
+
+// Write encrypts and stores a new text note.
+func (nb *Notebook) Write(ctx context.Context, title, text string, tags ...string) (encryptedNote *EncryptedNote, err error) {
+	note := model.NewNote(title, text)
+	for _, tag := range tags {
+		if !hasTag(note.Tags, tag) {
+			note.Tags = append(note.Tags, tag)
+		}
+	}
+	return nb.create(ctx, "write", note)
+}
+
+// Create encrypts and stores a new text note prepared by the caller, e.g. including tags and custom fields.
+// Attachments of the note are encrypted as well. If the note has no UUID or time, they are set.
+func (nb *Notebook) Create(ctx context.Context, note *Note) (encryptedNote *EncryptedNote, err error) {
+	return nb.create(ctx, "create", note)
+}
+
+func (nb *Notebook) create(ctx context.Context, op string, note *Note) (encryptedNote *EncryptedNote, err error) {
+	ref := BySlug(note.Title)
+	if err = ctx.Err(); err != nil {
+		return nil, fail(op, ref, err)
+	}
+	if note.Uuid == uuid.Nil {
+		note.Uuid = uuid.New()
+	}
+	if note.Created.IsZero() {
+		note.Created = time.Now()
+	}
+	recipients, err := nb.store.GetAgeRecipients()
+	if err != nil {
+		return nil, fail(op, ref, err)
+	}
+	encrypted, err := note.ToEncryptedNote(recipients...)
+	if err != nil {
+		return nil, fail(op, ref, err)
+	}
+	if err = nb.save(&encrypted, ""); err != nil {
+		return nil, fail(op, ref, err)
+	}
+	return &encrypted, nil
+}
+
+// AddFile encrypts and stores the content read from r as file note. If no title is given, the filename is used.
+// The content is encrypted while reading, but the ciphertext is stored as a single record, so content larger than
+// 64 MiB is rejected with ErrTooLarge.
+func (nb *Notebook) AddFile(ctx context.Context, title, filename string, r io.Reader) (encryptedNote *EncryptedNote, err error) {
+	if title == "" {
+		title = filename
+	}
+	ref := BySlug(title)
+	if err = ctx.Err(); err != nil {
+		return nil, fail("add", ref, err)
+	}
+	recipients, err := nb.store.GetAgeRecipients()
+	if err != nil {
+		return nil, fail("add", ref, err)
+	}
+	fileNote := model.NewFileNote(title, nil)
+	ciphertext, err := model.EncryptReader(r, recipients...)
+	if err != nil {
+		return nil, fail("add", ref, err)
+	}
+	encrypted := EncryptedNote{
+		Uuid:       fileNote.Uuid,
+		Created:    fileNote.Created,
+		Title:      title,
+		Ciphertext: ciphertext,
+		IsFile:     true,
+		Tags:       []string{},
+	}
+	if err = nb.save(&encrypted, ""); err != nil {
+		return nil, fail("add", ref, err)
+	}
+	return &encrypted, nil
+}
+
+// GetEncrypted returns a note without decrypting it, therefore no identity is needed.
+func (nb *Notebook) GetEncrypted(ctx context.Context, ref Ref) (encryptedNote *EncryptedNote, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, fail("get", ref, err)
+	}
+	if encryptedNote, err = nb.lookup(ref); err != nil {
+		return nil, fail("get", ref, err)
+	}
+	return encryptedNote, nil
+}
+
+// decrypt returns the encrypted and the decrypted text note referenced by ref.
+func (nb *Notebook) decrypt(ctx context.Context, op string, ref Ref) (encryptedNote *EncryptedNote, note *Note, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, nil, fail(op, ref, err)
+	}
+	if nb.identity == nil {
+		return nil, nil, fail(op, ref, ErrNoIdentity)
+	}
+	if encryptedNote, err = nb.lookup(ref); err != nil {
+		return nil, nil, fail(op, ref, err)
+	}
+	if encryptedNote.ContainsFile() {
+		return nil, nil, fail(op, ref, ErrFileNote)
+	}
+	decrypted, err := encryptedNote.ToDecryptedNote(nb.identity)
+	if err != nil {
+		return nil, nil, fail(op, ref, err)
+	}
+	return encryptedNote, &decrypted, nil
+}
+
+// Get returns a decrypted text note. Attachments are not decrypted, see GetAttachment.
+func (nb *Notebook) Get(ctx context.Context, ref Ref) (note *Note, err error) {
+	_, note, err = nb.decrypt(ctx, "get", ref)
+	return note, err
+}
+
+// GetFile returns a decrypted file note.
+func (nb *Notebook) GetFile(ctx context.Context, ref Ref) (fileNote *FileNote, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, fail("get", ref, err)
+	}
+	if nb.identity == nil {
+		return nil, fail("get", ref, ErrNoIdentity)
+	}
+	encryptedNote, err := nb.lookup(ref)
+	if err != nil {
+		return nil, fail("get", ref, err)
+	}
+	if !encryptedNote.ContainsFile() {
+		return nil, fail("get", ref, ErrTextNote)
+	}
+	encryptedNote.IsFile = true
+	decrypted, err := encryptedNote.ToDecryptedFileNote(nb.identity)
+	if err != nil {
+		return nil, fail("get", ref, err)
+	}
+	return &decrypted, nil
+}
+
+// GetAttachment returns the decrypted attachment with the given index, starting at 0.
+func (nb *Notebook) GetAttachment(ctx context.Context, ref Ref, idx int) (attachment *Attachment, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, fail("get attachment", ref, err)
+	}
+	if nb.identity == nil {
+		return nil, fail("get attachment", ref, ErrNoIdentity)
+	}
+	encryptedNote, err := nb.lookup(ref)
+	if err != nil {
+		return nil, fail("get attachment", ref, err)
+	}
+	decrypted, err := encryptedNote.DecryptAttachment(idx, nb.identity)
+	if err != nil {
+		return nil, fail("get attachment", ref, err)
+	}
+	return &decrypted, nil
+}
+
+// OpenFile returns a reader decrypting the content of a file note while reading, e.g. for streaming large files.
+func (nb *Notebook) OpenFile(ctx context.Context, ref Ref) (r io.Reader, encryptedNote *EncryptedNote, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, nil, fail("get", ref, err)
+	}
+	if nb.identity == nil {
+		return nil, nil, fail("get", ref, ErrNoIdentity)
+	}
+	if encryptedNote, err = nb.lookup(ref); err != nil {
+		return nil, nil, fail("get", ref, err)
+	}
+	if !encryptedNote.ContainsFile() {
+		return nil, nil, fail("get", ref, ErrTextNote)
+	}
+	if r, err = encryptedNote.ContentReader(nb.identity); err != nil {
+		return nil, nil, fail("get", ref, err)
+	}
+	return r, encryptedNote, nil
+}
+
+// OpenAttachment returns a reader decrypting the attachment with the given index, starting at 0, while reading.
+func (nb *Notebook) OpenAttachment(ctx context.Context, ref Ref, idx int) (r io.Reader, attachment *EncryptedAttachment, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, nil, fail("get attachment", ref, err)
+	}
+	if nb.identity == nil {
+		return nil, nil, fail("get attachment", ref, ErrNoIdentity)
+	}
+	encryptedNote, err := nb.lookup(ref)
+	if err != nil {
+		return nil, nil, fail("get attachment", ref, err)
+	}
+	if r, err = encryptedNote.AttachmentReader(idx, nb.identity); err != nil {
+		return nil, nil, fail("get attachment", ref, err)
+	}
+	return r, &encryptedNote.Attachments[idx], nil
+}
+
+// Edit decrypts a text note and stores it again after edit was called with it. The UUID and the attachments of
+// the note are kept, attachments added to note.Attachments by edit are appended. Tags and custom fields are
+// taken from the edited note. The creation time is kept unless edit changes it, the modification time is set.
+// If the title was changed, the note is moved to the new slug. If edit returns an error, nothing is stored.
+func (nb *Notebook) Edit(ctx context.Context, ref Ref, edit func(note *Note) error) (encryptedNote *EncryptedNote, err error) {
+	return nb.edit(ctx, "edit", ref, edit)
+}
+
+// Append appends text to a text note. It is separated by a line break from the existing text, if that does not end
+// with one already.
+func (nb *Notebook) Append(ctx context.Context, ref Ref, text string) (encryptedNote *EncryptedNote, err error) {
+	return nb.edit(ctx, "append", ref, func(note *Note) error {
+		if note.Text != "" && !strings.HasSuffix(note.Text, "\n") {
+			note.Text += "\n"
+		}
+		note.Text += text
+		return nil
+	})
+}
+
+// edit implements Edit, errors are reported for the given operation.
+func (nb *Notebook) edit(ctx context.Context, op string, ref Ref, edit func(note *Note) error) (encryptedNote *EncryptedNote, err error) {
+	stored, note, err := nb.decrypt(ctx, op, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err = edit(note); err != nil {
+		return nil, fail(op, ref, err)
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, fail(op, ref, err)
+	}
+	recipients, err := nb.store.GetAgeRecipients()
+	if err != nil {
+		return nil, fail(op, ref, err)
+	}
+	note.Uuid = stored.Uuid
+	encrypted, err := note.ToEncryptedNote(recipients...)
+	if err != nil {
+		return nil, fail(op, ref, err)
+	}
+	encrypted.Attachments = append(stored.Attachments, encrypted.Attachments...)
+	encrypted.Revision = stored.Revision
+	if err = nb.save(&encrypted, stored.Slug()); err != nil {
+		return nil, fail(op, ref, err)
+	}
+	return &encrypted, nil
+}
+
+// EditFile decrypts a file note and stores it again after edit was called with it, like Edit does for text notes.
+// The UUID, the tags and the attachments of the note are kept.
+func (nb *Notebook) EditFile(ctx context.Context, ref Ref, edit func(fileNote *FileNote) error) (encryptedNote *EncryptedNote, err error) {
+	fileNote, err := nb.GetFile(ctx, ref)
+	if err != nil {
+		return nil, fail("edit", ref, errors.Unwrap(err))
+	}
+	if err = edit(fileNote); err != nil {
+		return nil, fail("edit", ref, err)
+	}
+	if err = ctx.Err(); err != nil {
+		return nil, fail("edit", ref, err)
+	}
+	if encryptedNote, err = nb.replace(ref, fileNote.Title, fileNote.Created, bytes.NewReader(fileNote.Content)); err != nil {
+		return nil, fail("edit", ref, err)
+	}
+	return encryptedNote, nil
+}
+
+// Replace replaces the content of a note by the content read from r. The UUID, the title, the tags and the
+// attachments are kept. The content of text notes must be valid UTF-8, the content of file notes is encrypted
+// while reading. No identity is needed, as the old content is not decrypted.
+func (nb *Notebook) Replace(ctx context.Context, ref Ref, r io.Reader) (encryptedNote *EncryptedNote, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, fail("replace", ref, err)
+	}
+	if encryptedNote, err = nb.replace(ref, "", time.Time{}, r); err != nil {
+		return nil, fail("replace", ref, err)
+	}
+	return encryptedNote, nil
+}
+
+// replace encrypts the content for the note referenced by ref, keeping its UUID, tags and attachments.
+// An empty title keeps the title of the note, a zero creation time keeps its creation time.
+func (nb *Notebook) replace(ref Ref, title string, created time.Time, r io.Reader) (encryptedNote *EncryptedNote, err error) {
+	stored, err := nb.lookup(ref)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" {
+		title = stored.Title
+	}
+	if created.IsZero() {
+		created = stored.Created
+	}
+	recipients, err := nb.store.GetAgeRecipients()
+	if err != nil {
+		return nil, err
+	}
+	encrypted := EncryptedNote{Uuid: stored.Uuid, Created: created, Title: title, IsFile: stored.ContainsFile()}
+	if encrypted.IsFile {
+		encrypted.Ciphertext, err = model.EncryptReader(r, recipients...)
+	} else {
+		var content []byte
+		if content, err = io.ReadAll(r); err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(content) {
+			return nil, fmt.Errorf("%w: content is not valid UTF-8", ErrTextNote)
+		}
+		encrypted.Ciphertext, err = model.EncryptReader(bytes.NewReader(content), recipients...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	encrypted.Tags = stored.Tags
+	encrypted.Fields = stored.Fields
+	encrypted.Attachments = stored.Attachments
+	encrypted.Revision = stored.Revision
+	if err = nb.save(&encrypted, stored.Slug()); err != nil {
+		return nil, err
+	}
+	return &encrypted, nil
+}
+
+// Attach encrypts the content read from r and attaches it to the note using the given filename. The content
+// is encrypted while reading.
+func (nb *Notebook) Attach(ctx context.Context, ref Ref, filename string, r io.Reader) (encryptedNote *EncryptedNote, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, fail("attach", ref, err)
+	}
+	if encryptedNote, err = nb.lookup(ref); err != nil {
+		return nil, fail("attach", ref, err)
+	}
+	recipients, err := nb.store.GetAgeRecipients()
+	if err != nil {
+		return nil, fail("attach", ref, err)
+	}
+	encryptedAttachment, err := model.NewEncryptedAttachment(filename, r, recipients...)
+	if err != nil {
+		return nil, fail("attach", ref, err)
+	}
+	if given, name := encryptedNote.CheckSha256Hash(encryptedAttachment.Sha256); given {
+		return nil, fail("attach", ref, fmt.Errorf("%w under the name %s", ErrDuplicateAttachment, name))
+	}
+	encryptedNote.Attachments = append(encryptedNote.Attachments, *encryptedAttachment)
+	if err = nb.save(encryptedNote, encryptedNote.Slug()); err != nil {
+		return nil, fail("attach", ref, err)
+	}
+	return encryptedNote, nil
+}
+
+// Tag adds and removes tags. Tags which are already present are not added again.
+func (nb *Notebook) Tag(ctx context.Context, ref Ref, add, remove []string) (encryptedNote *EncryptedNote, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, fail("tag", ref, err)
+	}
+	if encryptedNote, err = nb.lookup(ref); err != nil {
+		return nil, fail("tag", ref, err)
+	}
+	for _, tag := range add {
+		if tag != "" && !hasTag(encryptedNote.Tags, tag) {
+			encryptedNote.AddTag(tag)
+		}
+	}
+	for _, tag := range remove {
+		if err = encryptedNote.RemoveTag(tag); err != nil {
+			return nil, fail("tag", ref, fmt.Errorf("%w: %s", err, tag))
+		}
+	}
+	if err = nb.save(encryptedNote, encryptedNote.Slug()); err != nil {
+		return nil, fail("tag", ref, err)
+	}
+	return encryptedNote, nil
+}
+
+// SetTags replaces the tags of a note, e.g. within the function given to Edit. Empty and duplicate tags are dropped.
+func SetTags(note *Note, tags []string) {
+	note.Tags = nil
+	for _, tag := range tags {
+		if tag != "" && !hasTag(note.Tags, tag) {
+			note.Tags = append(note.Tags, tag)
+		}
+	}
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes a note. The note is returned, e.g. for printing its slug if it was referenced by index.
+func (nb *Notebook) Delete(ctx context.Context, ref Ref) (encryptedNote *EncryptedNote, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, fail("delete", ref, err)
+	}
+	if encryptedNote, err = nb.lookup(ref); err != nil {
+		return nil, fail("delete", ref, err)
+	}
+	if err = nb.store.DeleteNoteBySlug(encryptedNote.Slug()); err != nil {
+		return nil, fail("delete", ref, err)
+	}
+	return encryptedNote, nil
+}
+
+// List returns a page of notes sorted by their creation or modification time, newest first. The quick note is
+// not listed.
+func (nb *Notebook) List(ctx context.Context, opts ListOptions) (page Page, err error) {
+	if err = ctx.Err(); err != nil {
+		return Page{}, fail("list", Ref{}, err)
+	}
+	var notes []EncryptedNote
+	if opts.Tag != "" {
+		notes, err = nb.store.GetEncryptedNoteByTag(opts.Tag)
+	} else {
+		notes, err = nb.store.GetEncryptedNotes()
+	}
+	if err != nil {
+		return Page{}, fail("list", Ref{}, err)
+	}
+	if page, err = model.Paginate(notes, opts.PageOptions); err != nil {
+		return Page{}, fail("list", Ref{}, err)
+	}
+	return page, nil
+}
+
+// Search returns the notes whose title, tags, custom fields or attachment names contain the query, ignoring the
+// case. If an identity is available, the text of text notes is searched as well. Notes which can not be decrypted
+// with the identity, e.g. as they are encrypted for other recipients, are only matched by their metadata.
+func (nb *Notebook) Search(ctx context.Context, query string) (results []SearchResult, err error) {
+	notes, err := nb.store.GetEncryptedNotes()
+	if err != nil {
+		return nil, fail("search", Ref{}, err)
+	}
+	model.SortNoteSlice(notes)
+	query = strings.ToLower(query)
+	contains := func(s string) bool { return strings.Contains(strings.ToLower(s), query) }
+	for i := range notes {
+		if err = ctx.Err(); err != nil {
+			return nil, fail("search", Ref{}, err)
+		}
+		var fields []string
+		if contains(notes[i].Title) {
+			fields = append(fields, "title")
+		}
+		for _, tag := range notes[i].Tags {
+			if contains(tag) {
+				fields = append(fields, "tag")
+				break
+			}
+		}
+		for key, value := range notes[i].Fields {
+			if contains(key) || contains(value) {
+				fields = append(fields, "field")
+				break
+			}
+		}
+		for _, attachment := range notes[i].Attachments {
+			if contains(attachment.Filename) {
+				fields = append(fields, "attachment")
+				break
+			}
+		}
+		if nb.identity != nil && !notes[i].ContainsFile() {
+			if text, err := notes[i].Decrypt(nb.identity); err == nil && contains(text) {
+				fields = append(fields, "text")
+			}
+		}
+		if len(fields) > 0 {
+			results = append(results, SearchResult{Note: notes[i], Fields: fields})
+		}
+	}
+	return results, nil
+}
+
+// Recipients returns the recipients all notes are encrypted for.
+func (nb *Notebook) Recipients(ctx context.Context) (recipients []Recipient, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, fail("recipients", Ref{}, err)
+	}
+	if recipients, err = nb.store.GetRecipients(); err != nil {
+		return nil, fail("recipients", Ref{}, err)
+	}
+	return recipients, nil
+}
+
+// AddRecipient adds an age public key as recipient of new notes. Existing notes are not re-encrypted.
+func (nb *Notebook) AddRecipient(ctx context.Context, alias, publicKey string) (err error) {
+	if err = ctx.Err(); err != nil {
+		return fail("add recipient", Ref{}, err)
+	}
+	if _, err = age.ParseX25519Recipient(publicKey); err != nil {
+		return fail("add recipient", Ref{}, err)
+	}
+	if err = nb.store.AddRecipient(*model.NewRecipient(alias, publicKey)); err != nil {
+		return fail("add recipient", Ref{}, err)
+	}
+	return nil
+}
+
+// RemoveRecipient removes the recipient with the given alias.
+func (nb *Notebook) RemoveRecipient(ctx context.Context, alias string) (err error) {
+	if err = ctx.Err(); err != nil {
+		return fail("remove recipient", Ref{}, err)
+	}
+	if err = nb.store.RemoveRecipientByAlias(alias); err != nil {
+		return fail("remove recipient", Ref{}, err)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package aen_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/3c7/aen"
+	"github.com/3c7/aen/internal/database"
+	"github.com/3c7/aen/internal/model"
+)
+
+// Provides an in-memory notebook with the identity added as recipient
+func provideNotebook(t *testing.T) *aen.Notebook {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	nb := aen.NewNotebook(database.NewMemoryStore(), identity)
+	if err = nb.AddRecipient(context.Background(), "test", identity.Recipient().String()); err != nil {
+		t.Fatalf("Could not add recipient: %v", err)
+	}
+	return nb
+}
+
+func TestNotebookWriteEditGet(t *testing.T) {
+	ctx := context.Background()
+	nb := provideNotebook(t)
+	defer nb.Close()
+
+	written, err := nb.Write(ctx, "Test Note", "Text", "tag")
+	if err != nil {
+		t.Fatalf("Could not write note: %v", err)
+	}
+	if _, err = nb.Write(ctx, "Test Note", "Other text"); !errors.Is(err, aen.ErrNoteExists) {
+		t.Fatalf("Writing a note with an existing slug should fail: %v", err)
+	}
+
+	_, err = nb.Edit(ctx, aen.ByIndex(1), func(note *aen.Note) error {
+		note.Title = "Renamed Note"
+		note.Text += " edited"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Could not edit note: %v", err)
+	}
+	if _, err = nb.Get(ctx, aen.BySlug("test-note")); !errors.Is(err, aen.ErrNoteNotFound) {
+		t.Fatalf("Old slug should not be available anymore: %v", err)
+	}
+	if _, err = nb.Get(ctx, aen.ByIndex(2)); !errors.Is(err, aen.ErrIndexOutOfRange) {
+		t.Fatalf("Index 2 should be out of range: %v", err)
+	}
+
+	note, err := nb.Get(ctx, aen.ByUuid(written.Uuid))
+	if err != nil {
+		t.Fatalf("Could not get note: %v", err)
+	}
+	if note.Title != "Renamed Note" || note.Text != "Text edited" {
+		t.Fatalf("Unexpected note content: %s, %s", note.Title, note.Text)
+	}
+	encryptedNote, err := nb.GetEncrypted(ctx, aen.BySlug("renamed-note"))
+	if err != nil || len(encryptedNote.Tags) != 1 {
+		t.Fatalf("Tags should be kept when editing: %v", err)
+	}
+	if !encryptedNote.Created.Equal(written.Created) {
+		t.Fatalf("Creation time should be kept when editing but changed to %s", encryptedNote.Created)
+	}
+	if encryptedNote.Modified.Before(written.Created) {
+		t.Fatalf("Modification time should be set when editing but was %s", encryptedNote.Modified)
+	}
+	if !written.Modified.IsZero() {
+		t.Fatalf("New notes should not have a modification time but had %s", written.Modified)
+	}
+}
+
+func TestNotebookFilesAndTags(t *testing.T) {
+	ctx := context.Background()
+	nb := provideNotebook(t)
+	defer nb.Close()
+
+	if _, err := nb.AddFile(ctx, "", "data.bin", strings.NewReader("content")); err != nil {
+		t.Fatalf("Could not add file: %v", err)
+	}
+	ref := aen.BySlug("databin")
+	if _, err := nb.Get(ctx, ref); !errors.Is(err, aen.ErrFileNote) {
+		t.Fatalf("Get should refuse file notes: %v", err)
+	}
+	fileNote, err := nb.GetFile(ctx, ref)
+	if err != nil || string(fileNote.Content) != "content" {
+		t.Fatalf("Could not get file note: %v", err)
+	}
+
+	if _, err = nb.Write(ctx, "Note", "Text"); err != nil {
+		t.Fatalf("Could not write note: %v", err)
+	}
+	ref = aen.BySlug("note")
+	if _, err = nb.Attach(ctx, ref, "a.txt", strings.NewReader("attached")); err != nil {
+		t.Fatalf("Could not attach file: %v", err)
+	}
+	if _, err = nb.Attach(ctx, ref, "b.txt", strings.NewReader("attached")); !errors.Is(err, aen.ErrDuplicateAttachment) {
+		t.Fatalf("Attaching the same content twice should fail: %v", err)
+	}
+	attachment, err := nb.GetAttachment(ctx, ref, 0)
+	if err != nil || string(attachment.Content) != "attached" {
+		t.Fatalf("Could not get attachment: %v", err)
+	}
+
+	if _, err = nb.Tag(ctx, ref, []string{"one", "two"}, nil); err != nil {
+		t.Fatalf("Could not add tags: %v", err)
+	}
+	if _, err = nb.Tag(ctx, ref, nil, []string{"three"}); !errors.Is(err, aen.ErrTagNotFound) {
+		t.Fatalf("Removing an unknown tag should fail: %v", err)
+	}
+	page, err := nb.List(ctx, aen.ListOptions{Tag: "two"})
+	if err != nil || page.Total != 1 {
+		t.Fatalf("Unexpected notes with tag: %v, %v", page, err)
+	}
+
+	results, err := nb.Search(ctx, "ATTACH")
+	if err != nil || len(results) != 0 {
+		t.Fatalf("Unexpected search results: %v, %v", results, err)
+	}
+	results, err = nb.Search(ctx, "text")
+	if err != nil || len(results) != 1 || results[0].Fields[0] != "text" {
+		t.Fatalf("Unexpected search results: %v, %v", results, err)
+	}
+
+	if _, err = nb.Delete(ctx, ref); err != nil {
+		t.Fatalf("Could not delete note: %v", err)
+	}
+	if _, err = nb.Delete(ctx, ref); !errors.Is(err, aen.ErrNoteNotFound) {
+		t.Fatalf("Deleting a deleted note should fail: %v", err)
+	}
+}
+
+func TestNotebookSearchSkipsOtherRecipients(t *testing.T) {
+	ctx := context.Background()
+	nb := provideNotebook(t)
+	defer nb.Close()
+
+	own, err := nb.Write(ctx, "Own note", "Searched text")
+	if err != nil {
+		t.Fatalf("Could not write note: %v", err)
+	}
+	own.Fields = map[string]string{"case": "CASE-42"}
+	if err = nb.Store().SaveEncryptedNote(own); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Could not generate identity: %v", err)
+	}
+	shared, err := model.NewNote("Shared note", "Searched text").ToEncryptedNote(*other.Recipient())
+	if err != nil {
+		t.Fatalf("Could not encrypt note: %v", err)
+	}
+	if err = nb.Store().SaveEncryptedNote(&shared); err != nil {
+		t.Fatalf("Could not save note: %v", err)
+	}
+
+	results, err := nb.Search(ctx, "searched")
+	if err != nil {
+		t.Fatalf("Notes of other recipients should not break the search: %v", err)
+	}
+	if len(results) != 1 || results[0].Note.Title != "Own note" {
+		t.Fatalf("Unexpected search results: %v", results)
+	}
+	if results, err = nb.Search(ctx, "shared"); err != nil || len(results) != 1 || results[0].Fields[0] != "title" {
+		t.Fatalf("Notes of other recipients should be matched by their title: %v, %v", results, err)
+	}
+	if results, err = nb.Search(ctx, "case-42"); err != nil || len(results) != 1 || results[0].Fields[0] != "field" {
+		t.Fatalf("Custom fields should be searched: %v, %v", results, err)
+	}
+}
+
+func TestNotebookEditFileAndReplace(t *testing.T) {
+	ctx := context.Background()
+	nb := provideNotebook(t)
+	defer nb.Close()
+
+	added, err := nb.AddFile(ctx, "", "data.txt", strings.NewReader("content"))
+	if err != nil {
+		t.Fatalf("Could not add file: %v", err)
+	}
+	ref := aen.BySlug("datatxt")
+	if _, err = nb.Tag(ctx, ref, []string{"file"}, nil); err != nil {
+		t.Fatalf("Could not add tag: %v", err)
+	}
+	_, err = nb.EditFile(ctx, ref, func(fileNote *aen.FileNote) error {
+		fileNote.Content = append(fileNote.Content, " edited"...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Could not edit file note: %v", err)
+	}
+	if _, err = nb.Replace(ctx, ref, strings.NewReader("replaced")); err != nil {
+		t.Fatalf("Could not replace content: %v", err)
+	}
+	fileNote, err := nb.GetFile(ctx, ref)
+	if err != nil || string(fileNote.Content) != "replaced" || fileNote.Uuid != added.Uuid {
+		t.Fatalf("Unexpected file note after replacing content: %v, %v", fileNote, err)
+	}
+	encryptedNote, err := nb.GetEncrypted(ctx, ref)
+	if err != nil || len(encryptedNote.Tags) != 1 || !encryptedNote.IsFile {
+		t.Fatalf("Tags should be kept when replacing content: %v", err)
+	}
+
+	if _, err = nb.Write(ctx, "Note", "Text"); err != nil {
+		t.Fatalf("Could not write note: %v", err)
+	}
+	if _, err = nb.EditFile(ctx, aen.BySlug("note"), func(*aen.FileNote) error { return nil }); !errors.Is(err, aen.ErrTextNote) {
+		t.Fatalf("EditFile should refuse text notes: %v", err)
+	}
+	if _, err = nb.Replace(ctx, aen.BySlug("note"), strings.NewReader("\xff")); !errors.Is(err, aen.ErrTextNote) {
+		t.Fatalf("Text notes should only accept UTF-8: %v", err)
+	}
+	if _, err = nb.Replace(ctx, aen.BySlug("note"), strings.NewReader("New text")); err != nil {
+		t.Fatalf("Could not replace text: %v", err)
+	}
+	note, err := nb.Get(ctx, aen.BySlug("note"))
+	if err != nil || note.Text != "New text" {
+		t.Fatalf("Unexpected text after replacing content: %v", err)
+	}
+}
+
+func TestNotebookAppend(t *testing.T) {
+	ctx := context.Background()
+	nb := provideNotebook(t)
+	defer nb.Close()
+
+	if _, err := nb.Write(ctx, "Log", "first"); err != nil {
+		t.Fatalf("Could not write note: %v", err)
+	}
+	for _, line := range []string{"second\n", "third\n"} {
+		if _, err := nb.Append(ctx, aen.BySlug("log"), line); err != nil {
+			t.Fatalf("Could not append to note: %v", err)
+		}
+	}
+	note, err := nb.Get(ctx, aen.BySlug("log"))
+	if err != nil || note.Text != "first\nsecond\nthird\n" {
+		t.Fatalf("Lines should be appended but text was %q: %v", note.Text, err)
+	}
+	var noteErr *aen.NoteError
+	if _, err = nb.Append(ctx, aen.BySlug("missing"), "text"); !errors.Is(err, aen.ErrNoteNotFound) || !errors.As(err, &noteErr) || noteErr.Op != "append" {
+		t.Fatalf("Appending to a missing note should fail: %v", err)
+	}
+}
+
+func TestNotebookCanceledContext(t *testing.T) {
+	nb := provideNotebook(t)
+	defer nb.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := nb.Write(ctx, "Note", "Text")
+	var noteErr *aen.NoteError
+	if !errors.Is(err, context.Canceled) || !errors.As(err, &noteErr) || noteErr.Op != "write" {
+		t.Fatalf("Unexpected error for canceled context: %v", err)
+	}
+}